@@ -15,6 +15,7 @@ func applyCORSHandler(h http.Handler) http.Handler {
 			"Content-Type",
 			"X-Requested-With",
 			"X-User-ID",
+			"X-Admin-Key",
 			"Authorization",
 			"Accept",
 			"Origin",
@@ -28,6 +28,30 @@ type WebAPIConfiguration struct {
 	DB    struct {
 		Filename string `conf:"default:/tmp/wasa.db"`
 	}
+	Admin struct {
+		Key string `conf:"mask"`
+	}
+	Media struct {
+		MaxGIFFrames    int           `conf:"default:100"`
+		MaxGIFDimension int           `conf:"default:2048"`
+		OrphanRetention time.Duration `conf:"default:720h"`
+		// Media older than ColdStorageAge is moved to files in ColdStorageDir, archiving is disabled without a directory
+		ColdStorageDir  string
+		ColdStorageAge  time.Duration `conf:"default:2160h"`
+		ArchiveInterval time.Duration `conf:"default:1h"`
+	}
+	Reactions struct {
+		RateLimit  int           `conf:"default:20"`
+		RateWindow time.Duration `conf:"default:10s"`
+		// AllowSelf lets users react to their own messages
+		AllowSelf bool `conf:"default:true"`
+	}
+	Messages struct {
+		// QuotePreviewLength is the maximum number of characters of the parent message quoted in replies
+		QuotePreviewLength int `conf:"default:120"`
+		// ExpirySweepInterval is how often messages of conversations with disappearing messages are deleted once expired
+		ExpirySweepInterval time.Duration `conf:"default:1m"`
+	}
 }
 
 // loadConfiguration creates a WebAPIConfiguration starting from flags, environment variables and configuration file.
@@ -32,7 +32,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/ardanlabs/conf"
 	"github.com/gerdalukosiute/WASAText/service/api"
@@ -84,7 +86,16 @@ func run() error {
 
 	// Start Database
 	logger.Println("initializing database support")
-	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename)
+	// Timestamps are stored in UTC, have the driver read them back in UTC too. Foreign keys are enforced on every
+	// connection. Transactions take the write lock when they begin, so that concurrent ones wait for each other
+	// instead of failing with "database is locked" when they both try to write
+	dsn := cfg.DB.Filename
+	if strings.Contains(dsn, "?") {
+		dsn += "&_loc=UTC&_foreign_keys=on&_txlock=immediate"
+	} else {
+		dsn += "?_loc=UTC&_foreign_keys=on&_txlock=immediate"
+	}
+	dbconn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		logger.WithError(err).Error("error opening SQLite DB")
 		return fmt.Errorf("opening SQLite: %w", err)
@@ -101,6 +112,18 @@ func run() error {
 		return fmt.Errorf("creating AppDatabase: %w", err)
 	}
 
+	// Media is only archived when there is somewhere to archive it to
+	var coldStorageAge time.Duration
+	if cfg.Media.ColdStorageDir != "" {
+		store, err := database.NewFileColdStore(cfg.Media.ColdStorageDir)
+		if err != nil {
+			logger.WithError(err).Error("error opening media cold storage")
+			return fmt.Errorf("opening media cold storage: %w", err)
+		}
+		db.SetColdStore(store)
+		coldStorageAge = cfg.Media.ColdStorageAge
+	}
+
 	// Start (main) API server
 	logger.Info("initializing API server")
 
@@ -115,8 +138,20 @@ func run() error {
 
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:                logger,
+		Database:              db,
+		AdminKey:              cfg.Admin.Key,
+		MaxGIFFrames:          cfg.Media.MaxGIFFrames,
+		MaxGIFDimension:       cfg.Media.MaxGIFDimension,
+		OrphanRetention:       cfg.Media.OrphanRetention,
+		ReactionRateLimit:     cfg.Reactions.RateLimit,
+		ReactionRateWindow:    cfg.Reactions.RateWindow,
+		DisallowSelfReactions: !cfg.Reactions.AllowSelf,
+		ColdStorageAge:        coldStorageAge,
+		ArchiveInterval:       cfg.Media.ArchiveInterval,
+		QuotePreviewLength:    cfg.Messages.QuotePreviewLength,
+
+		ExpiredMessageSweepInterval: cfg.Messages.ExpirySweepInterval,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
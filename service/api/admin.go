@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Handles listing all users for admin tooling, with pagination, sorting and filtering
+func (rt *_router) handleAdminListUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	ctx.Logger.Info("Handling admin list users request")
+
+	query := r.URL.Query()
+
+	// Parse pagination parameters
+	limit, offset, err := parsePagination(query, 50, 500)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Parse sorting parameters
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = "name"
+	}
+	if sortBy != "name" && sortBy != "created" {
+		sendJSONError(w, "Sort must be either 'name' or 'created'", http.StatusBadRequest)
+		return
+	}
+	order := query.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		sendJSONError(w, "Order must be either 'asc' or 'desc'", http.StatusBadRequest)
+		return
+	}
+
+	filter := query.Get("q")
+	if len(filter) > 16 {
+		sendJSONError(w, "Query must be at most 16 characters", http.StatusBadRequest)
+		return
+	}
+
+	users, total, err := rt.db.ListUsers(filter, sortBy, order == "desc", limit, offset)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to list users")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type adminUserInfo struct {
+		Username       string `json:"username"`
+		UserID         string `json:"userId"`
+		ProfilePhotoID string `json:"profilePhotoId,omitempty"`
+		CreatedAt      string `json:"createdAt,omitempty"`
+	}
+
+	userInfos := make([]adminUserInfo, len(users))
+	for i, user := range users {
+		userInfos[i] = adminUserInfo{
+			Username:       user.Name,
+			UserID:         user.ID,
+			ProfilePhotoID: user.PhotoID,
+		}
+		// Users created before the creation time was recorded have none
+		if user.CreatedAt != nil {
+			userInfos[i].CreatedAt = user.CreatedAt.Format(time.RFC3339)
+		}
+	}
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"usersCount": len(userInfos),
+		"total":      total,
+	}).Info("Returning admin users list")
+
+	response := struct {
+		Users  []adminUserInfo `json:"users"`
+		Total  int             `json:"total"`
+		Limit  int             `json:"limit"`
+		Offset int             `json:"offset"`
+	}{
+		Users:  userInfos,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode JSON response")
+		return
+	}
+}
+
+// Handles reporting the storage used by media files
+func (rt *_router) handleAdminStorage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	ctx.Logger.Info("Handling admin storage request")
+
+	stats, err := rt.db.GetMediaStorageStats()
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get media storage stats")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type mimeTypeUsage struct {
+		MimeType string `json:"mimeType"`
+		Count    int    `json:"count"`
+		Bytes    int64  `json:"bytes"`
+	}
+
+	byMimeType := make([]mimeTypeUsage, len(stats.ByMimeType))
+	for i, usage := range stats.ByMimeType {
+		byMimeType[i] = mimeTypeUsage{
+			MimeType: usage.MimeType,
+			Count:    usage.Count,
+			Bytes:    usage.Bytes,
+		}
+	}
+
+	hotHits, coldHits := rt.db.GetMediaHits()
+
+	response := struct {
+		Count           int             `json:"count"`
+		TotalBytes      int64           `json:"totalBytes"`
+		ByMimeType      []mimeTypeUsage `json:"byMimeType"`
+		Oldest          *string         `json:"oldest"`
+		OrphanRetention string          `json:"orphanRetention"`
+		ColdCount       int             `json:"coldCount"`
+		ColdBytes       int64           `json:"coldBytes"`
+		ColdStorageAge  string          `json:"coldStorageAge,omitempty"`
+		HotHits         int64           `json:"hotHits"`
+		ColdHits        int64           `json:"coldHits"`
+	}{
+		Count:           stats.Count,
+		TotalBytes:      stats.TotalBytes,
+		ByMimeType:      byMimeType,
+		OrphanRetention: rt.orphanRetention.String(),
+		ColdCount:       stats.ColdCount,
+		ColdBytes:       stats.ColdBytes,
+		HotHits:         hotHits,
+		ColdHits:        coldHits,
+	}
+	if rt.coldStorageAge > 0 {
+		response.ColdStorageAge = rt.coldStorageAge.String()
+	}
+	if stats.Oldest != nil {
+		oldest := stats.Oldest.Format(time.RFC3339)
+		response.Oldest = &oldest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode JSON response")
+	}
+}
+
+// Number of media files deleted per transaction by the orphan media cleanup
+const orphanMediaBatchSize = 100
+
+// Handles deleting media files that nothing refers to anymore and are older than the retention period. The retention
+// can be overridden for a single run with the olderThan parameter, as a duration such as "48h"
+func (rt *_router) handleAdminCleanupMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	retention := rt.orphanRetention
+	if value := r.URL.Query().Get("olderThan"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			sendJSONError(w, "olderThan must be a positive duration, such as 48h", http.StatusBadRequest)
+			return
+		}
+		retention = parsed
+	}
+
+	ctx.Logger.WithField("retention", retention.String()).Info("Handling admin media cleanup request")
+
+	cutoff := time.Now().Add(-retention)
+	deleted, freedBytes, err := rt.db.DeleteOrphanMedia(cutoff, orphanMediaBatchSize)
+	if err != nil {
+		ctx.Logger.WithError(err).WithField("deleted", deleted).Error("Failed to delete orphan media")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"deleted":    deleted,
+		"freedBytes": freedBytes,
+	}).Info("Orphan media deleted")
+
+	response := struct {
+		Deleted    int    `json:"deleted"`
+		FreedBytes int64  `json:"freedBytes"`
+		OlderThan  string `json:"olderThan"`
+	}{
+		Deleted:    deleted,
+		FreedBytes: freedBytes,
+		OlderThan:  cutoff.Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode JSON response")
+	}
+}
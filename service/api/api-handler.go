@@ -9,24 +9,69 @@ func (rt *_router) Handler() http.Handler {
 	// Register routes
 	rt.router.POST("/session", rt.wrap(rt.handleLogin))
 	rt.router.PUT("/user", rt.withAuth(rt.handleUpdateUsername))
+	rt.router.DELETE("/user", rt.withAuth(rt.handleDeleteAccount))
 	rt.router.GET("/users", rt.withAuth(rt.handleSearchUsers))
-	rt.router.PUT("/user/:userId", rt.withAuth(rt.handleUpdateUserPhoto))
+	rt.router.GET("/users/available", rt.wrap(rt.handleCheckUsernameAvailable))
+	rt.router.PUT("/user/:userId", rt.withAuth(rt.handlePutUserPath))
+	rt.router.DELETE("/user/:userId/:item", rt.withAuth(rt.handleDeleteUserPath))
+	rt.router.POST("/user/blocks", rt.withAuth(rt.handleBlockUser))
+	rt.router.GET("/user/recent-emoji", rt.withAuth(rt.handleGetRecentEmoji))
+	rt.router.GET("/user/export", rt.withAuth(rt.handleExportUserData))
+	rt.router.GET("/ws", rt.withAuth(rt.handleWebSocket))
 	rt.router.GET("/conversations", rt.withAuth(rt.handleGetConversations))
 	rt.router.POST("/conversations", rt.withAuth(rt.handleStartConversation))
 	rt.router.POST("/conversations/:conversationId/messages", rt.withAuth(rt.handleSendMessage))
+	rt.router.GET("/conversations/:conversationId/messages", rt.withAuth(rt.handleGetMessagesAfterSeq))
+	rt.router.GET("/conversations/:conversationId/messages/search", rt.withAuth(rt.handleSearchMessages))
 	rt.router.GET("/media/:mediaId", rt.withAuth(rt.handleGetMedia))
+	rt.router.GET("/media/:mediaId/thumbnail", rt.withAuth(rt.handleGetMediaThumbnail))
 	rt.router.POST("/messages/:messageId/forward", rt.withAuth(rt.handleForwardMessage))
+	rt.router.GET("/messages/:messageId/replies", rt.withAuth(rt.handleGetReplies))
+	rt.router.GET("/messages/:messageId/forward-chain", rt.withAuth(rt.handleGetForwardChain))
+	rt.router.GET("/messages/:messageId/forwarded-to", rt.withAuth(rt.handleGetForwardDestinations))
+	rt.router.POST("/messages/:messageId/save", rt.withAuth(rt.handleSaveMessage))
+	rt.router.POST("/messages/:messageId/approve", rt.withAuth(rt.handleApproveMessage))
+	rt.router.GET("/saved", rt.withAuth(rt.handleGetSavedMessages))
+	rt.router.PUT("/messages/:messageId/flag", rt.withAuth(rt.handleFlagMessage))
+	rt.router.DELETE("/messages/:messageId/flag", rt.withAuth(rt.handleUnflagMessage))
+	rt.router.GET("/flagged", rt.withAuth(rt.handleGetFlaggedMessages))
+	rt.router.GET("/mentions", rt.withAuth(rt.handleGetMentions))
 	rt.router.PUT("/messages/:messageId/status", rt.withAuth(rt.handleUpdateMessageStatus))
+	rt.router.GET("/messages/:messageId/status", rt.withAuth(rt.handleGetMessageStatus))
+	rt.router.GET("/messages/:messageId/receipts", rt.withAuth(rt.handleGetMessageReceipts))
+	rt.router.GET("/messages/:messageId", rt.withAuth(rt.handleGetMessagePath))
 	rt.router.DELETE("/messages/:messageId", rt.withAuth(rt.handleDeleteMessage))
 	rt.router.POST("/messages/:messageId/comments", rt.withAuth(rt.handleAddComment))
+	rt.router.GET("/messages/:messageId/comments", rt.withAuth(rt.handleGetComments))
 	rt.router.DELETE("/messages/:messageId/comments/:commentId", rt.withAuth(rt.handleDeleteComment))
+	rt.router.GET("/messages/:messageId/reactions", rt.withAuth(rt.handleGetReactions))
 	rt.router.POST("/groups/:groupId", rt.withAuth(rt.handleAddToGroup))
 	rt.router.DELETE("/groups/:groupId", rt.withAuth(rt.handleLeaveGroup))
 	rt.router.PUT("/groups/:groupId", rt.withAuth(rt.handleSetGroupName))
 	rt.router.PATCH("/groups/:groupId", rt.withAuth(rt.handleSetGroupPhoto))
+	rt.router.GET("/groups/:groupId/admins", rt.withAuth(rt.handleGetGroupAdmins))
+	rt.router.GET("/groups/:groupId/members", rt.withAuth(rt.handleGetGroupMembers))
+	rt.router.GET("/groups/:groupId/timeline", rt.withAuth(rt.handleGetGroupTimeline))
+	rt.router.PUT("/groups/:groupId/settings", rt.withAuth(rt.handleUpdateGroupSettings))
+	rt.router.GET("/groups/:groupId/pending", rt.withAuth(rt.handleGetPendingMessages))
+	rt.router.DELETE("/groups/:groupId/reactions", rt.withAuth(rt.handleDeleteUserReactions))
+	rt.router.DELETE("/groups/:groupId/members/:userId", rt.withAuth(rt.handleRemoveGroupMember))
 	rt.router.GET("/conversations/:conversationId", rt.withAuth(rt.handleGetConversationDetails))
+	rt.router.DELETE("/conversations/:conversationId", rt.withAuth(rt.handleDeleteConversation))
+	rt.router.GET("/conversations/:conversationId/export", rt.withAuth(rt.handleExportConversation))
+	rt.router.GET("/conversations/:conversationId/events", rt.withAuth(rt.handleConversationEvents))
+	rt.router.PUT("/conversations/:conversationId/theme", rt.withAuth(rt.handleSetConversationTheme))
+	rt.router.PUT("/conversations/:conversationId/pin", rt.withAuth(rt.handlePinConversation))
+	rt.router.PUT("/conversations/:conversationId/ttl", rt.withAuth(rt.handleSetMessageTTL))
+	rt.router.PUT("/conversations/:conversationId/read", rt.withAuth(rt.handleMarkConversationRead))
+	rt.router.DELETE("/conversations/:conversationId/pin", rt.withAuth(rt.handleUnpinConversation))
+	// Admin routes
+	rt.router.GET("/admin/users", rt.withAdmin(rt.handleAdminListUsers))
+	rt.router.GET("/admin/storage", rt.withAdmin(rt.handleAdminStorage))
+	rt.router.POST("/admin/storage/cleanup", rt.withAdmin(rt.handleAdminCleanupMedia))
 	// Special routes
 	rt.router.GET("/liveness", rt.liveness)
+	rt.router.GET("/readiness", rt.wrap(rt.readiness))
 
 	return rt.router
 }
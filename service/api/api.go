@@ -39,6 +39,7 @@ package api
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gerdalukosiute/WASAText/service/database"
 	"github.com/julienschmidt/httprouter"
@@ -52,6 +53,37 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// AdminKey is the key required in the X-Admin-Key header by the admin endpoints. Admin endpoints are disabled
+	// when it's empty
+	AdminKey string
+
+	// MaxGIFFrames is the maximum number of frames accepted for an uploaded GIF
+	MaxGIFFrames int
+
+	// MaxGIFDimension is the maximum width and height (in pixels) accepted for an uploaded GIF
+	MaxGIFDimension int
+
+	// OrphanRetention is how long media not referenced anywhere is kept before the admin cleanup deletes it
+	OrphanRetention time.Duration
+
+	// ReactionRateLimit is the number of reactions a user can add or remove within ReactionRateWindow
+	ReactionRateLimit  int
+	ReactionRateWindow time.Duration
+
+	// DisallowSelfReactions stops users from reacting to their own messages
+	DisallowSelfReactions bool
+
+	// ColdStorageAge is the age after which media files are moved to cold storage, checking every ArchiveInterval.
+	// Zero disables archiving, which also requires the database to have a cold store
+	ColdStorageAge  time.Duration
+	ArchiveInterval time.Duration
+
+	// QuotePreviewLength is the maximum number of characters of the parent message quoted in replies
+	QuotePreviewLength int
+
+	// ExpiredMessageSweepInterval is how often messages past their expiration are deleted
+	ExpiredMessageSweepInterval time.Duration
 }
 
 // Router is the package API interface representing an API handler builder
@@ -72,6 +104,30 @@ func New(cfg Config) (Router, error) {
 	if cfg.Database == nil {
 		return nil, errors.New("database is required")
 	}
+	if cfg.MaxGIFFrames <= 0 {
+		cfg.MaxGIFFrames = 100
+	}
+	if cfg.MaxGIFDimension <= 0 {
+		cfg.MaxGIFDimension = 2048
+	}
+	if cfg.OrphanRetention <= 0 {
+		cfg.OrphanRetention = 30 * 24 * time.Hour
+	}
+	if cfg.ReactionRateLimit <= 0 {
+		cfg.ReactionRateLimit = 20
+	}
+	if cfg.ReactionRateWindow <= 0 {
+		cfg.ReactionRateWindow = 10 * time.Second
+	}
+	if cfg.ArchiveInterval <= 0 {
+		cfg.ArchiveInterval = time.Hour
+	}
+	if cfg.QuotePreviewLength <= 0 {
+		cfg.QuotePreviewLength = 120
+	}
+	if cfg.ExpiredMessageSweepInterval <= 0 {
+		cfg.ExpiredMessageSweepInterval = time.Minute
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -79,11 +135,29 @@ func New(cfg Config) (Router, error) {
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
 
-	return &_router{
+	rt := &_router{
 		router:     router,
 		baseLogger: cfg.Logger,
 		db:         cfg.Database,
-	}, nil
+		adminKey:   cfg.AdminKey,
+
+		maxGIFFrames:          cfg.MaxGIFFrames,
+		maxGIFDimension:       cfg.MaxGIFDimension,
+		orphanRetention:       cfg.OrphanRetention,
+		reactionLimiter:       newRateLimiter(cfg.ReactionRateLimit, cfg.ReactionRateWindow),
+		disallowSelfReactions: cfg.DisallowSelfReactions,
+		usernameLimiter:       newRateLimiter(usernameCheckRateLimit, usernameCheckRateWindow),
+		coldStorageAge:        cfg.ColdStorageAge,
+		quotePreviewLength:    cfg.QuotePreviewLength,
+		events:                newEventHub(),
+		linkPreviews:          newLinkPreviewer(),
+	}
+	if cfg.ColdStorageAge > 0 {
+		rt.startMediaArchiver(cfg.ArchiveInterval)
+	}
+	rt.startMessageSweeper(cfg.ExpiredMessageSweepInterval)
+
+	return rt, nil
 }
 
 type _router struct {
@@ -94,4 +168,37 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabase
+
+	adminKey string
+
+	// Limits applied to uploaded GIF images
+	maxGIFFrames    int
+	maxGIFDimension int
+
+	orphanRetention time.Duration
+
+	// Limits how often each user can add or remove reactions
+	reactionLimiter *rateLimiter
+
+	disallowSelfReactions bool
+
+	// Limits how often each client can check whether usernames are available
+	usernameLimiter *rateLimiter
+
+	// Media older than coldStorageAge is moved to cold storage by the media archiver, when it is running
+	coldStorageAge time.Duration
+	stopArchiver   chan struct{}
+	archiverDone   chan struct{}
+
+	quotePreviewLength int
+
+	// The message sweeper deletes expired messages in the background
+	stopSweeper chan struct{}
+	sweeperDone chan struct{}
+
+	// events pushes changes to the clients connected to /ws
+	events *eventHub
+
+	// linkPreviews fetches the previews of the links in text messages
+	linkPreviews *linkPreviewer
 }
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gerdalukosiute/WASAText/service/database"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+// testServer serves the API over an empty database in a temporary directory
+type testServer struct {
+	rt      *_router
+	handler http.Handler
+	db      database.AppDatabase
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_loc=UTC&_foreign_keys=on&_txlock=immediate")
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	db, err := database.New(conn)
+	if err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	router, err := New(Config{Logger: logger, Database: db})
+	if err != nil {
+		t.Fatalf("creating router: %v", err)
+	}
+	t.Cleanup(func() { _ = router.Close() })
+	return &testServer{rt: router.(*_router), handler: router.Handler(), db: db}
+}
+
+// newUser creates a user and returns their ID
+func (s *testServer) newUser(t *testing.T, name string) string {
+	t.Helper()
+	id, err := s.db.GetOrCreateUser(name)
+	if err != nil {
+		t.Fatalf("creating user %s: %v", name, err)
+	}
+	return id
+}
+
+// serve sends a request on behalf of a user, with a JSON body when body isn't empty
+func (s *testServer) serve(method, path, userID, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if userID != "" {
+		r.Header.Set("X-User-ID", userID)
+	}
+	return s.do(r)
+}
+
+// do sends a request built by the caller
+func (s *testServer) do(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	return w
+}
+
+// expectStatus fails the test when a response doesn't have the expected status
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+}
+
+// decodeJSON decodes the body of a response
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"time"
+)
+
+// Number of media files moved to cold storage per database call by the media archiver. The archiver checks whether it
+// has to stop between batches
+const mediaArchiveBatchSize = 20
+
+// startMediaArchiver starts a background goroutine that moves media older than coldStorageAge to cold storage, once
+// right away and then every interval, until Close is called
+func (rt *_router) startMediaArchiver(interval time.Duration) {
+	rt.stopArchiver = make(chan struct{})
+	rt.archiverDone = make(chan struct{})
+
+	go func() {
+		defer close(rt.archiverDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			rt.archiveMedia()
+
+			select {
+			case <-rt.stopArchiver:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// archiveMedia moves all the media older than coldStorageAge to cold storage, a batch at a time
+func (rt *_router) archiveMedia() {
+	olderThan := time.Now().UTC().Add(-rt.coldStorageAge)
+
+	var archived int
+	var bytes int64
+batches:
+	for {
+		count, batchBytes, err := rt.db.ArchiveMedia(olderThan, mediaArchiveBatchSize)
+		archived += count
+		bytes += batchBytes
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("Failed to archive media")
+			break
+		}
+		if count < mediaArchiveBatchSize {
+			break
+		}
+
+		select {
+		case <-rt.stopArchiver:
+			break batches
+		default:
+		}
+	}
+
+	if archived > 0 {
+		rt.baseLogger.WithField("count", archived).WithField("bytes", bytes).Info("Moved media to cold storage")
+	}
+}
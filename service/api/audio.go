@@ -0,0 +1,43 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// maxAudioSize is the size limit of the recordings sent as audio messages
+const maxAudioSize = 10 << 20
+
+// detectAudioType returns the mime type of an MP3, Ogg or WAV recording from its first bytes, or an empty string for
+// anything else
+func detectAudioType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("ID3")):
+		return "audio/mpeg"
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		// MP3 without an ID3 tag starts right away with the sync word of the first frame
+		return "audio/mpeg"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "audio/ogg"
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return "audio/wav"
+	}
+	return ""
+}
+
+// parseAudioDuration parses the duration in seconds clients can send along with an audio message. Clients that don't
+// know it leave it out, which gives 0
+func parseAudioDuration(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, errors.New("duration must be positive")
+	}
+	return duration, nil
+}
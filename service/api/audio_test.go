@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestDetectAudioType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"MP3 with an ID3 tag", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "audio/mpeg"},
+		{"MP3 frame", []byte{0xFF, 0xFB, 0x90, 0x64}, "audio/mpeg"},
+		{"Ogg", []byte("OggS\x00\x02\x00\x00"), "audio/ogg"},
+		{"WAV", []byte("RIFF\x24\x08\x00\x00WAVEfmt "), "audio/wav"},
+		{"RIFF that isn't WAV", []byte("RIFF\x24\x08\x00\x00AVI LIST"), ""},
+		{"truncated RIFF", []byte("RIFF\x24\x08"), ""},
+		{"PNG", []byte("\x89PNG\r\n\x1a\n"), ""},
+		{"text", []byte("hello"), ""},
+		{"single byte", []byte{0xFF}, ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectAudioType(tt.data); got != tt.want {
+				t.Errorf("detectAudioType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAudioDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"42", 42, false},
+		{"0", 0, true},
+		{"-3", 0, true},
+		{"4.5", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAudioDuration(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseAudioDuration(%q) = %d, %v, want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
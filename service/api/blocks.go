@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// handleBlockUser handles POST requests to /user/blocks, blocking the user with the given username
+func (rt *_router) handleBlockUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling block user request")
+
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to decode request body")
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		sendJSONError(w, "Missing required field 'username'", http.StatusBadRequest)
+		return
+	}
+
+	blockedID, err := rt.db.GetUserIDByName(username)
+	if err != nil {
+		ctx.Logger.WithError(err).WithField("username", username).Error("Failed to get user to block")
+		sendJSONError(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if blockedID == userID {
+		sendJSONError(w, "Users can't block themselves", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.BlockUser(userID, blockedID); err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			sendDatabaseError(w, err, "User not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to block user")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"userID":    userID,
+		"blockedID": blockedID,
+	}).Info("User blocked")
+
+	response := struct {
+		UserID   string `json:"userId"`
+		Username string `json:"username"`
+		Blocked  bool   `json:"blocked"`
+	}{
+		UserID:   blockedID,
+		Username: username,
+		Blocked:  true,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode JSON response")
+	}
+}
+
+// handleUnblockUser handles DELETE requests to /user/blocks/{userId}, lifting a block set by the user
+func (rt *_router) handleUnblockUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	// The blocked user's ID is in the second wildcard, see handleDeleteUserPath
+	blockedID := ps.ByName("item")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"userID":    userID,
+		"blockedID": blockedID,
+	}).Info("Handling unblock user request")
+
+	if err := rt.db.UnblockUser(userID, blockedID); err != nil {
+		if errors.Is(err, database.ErrUserNotBlocked) {
+			sendDatabaseError(w, err, "User is not blocked")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to unblock user")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		UserID  string `json:"userId"`
+		Blocked bool   `json:"blocked"`
+	}{
+		UserID:  blockedID,
+		Blocked: false,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode JSON response")
+	}
+}
@@ -5,10 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
-	"unicode"
 	"unicode/utf8"
 
 	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
@@ -17,25 +18,47 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Limits for requests listing usernames, so that the work done per request is bounded
+const (
+	maxUsernamesPerRequest = 256
+	maxUsernamesBodyBytes  = 64 << 10
+)
+
+// Longer title queries when listing conversations are rejected
+const maxConversationQueryLength = 100
+
 // Updated response structures to match API documentation
 type ConversationDetailsResponse struct {
-	ConversationID string                `json:"conversationId"`
-	Title          string                `json:"title"`
-	IsGroup        bool                  `json:"isGroup"`
-	GroupPhotoID   string                `json:"groupPhotoId,omitempty"`
-	CreatedAt      string                `json:"createdAt"`
-	Participants   []ParticipantResponse `json:"participants"`
-	Messages       []MessageResponse     `json:"messages"`
+	ConversationID string                 `json:"conversationId"`
+	Title          string                 `json:"title"`
+	IsGroup        bool                   `json:"isGroup"`
+	GroupPhotoID   string                 `json:"groupPhotoId,omitempty"`
+	CreatedAt      string                 `json:"createdAt"`
+	Participants   []ParticipantResponse  `json:"participants"`
+	Settings       *GroupSettingsResponse `json:"settings,omitempty"`
+	Theme          string                 `json:"theme,omitempty"`
+	LastReadSeq    int64                  `json:"lastReadSeq"`
+	// MessageTTLSeconds is how long new messages are kept before they disappear, left out when they are kept
+	MessageTTLSeconds int `json:"messageTtlSeconds,omitempty"`
+	// HasMore and OldestTimestamp are only set when the messages are paged
+	HasMore         *bool  `json:"hasMore,omitempty"`
+	OldestTimestamp string `json:"oldestTimestamp,omitempty"`
+	// UnreadCount and FirstUnreadMessageID are only set when only the unread messages are returned
+	UnreadCount          *int   `json:"unreadCount,omitempty"`
+	FirstUnreadMessageID string `json:"firstUnreadMessageId,omitempty"`
+	// Messages are streamed after the rest of the response, see streamJSONObject
 }
 
 type ParticipantResponse struct {
 	Username       string `json:"username"`
 	UserID         string `json:"userId"`
 	ProfilePhotoID string `json:"profilePhotoId,omitempty"`
+	Bio            string `json:"bio,omitempty"`
 }
 
 type MessageResponse struct {
 	MessageID       string             `json:"messageId"`
+	Seq             int64              `json:"seq,omitempty"`
 	ParentMessageID string             `json:"parentMessageId,omitempty"`
 	IsForwarded     bool               `json:"isForwarded,omitempty"`
 	Sender          SenderResponse     `json:"sender"`
@@ -44,6 +67,38 @@ type MessageResponse struct {
 	Timestamp       string             `json:"timestamp"`
 	Status          string             `json:"status"`
 	Reactions       []ReactionResponse `json:"reactions,omitempty"`
+	// ReactionSummary groups Reactions by emoji, in the order each emoji was first used
+	ReactionSummary []ReactionSummaryResponse `json:"reactionSummary,omitempty"`
+	// MyReactions lists the emoji the caller reacted with
+	MyReactions []string `json:"myReactions,omitempty"`
+	// ParentPreview is a copy of the message replied to, with its content bounded to the quote preview length
+	ParentPreview *QuotePreviewResponse `json:"parentPreview,omitempty"`
+	// DeletedAt is only set for deleted messages, which have the "deleted" type and a placeholder content
+	DeletedAt string `json:"deletedAt,omitempty"`
+	// Duration is the length in seconds of an audio message, when its sender told it
+	Duration int `json:"duration,omitempty"`
+	// Location holds the coordinates of location messages, whose content is the same location as JSON
+	Location *LocationResponse `json:"location,omitempty"`
+	// ExpiresAt is when the message disappears, in conversations with disappearing messages
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// LinkPreview describes the first link of a text message, once it has been fetched
+	LinkPreview *LinkPreviewResponse `json:"linkPreview,omitempty"`
+	// Format tells how to render text messages, "plain" or "markdown"
+	Format string `json:"format,omitempty"`
+	// OriginalSender and OriginalTimestamp tell who first sent a forwarded message and when
+	OriginalSender    *SenderResponse `json:"originalSender,omitempty"`
+	OriginalTimestamp string          `json:"originalTimestamp,omitempty"`
+}
+
+// deletedMessagePlaceholder replaces the content of deleted messages
+const deletedMessagePlaceholder = "This message was deleted"
+
+type QuotePreviewResponse struct {
+	MessageID string         `json:"messageId"`
+	Sender    SenderResponse `json:"sender"`
+	Type      string         `json:"type"`
+	Content   string         `json:"content"`
+	Truncated bool           `json:"truncated"`
 }
 
 type SenderResponse struct {
@@ -59,6 +114,13 @@ type ReactionResponse struct {
 	Timestamp     string `json:"timestamp"`
 }
 
+type ReactionSummaryResponse struct {
+	Emoji       string   `json:"emoji"`
+	Count       int      `json:"count"`
+	Usernames   []string `json:"usernames"`
+	ReactedByMe bool     `json:"reactedByMe"`
+}
+
 // ConversationResponse represents the API response for a conversation summary (Updated)
 type ConversationResponse struct {
 	ConversationID string  `json:"conversationId"`
@@ -71,6 +133,89 @@ type ConversationResponse struct {
 		Content   string `json:"content"`
 		Timestamp string `json:"timestamp"`
 	} `json:"lastMessage"`
+	LastReadSeq int64 `json:"lastReadSeq"`
+	UnreadCount int   `json:"unreadCount"`
+	IsPinned    bool  `json:"isPinned"`
+	// ParticipantCount is 1 for 1:1 conversations the other participant removed from their list
+	ParticipantCount int    `json:"participantCount"`
+	LastActivity     string `json:"lastActivity"`
+}
+
+// Convert database conversations to response format
+func convertConversations(conversations []database.Conversation) []ConversationResponse {
+	conversationResponses := make([]ConversationResponse, len(conversations))
+	for i, conv := range conversations {
+		// Create the LastMessage struct with proper type conversion
+		lastMessage := struct {
+			Type      string `json:"type"`
+			Content   string `json:"content"`
+			Timestamp string `json:"timestamp"`
+		}{
+			Type:      conv.LastMessage.Type,
+			Content:   conv.LastMessage.Content,
+			Timestamp: conv.LastMessage.Timestamp.Format(time.RFC3339),
+		}
+		if lastMessage.Type == database.MessageTypeDeleted {
+			lastMessage.Content = deletedMessagePlaceholder
+		}
+
+		title := conv.Title
+		if conv.IsGroup && strings.TrimSpace(title) == "" {
+			title = groupTitleFromNames(conv.OtherParticipantNames, conv.ParticipantCount-1)
+		}
+
+		conversationResponses[i] = ConversationResponse{
+			ConversationID: conv.ID,
+			Title:          title,
+			CreatedAt:      conv.CreatedAt.Format(time.RFC3339),
+			ProfilePhotoID: conv.ProfilePhoto,
+			IsGroup:        conv.IsGroup,
+			LastMessage:    lastMessage,
+			LastReadSeq:    conv.LastReadSeq,
+			UnreadCount:    conv.UnreadCount,
+			IsPinned:       conv.PinnedAt != nil,
+
+			ParticipantCount: conv.ParticipantCount,
+			LastActivity:     conv.LastActivity.Format(time.RFC3339),
+		}
+	}
+	return conversationResponses
+}
+
+// defaultGroupTitle builds a display title for a group without one from the names of its other participants, like
+// "Group with Alice, Bob, +3". The stored title is left untouched
+func defaultGroupTitle(participants []database.Participant, userID string) string {
+	names := make([]string, 0, maxGroupTitleNames)
+	others := 0
+	for _, p := range participants {
+		if p.ID == userID {
+			continue
+		}
+		others++
+		if len(names) < maxGroupTitleNames {
+			names = append(names, p.Name)
+		}
+	}
+	return groupTitleFromNames(names, others)
+}
+
+// maxGroupTitleNames is the number of participants named in default group titles
+const maxGroupTitleNames = 2
+
+// groupTitleFromNames builds a default group title from the names of the first other participants and the number of
+// other participants
+func groupTitleFromNames(names []string, others int) string {
+	if others <= 0 || len(names) == 0 {
+		return "Group"
+	}
+	if len(names) > maxGroupTitleNames {
+		names = names[:maxGroupTitleNames]
+	}
+	title := "Group with " + strings.Join(names, ", ")
+	if others > len(names) {
+		title += fmt.Sprintf(", +%d", others-len(names))
+	}
+	return title
 }
 
 // Handles retrieving the users conversations
@@ -89,7 +234,28 @@ func (rt *_router) handleGetConversations(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	conversations, total, err := rt.db.GetUserConversations(userID)
+	// The list can be narrowed down to groups or 1:1 conversations, and to titles containing a query
+	query := r.URL.Query()
+	var filter database.ConversationFilter
+	switch query.Get("type") {
+	case "":
+	case "group":
+		isGroup := true
+		filter.IsGroup = &isGroup
+	case "direct":
+		isGroup := false
+		filter.IsGroup = &isGroup
+	default:
+		sendJSONError(w, "type must be either 'group' or 'direct'", http.StatusBadRequest)
+		return
+	}
+	filter.Title = strings.TrimSpace(query.Get("q"))
+	if utf8.RuneCountInString(filter.Title) > maxConversationQueryLength {
+		sendJSONError(w, fmt.Sprintf("q must be at most %d characters", maxConversationQueryLength), http.StatusBadRequest)
+		return
+	}
+
+	conversations, total, err := rt.db.GetUserConversations(userID, filter)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to get user conversations")
 		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
@@ -97,28 +263,7 @@ func (rt *_router) handleGetConversations(w http.ResponseWriter, r *http.Request
 	}
 
 	// Convert database.Conversation to ConversationResponse
-	conversationResponses := make([]ConversationResponse, len(conversations))
-	for i, conv := range conversations {
-		// Create the LastMessage struct with proper type conversion
-		lastMessage := struct {
-			Type      string `json:"type"`
-			Content   string `json:"content"`
-			Timestamp string `json:"timestamp"`
-		}{
-			Type:      conv.LastMessage.Type,
-			Content:   conv.LastMessage.Content,
-			Timestamp: conv.LastMessage.Timestamp.Format(time.RFC3339),
-		}
-
-		conversationResponses[i] = ConversationResponse{
-			ConversationID: conv.ID,
-			Title:          conv.Title,
-			CreatedAt:      conv.CreatedAt.Format(time.RFC3339),
-			ProfilePhotoID: conv.ProfilePhoto,
-			IsGroup:        conv.IsGroup,
-			LastMessage:    lastMessage,
-		}
-	}
+	conversationResponses := convertConversations(conversations)
 
 	// Create the response object according to API spec
 	response := struct {
@@ -152,6 +297,7 @@ func (rt *_router) handleStartConversation(w http.ResponseWriter, r *http.Reques
 		IsGroup    bool     `json:"isGroup"`
 	}
 
+	r.Body = http.MaxBytesReader(w, r.Body, maxUsernamesBodyBytes)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		ctx.Logger.WithError(err).Error("Failed to decode request body")
 		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
@@ -163,6 +309,11 @@ func (rt *_router) handleStartConversation(w http.ResponseWriter, r *http.Reques
 		sendJSONError(w, "At least one recipient is required", http.StatusBadRequest)
 		return
 	}
+	if len(req.Recipients) > maxUsernamesPerRequest {
+		ctx.Logger.WithField("recipientsCount", len(req.Recipients)).Warn("Too many recipients")
+		sendJSONError(w, fmt.Sprintf("At most %d recipients are allowed", maxUsernamesPerRequest), http.StatusBadRequest)
+		return
+	}
 
 	// For group conversations, title is required
 	if req.IsGroup && req.Title == "" {
@@ -193,7 +344,9 @@ func (rt *_router) handleStartConversation(w http.ResponseWriter, r *http.Reques
 	_, err := rt.db.StartConversation(userID, recipientIDs, title, req.IsGroup)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to start conversation")
-		if strings.Contains(err.Error(), "participant with ID") {
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "Can't start a conversation with a blocked user")
+		} else if strings.Contains(err.Error(), "participant with ID") {
 			sendJSONError(w, fmt.Sprintf("Invalid participant: %v", err), http.StatusBadRequest)
 		} else {
 			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
@@ -202,7 +355,7 @@ func (rt *_router) handleStartConversation(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Reuse the GetUserConversations function to get the response
-	conversations, total, err := rt.db.GetUserConversations(userID)
+	conversations, total, err := rt.db.GetUserConversations(userID, database.ConversationFilter{})
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to get user conversations")
 		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
@@ -210,28 +363,7 @@ func (rt *_router) handleStartConversation(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Convert database.Conversation to ConversationResponse
-	conversationResponses := make([]ConversationResponse, len(conversations))
-	for i, conv := range conversations {
-		// Create the LastMessage struct with proper type conversion
-		lastMessage := struct {
-			Type      string `json:"type"`
-			Content   string `json:"content"`
-			Timestamp string `json:"timestamp"`
-		}{
-			Type:      conv.LastMessage.Type,
-			Content:   conv.LastMessage.Content,
-			Timestamp: conv.LastMessage.Timestamp.Format(time.RFC3339),
-		}
-
-		conversationResponses[i] = ConversationResponse{
-			ConversationID: conv.ID,
-			Title:          conv.Title,
-			CreatedAt:      conv.CreatedAt.Format(time.RFC3339),
-			ProfilePhotoID: conv.ProfilePhoto,
-			IsGroup:        conv.IsGroup,
-			LastMessage:    lastMessage,
-		}
-	}
+	conversationResponses := convertConversations(conversations)
 
 	// Use the converted response structure
 	response := struct {
@@ -259,7 +391,7 @@ func (rt *_router) handleSendMessage(w http.ResponseWriter, r *http.Request, ps
 	isParticipant, err := rt.db.IsUserInConversation(userID, conversationID)
 	if err != nil {
 		if errors.Is(err, database.ErrConversationNotFound) {
-			sendJSONError(w, "Conversation not found", http.StatusNotFound)
+			sendDatabaseError(w, err, "Conversation not found")
 			return
 		}
 		ctx.Logger.WithError(err).Error("Failed to check user participation in conversation")
@@ -274,7 +406,10 @@ func (rt *_router) handleSendMessage(w http.ResponseWriter, r *http.Request, ps
 	contentType := r.Header.Get("Content-Type")
 	var messageType, content, contentTypeValue string
 	var photo []byte
+	var duration int            // Length in seconds of audio messages, when the client tells it
 	var parentMessageID *string // Field for parent message ID (for replies)
+	var location *LocationResponse
+	var format string // Format of text messages
 
 	// Handle different content types according to API spec
 	if strings.HasPrefix(contentType, "application/json") {
@@ -283,6 +418,12 @@ func (rt *_router) handleSendMessage(w http.ResponseWriter, r *http.Request, ps
 			Type            string  `json:"type"`
 			Content         string  `json:"content"`
 			ParentMessageID *string `json:"parentMessageId,omitempty"` // Optional field for reply
+			// Format of text messages, "plain" when left out
+			Format string `json:"format,omitempty"`
+			// Coordinates and optional label of location messages
+			Latitude  *float64 `json:"latitude,omitempty"`
+			Longitude *float64 `json:"longitude,omitempty"`
+			Label     string   `json:"label,omitempty"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			ctx.Logger.WithError(err).Error("Failed to decode request body")
@@ -290,36 +431,67 @@ func (rt *_router) handleSendMessage(w http.ResponseWriter, r *http.Request, ps
 			return
 		}
 
-		if req.Type != "text" {
+		switch req.Type {
+		case "text":
+			if req.Content == "" {
+				sendJSONError(w, "Content is required", http.StatusBadRequest)
+				return
+			}
+
+			format = req.Format
+			if format == "" {
+				format = formatPlain
+			}
+			var ok bool
+			if contentTypeValue, ok = formatContentTypes[format]; !ok {
+				sendJSONError(w, "Format must be either plain or markdown", http.StatusBadRequest)
+				return
+			}
+
+			content = req.Content
+			if format == formatMarkdown {
+				content = sanitizeMarkdown(content)
+			}
+
+			// Check content length, after sanitizing as that can make it longer
+			if len(content) > 1000 {
+				sendJSONError(w, "Content exceeds maximum length of 1000 characters", http.StatusRequestEntityTooLarge)
+				return
+			}
+		case "location":
+			loc, err := newLocation(req.Latitude, req.Longitude, req.Label)
+			if err != nil {
+				sendJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// The location is stored as JSON in the content, so that forwarding and saving copy it as is
+			data, err := json.Marshal(loc)
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to encode location")
+				sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+				return
+			}
+			location = loc
+			content = string(data)
+			contentTypeValue = "application/json"
+		default:
 			sendJSONError(w, "Invalid message type for JSON content", http.StatusBadRequest)
 			return
 		}
 
-		if req.Content == "" {
-			sendJSONError(w, "Content is required", http.StatusBadRequest)
-			return
-		}
-
-		// Check content length
-		if len(req.Content) > 1000 {
-			sendJSONError(w, "Content exceeds maximum length of 1000 characters", http.StatusRequestEntityTooLarge)
-			return
-		}
-
 		messageType = req.Type
-		content = req.Content
-		contentTypeValue = "text/plain"
 		parentMessageID = req.ParentMessageID // Store the parent message ID
 	} else if strings.HasPrefix(contentType, "multipart/form-data") {
-		// Handle multipart form for photo messages
-		if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
+		// Handle multipart form for photo, audio and file messages
+		if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB in memory, larger files go to temporary files
 			ctx.Logger.WithError(err).Error("Failed to parse multipart form")
 			sendJSONError(w, "Failed to parse form data", http.StatusBadRequest)
 			return
 		}
 
 		formType := r.FormValue("type")
-		if formType != "photo" {
+		if formType != "photo" && formType != "audio" && formType != "file" {
 			sendJSONError(w, "Invalid message type for multipart content", http.StatusBadRequest)
 			return
 		}
@@ -330,47 +502,157 @@ func (rt *_router) handleSendMessage(w http.ResponseWriter, r *http.Request, ps
 			parentMessageID = &parentMsgValue
 		}
 
-		file, header, err := r.FormFile("photo")
-		if err != nil {
-			ctx.Logger.WithError(err).Error("Failed to get photo from form")
-			sendJSONError(w, "Photo is required", http.StatusBadRequest)
-			return
-		}
-		defer file.Close()
-
-		// Check file size (10MB max)
-		if header.Size > 10485760 {
-			sendJSONError(w, "Photo exceeds maximum size of 10MB", http.StatusRequestEntityTooLarge)
-			return
-		}
-
-		// Read the file
-		photo, err = io.ReadAll(file)
-		if err != nil {
-			ctx.Logger.WithError(err).Error("Failed to read photo data")
-			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
-			return
-		}
-
-		if len(photo) < 100 {
-			sendJSONError(w, "Photo is too small", http.StatusBadRequest)
-			return
-		}
-
-		// Detect content type
-		contentTypeValue = http.DetectContentType(photo)
-
-		// Store the photo in the media_files table
-		mediaID, err := rt.db.StoreMediaFile(photo, contentTypeValue)
-		if err != nil {
-			ctx.Logger.WithError(err).Error("Failed to store media file")
-			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
-			return
+		switch formType {
+		case "photo":
+			file, header, err := r.FormFile("photo")
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to get photo from form")
+				sendJSONError(w, "Photo is required", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+
+			// Check file size (10MB max)
+			if header.Size > 10485760 {
+				sendJSONError(w, "Photo exceeds maximum size of 10MB", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			// Read the file
+			photo, err = io.ReadAll(file)
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to read photo data")
+				sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+				return
+			}
+
+			if len(photo) < 100 {
+				sendJSONError(w, "Photo is too small", http.StatusBadRequest)
+				return
+			}
+
+			// Check that the photo is an image the clients can display
+			info, err := rt.validateImage(photo)
+			if err != nil {
+				ctx.Logger.WithError(err).Warn("Invalid photo")
+				sendImageError(w, err)
+				return
+			}
+			contentTypeValue = info.MimeType
+
+			// Store the photo in the media_files table
+			mediaID, thumbnailID, err := rt.db.StoreMediaFile(photo, contentTypeValue, "")
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to store media file")
+				sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+				return
+			}
+			ctx.Logger.WithFields(logrus.Fields{
+				"mediaID":     mediaID,
+				"thumbnailID": thumbnailID,
+				"width":       info.Width,
+				"height":      info.Height,
+			}).Debug("Stored media file")
+
+			messageType = "photo"
+			// Store the URL to the media in the content field
+			content = fmt.Sprintf("/media/%s", mediaID)
+
+		case "audio":
+			file, header, err := r.FormFile("audio")
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to get audio from form")
+				sendJSONError(w, "Audio is required", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+
+			if header.Size > maxAudioSize {
+				sendJSONError(w, "Audio exceeds maximum size of 10MB", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			audio, err := io.ReadAll(file)
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to read audio data")
+				sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+				return
+			}
+
+			// The format is told by the content, whatever the client declared
+			contentTypeValue = detectAudioType(audio)
+			if contentTypeValue == "" {
+				sendJSONError(w, "Unsupported media type. Only MP3, Ogg, and WAV audio is allowed", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			duration, err = parseAudioDuration(r.FormValue("duration"))
+			if err != nil {
+				sendJSONError(w, "Duration must be a positive number of seconds", http.StatusBadRequest)
+				return
+			}
+
+			mediaID, _, err := rt.db.StoreMediaFile(audio, contentTypeValue, "")
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to store media file")
+				sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+				return
+			}
+
+			messageType = "audio"
+			content = fmt.Sprintf("/media/%s", mediaID)
+
+		case "file":
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to get file from form")
+				sendJSONError(w, "File is required", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+
+			if header.Size > maxFileSize {
+				sendJSONError(w, "File exceeds maximum size of 25MB", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			// The original name is sent apart, as some clients can't set the name of the uploaded part
+			filename := r.FormValue("filename")
+			if filename == "" {
+				filename = header.Filename
+			}
+			filename, err = cleanFilename(filename)
+			if err != nil {
+				sendJSONError(w, "A valid filename is required", http.StatusBadRequest)
+				return
+			}
+			contentTypeValue = fileMimeType(filename)
+			if contentTypeValue == "" {
+				sendJSONError(w, "Unsupported file type", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			data, err := io.ReadAll(file)
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to read file data")
+				sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+				return
+			}
+			if len(data) == 0 {
+				sendJSONError(w, "File is empty", http.StatusBadRequest)
+				return
+			}
+
+			mediaID, _, err := rt.db.StoreMediaFile(data, contentTypeValue, filename)
+			if err != nil {
+				ctx.Logger.WithError(err).Error("Failed to store media file")
+				sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+				return
+			}
+
+			messageType = "file"
+			content = fmt.Sprintf("/media/%s", mediaID)
 		}
-
-		messageType = "photo"
-		// Store the URL to the media in the content field
-		content = fmt.Sprintf("/media/%s", mediaID)
 	} else {
 		sendJSONError(w, "Unsupported content type", http.StatusUnsupportedMediaType)
 		return
@@ -392,13 +674,38 @@ func (rt *_router) handleSendMessage(w http.ResponseWriter, r *http.Request, ps
 	}
 
 	// Add the message to the database with content type and parent message ID
-	messageID, err := rt.db.AddMessage(conversationID, userID, messageType, content, contentTypeValue, parentMessageID)
+	messageID, status, seq, err := rt.db.AddMessage(conversationID, userID, messageType, content, contentTypeValue, parentMessageID, duration)
 	if err != nil {
+		if errors.Is(err, database.ErrEmptyMessageContent) {
+			sendDatabaseError(w, err, "Message content cannot be empty")
+			return
+		}
+		if errors.Is(err, database.ErrSlowMode) {
+			sendDatabaseError(w, err, slowModeErrorMsg)
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "Can't send messages to a blocked user")
+			return
+		}
 		ctx.Logger.WithError(err).Error("Failed to add message")
 		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
 		return
 	}
 
+	// Mentions of users who aren't in the conversation are left as plain text. The message is already sent, so a
+	// failure to record the mentions is only logged
+	mentions := []MentionResponse{}
+	if messageType == "text" {
+		mentionedUsers, err := rt.db.AddMentions(messageID, parseMentions(content))
+		if err != nil {
+			ctx.Logger.WithError(err).Warn("Failed to record mentions")
+		}
+		for _, user := range mentionedUsers {
+			mentions = append(mentions, MentionResponse{UserID: user.ID, Username: user.Name})
+		}
+	}
+
 	// Get the sender's name
 	senderName, err := rt.db.GetUserNameByID(userID)
 	if err != nil {
@@ -416,11 +723,16 @@ func (rt *_router) handleSendMessage(w http.ResponseWriter, r *http.Request, ps
 			Username string `json:"username"`
 			UserID   string `json:"userId"`
 		} `json:"sender"`
-		Content     string `json:"content"`
-		ContentType string `json:"contentType"`
-		Type        string `json:"type"`
-		Timestamp   string `json:"timestamp"`
-		Status      string `json:"status"`
+		Content     string            `json:"content"`
+		ContentType string            `json:"contentType"`
+		Type        string            `json:"type"`
+		Timestamp   string            `json:"timestamp"`
+		Status      string            `json:"status"`
+		Seq         int64             `json:"seq,omitempty"`
+		Duration    int               `json:"duration,omitempty"`
+		Location    *LocationResponse `json:"location,omitempty"`
+		Format      string            `json:"format,omitempty"`
+		Mentions    []MentionResponse `json:"mentions"`
 	}{
 		MessageID:       messageID,
 		ConversationID:  conversationID,
@@ -435,8 +747,13 @@ func (rt *_router) handleSendMessage(w http.ResponseWriter, r *http.Request, ps
 		Content:     content,
 		ContentType: contentTypeValue,
 		Type:        messageType,
-		Timestamp:   time.Now().Format(time.RFC3339),
-		Status:      "delivered", // Initial status is always "delivered"
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Status:      status, // "pending" while the message waits for approval in a moderated group
+		Seq:         seq,    // Clients order messages by seq, pending messages get one when they are approved
+		Duration:    duration,
+		Location:    location,
+		Format:      format,
+		Mentions:    mentions,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -446,6 +763,16 @@ func (rt *_router) handleSendMessage(w http.ResponseWriter, r *http.Request, ps
 		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
 		return
 	}
+	// Messages waiting for approval aren't delivered yet
+	if status != database.MessageStatusPending {
+		rt.publishToConversation(ctx, conversationID, eventNewMessage, response)
+	}
+
+	// The preview is fetched once the message is sent, clients get it from the link_preview event or when they next
+	// load the message
+	if messageType == "text" {
+		rt.previewLink(ctx, conversationID, messageID, content, status != database.MessageStatusPending)
+	}
 }
 
 // Updated request and response structures for message forwarding
@@ -469,6 +796,8 @@ type forwardMessageResponse struct {
 	Type               string `json:"type"`
 	OriginalTimestamp  string `json:"originalTimestamp"`
 	ForwardedTimestamp string `json:"forwardedTimestamp"`
+	Status             string `json:"status"`
+	Seq                int64  `json:"seq,omitempty"`
 }
 
 // Handles message forwarding
@@ -497,25 +826,26 @@ func (rt *_router) handleForwardMessage(w http.ResponseWriter, r *http.Request,
 	// Forward the message
 	forwardedMessage, err := rt.db.ForwardMessage(messageID, req.TargetConversationID, userID)
 	if err != nil {
-		var statusCode int
 		var errorMessage string
 
 		if errors.Is(err, database.ErrMessageNotFound) {
-			statusCode = http.StatusNotFound
 			errorMessage = "Original message not found"
 		} else if errors.Is(err, database.ErrConversationNotFound) {
-			statusCode = http.StatusNotFound
 			errorMessage = "Target conversation not found"
 		} else if errors.Is(err, database.ErrUnauthorized) {
-			statusCode = http.StatusForbidden
 			errorMessage = "No permission to forward"
+		} else if errors.Is(err, database.ErrForwardingDisabled) {
+			errorMessage = "Forwarding messages out of this conversation is disabled"
+		} else if errors.Is(err, database.ErrSlowMode) {
+			errorMessage = slowModeErrorMsg
 		} else {
-			statusCode = http.StatusInternalServerError
-			errorMessage = ErrInternalServerMsg
+			ctx.Logger.WithError(err).Error(ErrInternalServerMsg)
+			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+			return
 		}
 
 		ctx.Logger.WithError(err).Error(errorMessage)
-		sendJSONError(w, errorMessage, statusCode)
+		sendDatabaseError(w, err, errorMessage)
 		return
 	}
 
@@ -550,6 +880,8 @@ func (rt *_router) handleForwardMessage(w http.ResponseWriter, r *http.Request,
 		Type:               forwardedMessage.Type,
 		OriginalTimestamp:  forwardedMessage.OriginalTimestamp.Format(time.RFC3339),
 		ForwardedTimestamp: forwardedMessage.Timestamp.Format(time.RFC3339),
+		Status:             forwardedMessage.Status,
+		Seq:                forwardedMessage.Seq,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -559,6 +891,23 @@ func (rt *_router) handleForwardMessage(w http.ResponseWriter, r *http.Request,
 		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
 		return
 	}
+	// Like sent messages, forwarded messages waiting for approval aren't delivered yet
+	if forwardedMessage.Status != database.MessageStatusPending {
+		rt.publishToConversation(ctx, req.TargetConversationID, eventNewMessage, response)
+	}
+}
+
+// allowReaction applies the reaction rate limit of the user, replying with 429 Too Many Requests when it is exceeded
+func (rt *_router) allowReaction(w http.ResponseWriter, ctx reqcontext.RequestContext, userID string) bool {
+	allowed, retryAfter := rt.reactionLimiter.Allow(userID)
+	if allowed {
+		return true
+	}
+
+	ctx.Logger.WithField("userID", userID).Warn("Reaction rate limit exceeded")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	sendJSONError(w, reactionRateErrorMsg, http.StatusTooManyRequests)
+	return false
 }
 
 // Handler for adding emoji reactions to messages
@@ -570,6 +919,10 @@ func (rt *_router) handleAddComment(w http.ResponseWriter, r *http.Request, ps h
 		"userID":    userID,
 	}).Info("Attempting to add emoji reaction to message")
 
+	if !rt.allowReaction(w, ctx, userID) {
+		return
+	}
+
 	var req struct {
 		Content string `json:"content"`
 	}
@@ -593,7 +946,7 @@ func (rt *_router) handleAddComment(w http.ResponseWriter, r *http.Request, ps h
 	}
 
 	// Add the emoji reaction
-	comment, err := rt.db.AddComment(messageID, userID, req.Content)
+	comment, err := rt.db.AddComment(messageID, userID, req.Content, !rt.disallowSelfReactions)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to add emoji reaction")
 
@@ -601,7 +954,13 @@ func (rt *_router) handleAddComment(w http.ResponseWriter, r *http.Request, ps h
 			sendJSONError(w, "Unauthorized to add reaction to this message", http.StatusUnauthorized)
 			return
 		} else if errors.Is(err, database.ErrMessageNotFound) {
-			sendJSONError(w, "Message not found", http.StatusNotFound)
+			sendDatabaseError(w, err, "Message not found")
+			return
+		} else if errors.Is(err, database.ErrReactionNotAllowed) {
+			sendDatabaseError(w, err, "This emoji is not allowed as a reaction in this conversation")
+			return
+		} else if errors.Is(err, database.ErrSelfReaction) {
+			sendDatabaseError(w, err, "You can't react to your own messages")
 			return
 		} else {
 			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
@@ -655,39 +1014,7 @@ func (rt *_router) handleAddComment(w http.ResponseWriter, r *http.Request, ps h
 		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
 		return
 	}
-}
-
-// isValidEmoji checks if the provided string is a valid emoji
-func isValidEmoji(s string) bool {
-	// Simple validation for common emoji patterns
-
-	// Check if the string is too long to be an emoji
-	if utf8.RuneCountInString(s) > 8 {
-		return false
-	}
-
-	// Check if the string contains any ASCII characters (which are not emojis)
-	for _, r := range s {
-		if r < 128 && !unicode.IsSpace(r) {
-			return false
-		}
-	}
-
-	// Check if the string contains at least one emoji-like character
-	hasEmojiChar := false
-	for _, r := range s {
-		// Emoji ranges (this is a simplified check)
-		if (r >= 0x1F300 && r <= 0x1F6FF) || // Miscellaneous Symbols and Pictographs
-			(r >= 0x2600 && r <= 0x26FF) || // Miscellaneous Symbols
-			(r >= 0x2700 && r <= 0x27BF) || // Dingbats
-			(r >= 0x1F900 && r <= 0x1F9FF) || // Supplemental Symbols and Pictographs
-			(r >= 0x1FA70 && r <= 0x1FAFF) { // Symbols and Pictographs Extended-A
-			hasEmojiChar = true
-			break
-		}
-	}
-
-	return hasEmojiChar
+	rt.publishToMessageConversation(ctx, comment.MessageID, eventReaction, response)
 }
 
 // Handles the request to remove an emoji reaction from a message
@@ -701,30 +1028,26 @@ func (rt *_router) handleDeleteComment(w http.ResponseWriter, r *http.Request, p
 		"userID":    userID,
 	}).Info("Attempting to delete emoji reaction")
 
+	if !rt.allowReaction(w, ctx, userID) {
+		return
+	}
+
 	err := rt.db.DeleteComment(messageID, commentID, userID)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to delete emoji reaction")
-		w.Header().Set("Content-Type", "application/json")
 
-		var statusCode int
 		var errorMessage string
 
 		if errors.Is(err, database.ErrMessageNotFound) {
-			statusCode = http.StatusNotFound
 			errorMessage = "Item not found"
 		} else if errors.Is(err, database.ErrUnauthorized) {
-			statusCode = http.StatusForbidden
 			errorMessage = "No permission to remove"
 		} else {
-			statusCode = http.StatusInternalServerError
-			errorMessage = ErrInternalServerMsg
+			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+			return
 		}
 
-		w.WriteHeader(statusCode)
-		if encodeErr := json.NewEncoder(w).Encode(map[string]string{"error": errorMessage}); encodeErr != nil {
-			ctx.Logger.WithError(encodeErr).Error("Failed to encode error response")
-			http.Error(w, "Error encoding response", http.StatusInternalServerError)
-		}
+		sendDatabaseError(w, err, errorMessage)
 		return
 	}
 
@@ -732,17 +1055,12 @@ func (rt *_router) handleDeleteComment(w http.ResponseWriter, r *http.Request, p
 	username, err := rt.db.GetUserNameByID(userID)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to get username")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		if encodeErr := json.NewEncoder(w).Encode(map[string]string{"error": ErrInternalServerMsg}); encodeErr != nil {
-			ctx.Logger.WithError(encodeErr).Error("Failed to encode error response")
-			http.Error(w, "Error encoding response", http.StatusInternalServerError)
-		}
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
 		return
 	}
 
 	// Get current time for removedAt field
-	removedAt := time.Now().Format(time.RFC3339)
+	removedAt := time.Now().UTC().Format(time.RFC3339)
 
 	ctx.Logger.WithFields(logrus.Fields{
 		"messageID": messageID,
@@ -780,6 +1098,7 @@ func (rt *_router) handleDeleteComment(w http.ResponseWriter, r *http.Request, p
 		ctx.Logger.WithError(encodeErr).Error("Failed to encode success response")
 		http.Error(w, "Error encoding response", http.StatusInternalServerError)
 	}
+	rt.publishToMessageConversation(ctx, messageID, eventReactionRemoved, response)
 }
 
 // Handles status updates
@@ -820,21 +1139,18 @@ func (rt *_router) handleUpdateMessageStatus(w http.ResponseWriter, r *http.Requ
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to update message status")
 
-		var statusCode int
 		var errorMessage string
 
 		if errors.Is(err, database.ErrMessageNotFound) {
-			statusCode = http.StatusNotFound
 			errorMessage = "Message not found"
 		} else if errors.Is(err, database.ErrUnauthorized) {
-			statusCode = http.StatusForbidden
 			errorMessage = "Not permitted"
 		} else {
-			statusCode = http.StatusInternalServerError
-			errorMessage = ErrInternalServerMsg
+			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+			return
 		}
 
-		sendJSONError(w, errorMessage, statusCode)
+		sendDatabaseError(w, err, errorMessage)
 		return
 	}
 
@@ -868,6 +1184,177 @@ func (rt *_router) handleUpdateMessageStatus(w http.ResponseWriter, r *http.Requ
 		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
 		return
 	}
+	rt.publishToConversation(ctx, statusUpdate.ConversationID, eventStatusChange, response)
+}
+
+// Handles removing a one-on-one conversation from the user's list, the other participant keeps it until they remove
+// it too
+func (rt *_router) handleDeleteConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+	}).Info("Handling delete conversation request")
+
+	fullyDeleted, err := rt.db.DeleteConversationForUser(userID, conversationID)
+	if err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "User is not a participant in this conversation")
+			return
+		}
+		if errors.Is(err, database.ErrGroupConversation) {
+			sendDatabaseError(w, err, "Groups can't be deleted, leave the group instead")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to delete conversation")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	// Event streams of the conversation end with it
+	rt.events.disconnect(userID, conversationID)
+
+	response := struct {
+		ConversationID string `json:"conversationId"`
+		FullyDeleted   bool   `json:"fullyDeleted"`
+	}{
+		ConversationID: conversationID,
+		FullyDeleted:   fullyDeleted,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles marking all the messages of a conversation as read at once, instead of one status update per message
+func (rt *_router) handleMarkConversationRead(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+	}).Info("Handling mark conversation read request")
+
+	marked, err := rt.db.MarkConversationRead(conversationID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "User is not a participant in this conversation")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to mark conversation as read")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		ConversationID string `json:"conversationId"`
+		UserID         string `json:"userId"`
+		MarkedCount    int    `json:"markedCount"`
+		ReadAt         string `json:"readAt"`
+	}{
+		ConversationID: conversationID,
+		UserID:         userID,
+		MarkedCount:    marked,
+		ReadAt:         time.Now().UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+	if marked > 0 {
+		rt.publishToConversation(ctx, conversationID, eventConversationRead, response)
+	}
+}
+
+// Handles the sender of a message getting its delivery and read state for each recipient. Recipients who haven't
+// reported the message are listed as "sent"
+func (rt *_router) handleGetMessageStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": ps.ByName("messageId"),
+		"userID":    userID,
+	}).Info("Handling get message status request")
+
+	rt.sendMessageReceipts(w, ps.ByName("messageId"), userID, ctx, database.ReceiptsView{}, "Only the sender can see the message status")
+}
+
+// Handles any participant getting the delivery and read state of a message for each recipient. A message reaches the
+// recipients as soon as it's sent, so those who haven't reported it are listed as "delivered"
+func (rt *_router) handleGetMessageReceipts(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": ps.ByName("messageId"),
+		"userID":    userID,
+	}).Info("Handling get message receipts request")
+
+	view := database.ReceiptsView{AnyParticipant: true, Unreported: "delivered"}
+	rt.sendMessageReceipts(w, ps.ByName("messageId"), userID, ctx, view, "You are not a participant of this conversation")
+}
+
+// sendMessageReceipts responds with the receipts of a message as seen through the view, or with forbiddenMessage when
+// the user can't see them
+func (rt *_router) sendMessageReceipts(w http.ResponseWriter, messageID, userID string, ctx reqcontext.RequestContext, view database.ReceiptsView, forbiddenMessage string) {
+	receipts, err := rt.db.GetMessageReceipts(messageID, userID, view)
+	if err != nil {
+		if errors.Is(err, database.ErrMessageNotFound) {
+			sendDatabaseError(w, err, "Message not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, forbiddenMessage)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get message receipts")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type recipientStatus struct {
+		Username  string  `json:"username"`
+		UserID    string  `json:"userId"`
+		Status    string  `json:"status"`
+		UpdatedAt *string `json:"updatedAt"`
+	}
+
+	counts := map[string]int{"sent": 0, "delivered": 0, "read": 0}
+	recipients := make([]recipientStatus, len(receipts))
+	for i, receipt := range receipts {
+		recipients[i] = recipientStatus{
+			Username: receipt.User.Name,
+			UserID:   receipt.User.ID,
+			Status:   receipt.Status,
+		}
+		if receipt.UpdatedAt != nil {
+			formatted := receipt.UpdatedAt.Format(time.RFC3339)
+			recipients[i].UpdatedAt = &formatted
+		}
+		counts[receipt.Status]++
+	}
+
+	response := struct {
+		MessageID  string            `json:"messageId"`
+		Counts     map[string]int    `json:"counts"`
+		Recipients []recipientStatus `json:"recipients"`
+	}{
+		MessageID:  messageID,
+		Counts:     counts,
+		Recipients: recipients,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
 }
 
 // Handles message deletion
@@ -882,22 +1369,19 @@ func (rt *_router) handleDeleteMessage(w http.ResponseWriter, r *http.Request, p
 	// Delete the message
 	deletedMessage, conversationID, err := rt.db.DeleteMessage(messageID, userID)
 	if err != nil {
-		var statusCode int
 		var errorMessage string
 
 		if errors.Is(err, database.ErrMessageNotFound) {
-			statusCode = http.StatusNotFound
 			errorMessage = "Message not found"
 		} else if errors.Is(err, database.ErrUnauthorized) {
-			statusCode = http.StatusForbidden
 			errorMessage = "No permission to delete"
 		} else {
-			statusCode = http.StatusInternalServerError
-			errorMessage = ErrInternalServerMsg
 			ctx.Logger.WithError(err).Error("Failed to delete message")
+			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+			return
 		}
 
-		sendJSONError(w, errorMessage, statusCode)
+		sendDatabaseError(w, err, errorMessage)
 		return
 	}
 
@@ -927,7 +1411,7 @@ func (rt *_router) handleDeleteMessage(w http.ResponseWriter, r *http.Request, p
 			Username: username,
 			UserID:   userID,
 		},
-		DeletedAt:      time.Now().Format(time.RFC3339),
+		DeletedAt:      deletedMessage.DeletedAt.Format(time.RFC3339),
 		ConversationID: conversationID,
 	}
 
@@ -940,30 +1424,139 @@ func (rt *_router) handleDeleteMessage(w http.ResponseWriter, r *http.Request, p
 	}
 }
 
-// Convert database messages to response format
-func convertMessages(dbMessages []database.Message) []MessageResponse {
-	messages := make([]MessageResponse, len(dbMessages))
-	for i, m := range dbMessages {
-		messages[i] = MessageResponse{
-			MessageID: m.ID,
+// handleGetMessagePath handles GET requests to /messages/{messageId}. httprouter can't register /messages/search next
+// to the messageId wildcard, so "search" is dispatched here (message IDs always start with "msg")
+func (rt *_router) handleGetMessagePath(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	if ps.ByName("messageId") == "search" {
+		rt.handleSearchAllMessages(w, r, ps, ctx, userID)
+		return
+	}
+	rt.handleGetMessage(w, r, ps, ctx, userID)
+}
+
+// Handles getting a single message, e.g. the whole parent of a reply whose quote was shortened
+func (rt *_router) handleGetMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"userID":    userID,
+	}).Info("Handling get message request")
+
+	// Messages the user can't see are reported as missing
+	isAuthorized, err := rt.db.IsUserAuthorized(userID, messageID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to check authorization")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	if !isAuthorized {
+		sendJSONError(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	message, err := rt.db.GetMessageByID(messageID)
+	if err != nil {
+		if errors.Is(err, database.ErrMessageNotFound) {
+			sendDatabaseError(w, err, "Message not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get message")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rt.convertMessage(*message, userID)); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Convert a database message to response format, as seen by the viewer
+func (rt *_router) convertMessage(m database.Message, viewerID string) MessageResponse {
+	message := MessageResponse{
+		MessageID: m.ID,
+		Seq:       m.Seq,
+		Sender: SenderResponse{
+			Username: m.Sender,
+			UserID:   m.SenderID,
+		},
+		Type:            m.Type,
+		Content:         m.Content,
+		Timestamp:       m.Timestamp.Format(time.RFC3339),
+		Status:          m.Status,
+		Reactions:       convertReactions(m.Comments),
+		ReactionSummary: summarizeReactions(m.Comments, viewerID),
+		MyReactions:     viewerReactions(m.Comments, viewerID),
+		IsForwarded:     m.IsForwarded,
+		Duration:        m.Duration,
+		LinkPreview:     newLinkPreviewResponse(m.LinkPreview),
+	}
+
+	if m.Type == database.MessageTypeDeleted {
+		message.Content = deletedMessagePlaceholder
+		message.DeletedAt = m.DeletedAt.Format(time.RFC3339)
+	}
+	if m.Type == "location" {
+		message.Location = parseLocation(m.Content)
+	}
+	if m.Type == "text" {
+		message.Format = messageFormat(m.ContentType)
+	}
+	if m.IsForwarded && m.OriginalSender != nil {
+		message.OriginalSender = &SenderResponse{
+			Username: m.OriginalSender.Name,
+			UserID:   m.OriginalSender.ID,
+		}
+		message.OriginalTimestamp = m.OriginalTimestamp.Format(time.RFC3339)
+	}
+	if !m.ExpiresAt.IsZero() {
+		message.ExpiresAt = m.ExpiresAt.Format(time.RFC3339)
+	}
+
+	// Replies to a deleted message are shown as standalone messages, without a parent
+	if m.Parent != nil && m.Parent.Type == database.MessageTypeDeleted {
+		return message
+	}
+
+	// Add parent message ID if present
+	if m.ParentMessageID != nil {
+		message.ParentMessageID = *m.ParentMessageID
+	}
+
+	// Replies carry a shortened copy of the parent, the whole parent is available from GET /messages/:messageId
+	if m.Parent != nil {
+		content, truncated := truncateRunes(m.Parent.Content, rt.quotePreviewLength)
+		message.ParentPreview = &QuotePreviewResponse{
+			MessageID: m.Parent.ID,
 			Sender: SenderResponse{
-				Username: m.Sender,
-				UserID:   m.SenderID,
+				Username: m.Parent.Sender,
+				UserID:   m.Parent.SenderID,
 			},
-			Type:        m.Type,
-			Content:     m.Content,
-			Timestamp:   m.Timestamp.Format(time.RFC3339),
-			Status:      m.Status,
-			Reactions:   convertReactions(m.Comments),
-			IsForwarded: m.IsForwarded,
+			Type:      m.Parent.Type,
+			Content:   content,
+			Truncated: truncated,
 		}
+	}
+	return message
+}
 
-		// Add parent message ID if present
-		if m.ParentMessageID != nil {
-			messages[i].ParentMessageID = *m.ParentMessageID
-		}
+// truncateRunes shortens s to at most limit runes, ending it with an ellipsis when it was cut. It never splits a
+// multibyte character
+func truncateRunes(s string, limit int) (string, bool) {
+	if utf8.RuneCountInString(s) <= limit {
+		return s, false
 	}
-	return messages
+	if limit <= 1 {
+		return "…", true
+	}
+
+	cut := 0
+	for i := 0; i < limit-1; i++ {
+		_, size := utf8.DecodeRuneInString(s[cut:])
+		cut += size
+	}
+	return s[:cut] + "…", true
 }
 
 // Convert database comments to reaction responses
@@ -981,6 +1574,37 @@ func convertReactions(dbComments []database.Comment) []ReactionResponse {
 	return reactions
 }
 
+// Group database comments by emoji, counting them and listing who reacted
+func summarizeReactions(dbComments []database.Comment, viewerID string) []ReactionSummaryResponse {
+	var summary []ReactionSummaryResponse
+	index := make(map[string]int)
+	for _, c := range dbComments {
+		i, ok := index[c.Content]
+		if !ok {
+			i = len(summary)
+			index[c.Content] = i
+			summary = append(summary, ReactionSummaryResponse{Emoji: c.Content})
+		}
+		summary[i].Count++
+		summary[i].Usernames = append(summary[i].Usernames, c.Username)
+		if c.UserID == viewerID {
+			summary[i].ReactedByMe = true
+		}
+	}
+	return summary
+}
+
+// List the emoji the viewer reacted with
+func viewerReactions(dbComments []database.Comment, viewerID string) []string {
+	var emoji []string
+	for _, c := range dbComments {
+		if c.UserID == viewerID {
+			emoji = append(emoji, c.Content)
+		}
+	}
+	return emoji
+}
+
 // Convert database participants to response format
 func convertParticipants(dbParticipants []database.Participant) []ParticipantResponse {
 	participants := make([]ParticipantResponse, len(dbParticipants))
@@ -989,6 +1613,7 @@ func convertParticipants(dbParticipants []database.Participant) []ParticipantRes
 			Username:       p.Name,
 			UserID:         p.ID,
 			ProfilePhotoID: p.PhotoID,
+			Bio:            p.Bio,
 		}
 	}
 	return participants
@@ -1005,12 +1630,49 @@ func (rt *_router) handleGetConversationDetails(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	conversation, err := rt.db.GetConversationDetails(conversationID, userID)
+	// Messages are paged when any of limit, offset or before is given, otherwise they are all returned
+	query := r.URL.Query()
+	paged := query.Get("limit") != "" || query.Get("offset") != "" || query.Get("before") != ""
+	var page database.MessagePage
+	if paged {
+		var err error
+		page.Limit, page.Offset, err = parsePagination(query, 50, 200)
+		if err != nil {
+			sendJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if value := query.Get("before"); value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				sendJSONError(w, "Before must be an RFC3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			page.Before = &parsed
+		}
+	}
+
+	// Clients coming back to a conversation can get only the messages after their read cursor
+	switch query.Get("unreadOnly") {
+	case "", "false":
+	case "true":
+		page.UnreadOnly = true
+	default:
+		sendJSONError(w, "unreadOnly must be either 'true' or 'false'", http.StatusBadRequest)
+		return
+	}
+
+	var conversation *database.ConversationDetails
+	var err error
+	if paged || page.UnreadOnly {
+		conversation, err = rt.db.GetConversationDetails(conversationID, userID, page)
+	} else {
+		conversation, err = rt.db.GetConversationInfo(conversationID, userID)
+	}
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to get conversation details")
 
 		if errors.Is(err, database.ErrConversationNotFound) {
-			sendJSONError(w, "Conversation not found", http.StatusNotFound)
+			sendDatabaseError(w, err, "Conversation not found")
 			return
 		}
 
@@ -1018,25 +1680,64 @@ func (rt *_router) handleGetConversationDetails(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	// Groups without a title get one derived from their participants
+	title := conversation.Title
+	if conversation.IsGroup && strings.TrimSpace(title) == "" {
+		title = defaultGroupTitle(conversation.Participants, userID)
+	}
+
 	// Create the response according to the API documentation
 	response := ConversationDetailsResponse{
 		ConversationID: conversation.ID,
-		Title:          conversation.Title,
+		Title:          title,
 		IsGroup:        conversation.IsGroup,
 		CreatedAt:      conversation.CreatedAt.Format(time.RFC3339),
 		Participants:   convertParticipants(conversation.Participants),
-		Messages:       convertMessages(conversation.Messages),
+		Theme:          conversation.Theme,
+		LastReadSeq:    conversation.LastReadSeq,
+
+		MessageTTLSeconds: conversation.MessageTTLSeconds,
 	}
 
 	// Add group photo ID if present and it's a group
 	if conversation.IsGroup && conversation.ProfilePhoto != "" {
 		response.GroupPhotoID = conversation.ProfilePhoto
 	}
+	if conversation.IsGroup {
+		settings := newGroupSettingsResponse(conversation.Settings)
+		response.Settings = &settings
+	}
 
+	if page.UnreadOnly {
+		unreadCount := conversation.UnreadCount
+		response.UnreadCount = &unreadCount
+		response.FirstUnreadMessageID = conversation.FirstUnreadMessageID
+	}
+	if paged {
+		hasMore := conversation.HasMoreMessages
+		response.HasMore = &hasMore
+		// The oldest timestamp keeps its full precision so it can be passed back as before to get the next page
+		if n := len(conversation.Messages); n > 0 {
+			response.OldestTimestamp = conversation.Messages[n-1].Timestamp.Format(time.RFC3339Nano)
+		}
+	}
+
+	// Stream the messages, newest first, so that long conversations aren't held in memory
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		ctx.Logger.WithError(err).Error("Failed to encode response")
-		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
-		return
+	err = streamJSONObject(w, response, "messages", func(messages *jsonArrayWriter) error {
+		if paged || page.UnreadOnly {
+			for _, m := range conversation.Messages {
+				if err := messages.Write(rt.convertMessage(m, userID)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return rt.db.ForEachMessage(conversationID, userID, false, func(m database.Message) error {
+			return messages.Write(rt.convertMessage(m, userID))
+		})
+	})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to stream response")
 	}
 }
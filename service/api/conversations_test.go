@@ -0,0 +1,530 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gerdalukosiute/WASAText/service/database"
+)
+
+func TestDefaultGroupTitle(t *testing.T) {
+	participant := func(id, name string) database.Participant {
+		return database.Participant{ID: id, Name: name}
+	}
+
+	tests := []struct {
+		name         string
+		participants []database.Participant
+		want         string
+	}{
+		{"alone", []database.Participant{participant("u1", "alice")}, "Group"},
+		{"one other", []database.Participant{participant("u1", "alice"), participant("u2", "bob")}, "Group with bob"},
+		{
+			"two others",
+			[]database.Participant{participant("u2", "bob"), participant("u1", "alice"), participant("u3", "carol")},
+			"Group with bob, carol",
+		},
+		{
+			"more others",
+			[]database.Participant{
+				participant("u2", "bob"), participant("u3", "carol"), participant("u4", "dave"),
+				participant("u1", "alice"), participant("u5", "erin"), participant("u6", "frank"),
+			},
+			"Group with bob, carol, +3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaultGroupTitle(tt.participants, "u1"); got != tt.want {
+				t.Errorf("defaultGroupTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertConversationsUntitledGroup(t *testing.T) {
+	conversations := []database.Conversation{
+		{ID: "g1", IsGroup: true, ParticipantCount: 5, OtherParticipantNames: []string{"bob", "carol"}},
+		{ID: "g2", Title: "  ", IsGroup: true, ParticipantCount: 2, OtherParticipantNames: []string{"bob"}},
+		{ID: "g3", Title: "Friends", IsGroup: true, ParticipantCount: 3},
+		{ID: "c1", Title: "bob", ParticipantCount: 2},
+	}
+	want := []string{"Group with bob, carol, +2", "Group with bob", "Friends", "bob"}
+
+	for i, conv := range convertConversations(conversations) {
+		if conv.Title != want[i] {
+			t.Errorf("title of %s = %q, want %q", conv.ConversationID, conv.Title, want[i])
+		}
+	}
+}
+
+// usernamesJSON returns a JSON array of count distinct usernames
+func usernamesJSON(count int) string {
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("user%d", i)
+	}
+	data, _ := json.Marshal(names)
+	return string(data)
+}
+
+func TestStartConversationUsernameLimits(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.newUser(t, "alice")
+	s.newUser(t, "bob")
+
+	w := s.serve(http.MethodPost, "/conversations", alice,
+		`{"recipients":`+usernamesJSON(maxUsernamesPerRequest+1)+`,"title":"Big","isGroup":true}`)
+	expectStatus(t, w, http.StatusBadRequest)
+	if !strings.Contains(w.Body.String(), "At most") {
+		t.Errorf("over-limit recipients rejected with %s", w.Body.String())
+	}
+
+	// A body over the size limit is rejected even with few recipients
+	w = s.serve(http.MethodPost, "/conversations", alice,
+		`{"recipients":["bob"],"title":"`+strings.Repeat("a", maxUsernamesBodyBytes)+`","isGroup":true}`)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	// The limit itself is accepted
+	for i := 0; i < maxUsernamesPerRequest; i++ {
+		s.newUser(t, fmt.Sprintf("user%d", i))
+	}
+	w = s.serve(http.MethodPost, "/conversations", alice,
+		`{"recipients":`+usernamesJSON(maxUsernamesPerRequest)+`,"title":"Big","isGroup":true}`)
+	expectStatus(t, w, http.StatusCreated)
+}
+
+func TestAddToGroupUsernameLimits(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.newUser(t, "alice")
+	bob := s.newUser(t, "bob")
+	groupID, err := s.db.StartConversation(alice, []string{bob}, "Group", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	w := s.serve(http.MethodPost, "/groups/"+groupID, alice, `{"usernames":`+usernamesJSON(maxUsernamesPerRequest+1)+`}`)
+	expectStatus(t, w, http.StatusBadRequest)
+	if !strings.Contains(w.Body.String(), "At most") {
+		t.Errorf("over-limit usernames rejected with %s", w.Body.String())
+	}
+
+	w = s.serve(http.MethodPost, "/groups/"+groupID, alice,
+		`{"usernames":["`+strings.Repeat("a", maxUsernamesBodyBytes)+`"]}`)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	for i := 0; i < maxUsernamesPerRequest; i++ {
+		s.newUser(t, fmt.Sprintf("user%d", i))
+	}
+	w = s.serve(http.MethodPost, "/groups/"+groupID, alice, `{"usernames":`+usernamesJSON(maxUsernamesPerRequest)+`}`)
+	expectStatus(t, w, http.StatusOK)
+	var result struct {
+		AddedUsers []json.RawMessage `json:"addedUsers"`
+	}
+	decodeJSON(t, w, &result)
+	if len(result.AddedUsers) != maxUsernamesPerRequest {
+		t.Errorf("%d users added, want %d", len(result.AddedUsers), maxUsernamesPerRequest)
+	}
+}
+
+func TestAddCommentRestrictedReactions(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.newUser(t, "alice")
+	bob := s.newUser(t, "bob")
+	groupID, err := s.db.StartConversation(alice, []string{bob}, "Poll", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	messageID, _, _, err := s.db.AddMessage(groupID, alice, "text", "Pizza tonight?", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	w := s.serve(http.MethodPut, "/groups/"+groupID+"/settings", alice, `{"allowedReactions":["👍","👎"]}`)
+	expectStatus(t, w, http.StatusOK)
+
+	w = s.serve(http.MethodPost, "/messages/"+messageID+"/comments", bob, `{"content":"👎"}`)
+	expectStatus(t, w, http.StatusCreated)
+
+	w = s.serve(http.MethodPost, "/messages/"+messageID+"/comments", bob, `{"content":"❤️"}`)
+	expectStatus(t, w, http.StatusBadRequest)
+	var response struct {
+		Code string `json:"code"`
+	}
+	decodeJSON(t, w, &response)
+	if response.Code != "REACTION_NOT_ALLOWED" {
+		t.Errorf("error code %q, want REACTION_NOT_ALLOWED", response.Code)
+	}
+}
+
+func TestConversationDetailsForwardedMessage(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.newUser(t, "alice")
+	bob := s.newUser(t, "bob")
+	carol := s.newUser(t, "carol")
+	source, err := s.db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	target, err := s.db.StartConversation(bob, []string{carol}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	messageID, _, _, err := s.db.AddMessage(source, alice, "text", "See you at noon", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	if _, _, _, err := s.db.AddMessage(target, bob, "text", "Hi Carol", "text/plain", nil, 0); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	if _, err := s.db.ForwardMessage(messageID, target, bob); err != nil {
+		t.Fatalf("ForwardMessage: %v", err)
+	}
+
+	w := s.serve(http.MethodGet, "/conversations/"+target, carol, "")
+	expectStatus(t, w, http.StatusOK)
+	var response struct {
+		Messages []MessageResponse `json:"messages"`
+	}
+	decodeJSON(t, w, &response)
+	if len(response.Messages) != 2 {
+		t.Fatalf("%d messages, want 2", len(response.Messages))
+	}
+	for _, m := range response.Messages {
+		switch m.Content {
+		case "See you at noon":
+			if !m.IsForwarded {
+				t.Error("forwarded message without isForwarded")
+			}
+			if m.Sender.UserID != bob {
+				t.Errorf("forwarded message sent by %s, want the forwarder %s", m.Sender.UserID, bob)
+			}
+			if m.OriginalSender == nil || m.OriginalSender.UserID != alice || m.OriginalSender.Username != "alice" {
+				t.Errorf("original sender %+v, want alice", m.OriginalSender)
+			}
+			if m.OriginalTimestamp == "" {
+				t.Error("forwarded message without originalTimestamp")
+			}
+		case "Hi Carol":
+			if m.IsForwarded || m.OriginalSender != nil {
+				t.Errorf("regular message reported as forwarded from %+v", m.OriginalSender)
+			}
+		default:
+			t.Errorf("unexpected message %q", m.Content)
+		}
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		limit         int
+		want          string
+		wantTruncated bool
+	}{
+		{"short", "hello", 10, "hello", false},
+		{"exact", "hello", 5, "hello", false},
+		{"ASCII", "hello world", 6, "hello…", true},
+		{"accents", "àèìòùàèìòù", 4, "àèì…", true},
+		{"CJK", "日本語のテキストです", 5, "日本語の…", true},
+		{"emoji", "👍👍👍👍👍", 3, "👍👍…", true},
+		{"multibyte at the limit", "ab日本", 4, "ab日本", false},
+		{"limit of one", "日本語", 1, "…", true},
+		{"empty", "", 3, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncateRunes(tt.input, tt.limit)
+			if got != tt.want || truncated != tt.wantTruncated {
+				t.Errorf("truncateRunes(%q, %d) = %q, %v, want %q, %v", tt.input, tt.limit, got, truncated, tt.want, tt.wantTruncated)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateRunes(%q, %d) split a character: %q", tt.input, tt.limit, got)
+			}
+		})
+	}
+}
+
+func TestQuotePreview(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.newUser(t, "alice")
+	bob := s.newUser(t, "bob")
+	conversationID, err := s.db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	long := strings.Repeat("ß日👍", 400)
+	parentID, _, _, err := s.db.AddMessage(conversationID, alice, "text", long, "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	replyID, _, _, err := s.db.AddMessage(conversationID, bob, "text", "agreed", "text/plain", &parentID, 0)
+	if err != nil {
+		t.Fatalf("adding the reply: %v", err)
+	}
+
+	w := s.serve(http.MethodGet, "/messages/"+replyID, bob, "")
+	expectStatus(t, w, http.StatusOK)
+	var reply MessageResponse
+	decodeJSON(t, w, &reply)
+	if reply.ParentPreview == nil {
+		t.Fatalf("reply without a parent preview: %s", w.Body.String())
+	}
+	preview := reply.ParentPreview
+	if !preview.Truncated || utf8.RuneCountInString(preview.Content) != s.rt.quotePreviewLength {
+		t.Errorf("preview of %d runes, truncated %v, want %d runes", utf8.RuneCountInString(preview.Content),
+			preview.Truncated, s.rt.quotePreviewLength)
+	}
+	if !strings.HasPrefix(long, strings.TrimSuffix(preview.Content, "…")) {
+		t.Errorf("preview %q isn't the start of the parent", preview.Content)
+	}
+
+	// The whole parent is still available
+	w = s.serve(http.MethodGet, "/messages/"+parentID, bob, "")
+	expectStatus(t, w, http.StatusOK)
+	var parent MessageResponse
+	decodeJSON(t, w, &parent)
+	if parent.Content != long {
+		t.Errorf("parent content of %d runes, want %d", utf8.RuneCountInString(parent.Content), utf8.RuneCountInString(long))
+	}
+
+	// Once the parent is deleted the reply stands alone
+	w = s.serve(http.MethodDelete, "/messages/"+parentID, alice, "")
+	if w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+		t.Fatalf("deleting the parent: status %d: %s", w.Code, w.Body.String())
+	}
+	w = s.serve(http.MethodGet, "/messages/"+replyID, bob, "")
+	expectStatus(t, w, http.StatusOK)
+	reply = MessageResponse{}
+	decodeJSON(t, w, &reply)
+	if reply.ParentMessageID != "" || reply.ParentPreview != nil {
+		t.Errorf("reply to a deleted message with parent %q and preview %+v", reply.ParentMessageID, reply.ParentPreview)
+	}
+}
+
+func TestForwardingDisabled(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.newUser(t, "alice")
+	bob := s.newUser(t, "bob")
+	groupID, err := s.db.StartConversation(alice, []string{bob}, "Private", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	target, err := s.db.StartConversation(bob, []string{alice}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	messageID, _, _, err := s.db.AddMessage(groupID, alice, "text", "Keep this between us", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	disabled := true
+	if _, err := s.db.UpdateGroupSettings(groupID, alice, database.GroupSettingsUpdate{ForwardingDisabled: &disabled}); err != nil {
+		t.Fatalf("disabling forwarding: %v", err)
+	}
+
+	if _, err := s.db.ForwardMessage(messageID, target, bob); !errors.Is(err, database.ErrForwardingDisabled) {
+		t.Errorf("ForwardMessage: got %v, want ErrForwardingDisabled", err)
+	}
+
+	// Saving the message is a forward into Saved Messages, it's blocked too
+	w := s.serve(http.MethodPost, "/messages/"+messageID+"/save", bob, "")
+	expectStatus(t, w, http.StatusForbidden)
+	var response struct {
+		Code string `json:"code"`
+	}
+	decodeJSON(t, w, &response)
+	if response.Code != "FORWARDING_DISABLED" {
+		t.Errorf("error code %q, want FORWARDING_DISABLED", response.Code)
+	}
+
+	// Once forwarding is enabled again both work
+	disabled = false
+	if _, err := s.db.UpdateGroupSettings(groupID, alice, database.GroupSettingsUpdate{ForwardingDisabled: &disabled}); err != nil {
+		t.Fatalf("enabling forwarding: %v", err)
+	}
+	if _, err := s.db.ForwardMessage(messageID, target, bob); err != nil {
+		t.Errorf("ForwardMessage once enabled: %v", err)
+	}
+	w = s.serve(http.MethodPost, "/messages/"+messageID+"/save", bob, "")
+	expectStatus(t, w, http.StatusCreated)
+}
+
+func TestAddCommentSelfReactionPolicy(t *testing.T) {
+	for _, disallow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("disallow=%v", disallow), func(t *testing.T) {
+			s := newTestServer(t)
+			s.rt.disallowSelfReactions = disallow
+			alice := s.newUser(t, "alice")
+			bob := s.newUser(t, "bob")
+			conversationID, err := s.db.StartConversation(alice, []string{bob}, "", false)
+			if err != nil {
+				t.Fatalf("StartConversation: %v", err)
+			}
+			own, _, _, err := s.db.AddMessage(conversationID, alice, "text", "Look at this", "text/plain", nil, 0)
+			if err != nil {
+				t.Fatalf("AddMessage: %v", err)
+			}
+			others, _, _, err := s.db.AddMessage(conversationID, bob, "text", "Nice", "text/plain", nil, 0)
+			if err != nil {
+				t.Fatalf("AddMessage: %v", err)
+			}
+
+			w := s.serve(http.MethodPost, "/messages/"+own+"/comments", alice, `{"content":"👍"}`)
+			if !disallow {
+				expectStatus(t, w, http.StatusCreated)
+			} else {
+				expectStatus(t, w, http.StatusBadRequest)
+				var response struct {
+					Code string `json:"code"`
+				}
+				decodeJSON(t, w, &response)
+				if response.Code != "SELF_REACTION" {
+					t.Errorf("error code %q, want SELF_REACTION", response.Code)
+				}
+			}
+
+			// Reacting to the messages of others is allowed either way
+			w = s.serve(http.MethodPost, "/messages/"+others+"/comments", alice, `{"content":"👍"}`)
+			expectStatus(t, w, http.StatusCreated)
+		})
+	}
+}
+
+func TestConvertMessageReactedByMe(t *testing.T) {
+	comment := func(userID, username, emoji string) database.Comment {
+		return database.Comment{ID: "int" + userID + emoji, UserID: userID, Username: username, Content: emoji}
+	}
+
+	tests := []struct {
+		name         string
+		comments     []database.Comment
+		wantByMe     map[string]bool
+		wantCounts   map[string]int
+		wantMine     []string
+		wantReaction int
+	}{
+		{
+			"caller reacting",
+			[]database.Comment{comment("u1", "alice", "👍")},
+			map[string]bool{"👍": true},
+			map[string]int{"👍": 1},
+			[]string{"👍"},
+			1,
+		},
+		{
+			"another user reacting",
+			[]database.Comment{comment("u2", "bob", "👍")},
+			map[string]bool{"👍": false},
+			map[string]int{"👍": 1},
+			nil,
+			1,
+		},
+		{
+			"both with the same emoji",
+			[]database.Comment{comment("u2", "bob", "🎉"), comment("u1", "alice", "🎉")},
+			map[string]bool{"🎉": true},
+			map[string]int{"🎉": 2},
+			[]string{"🎉"},
+			2,
+		},
+		{
+			"both with different emoji",
+			[]database.Comment{comment("u2", "bob", "😂"), comment("u1", "alice", "❤️"), comment("u1", "alice", "👍")},
+			map[string]bool{"😂": false, "❤️": true, "👍": true},
+			map[string]int{"😂": 1, "❤️": 1, "👍": 1},
+			[]string{"❤️", "👍"},
+			3,
+		},
+	}
+	rt := &_router{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := rt.convertMessage(database.Message{ID: "msg1", Type: "text", Comments: tt.comments}, "u1")
+
+			if len(message.Reactions) != tt.wantReaction {
+				t.Errorf("%d reactions, want %d", len(message.Reactions), tt.wantReaction)
+			}
+			if len(message.ReactionSummary) != len(tt.wantByMe) {
+				t.Fatalf("summary %+v, want %d emoji", message.ReactionSummary, len(tt.wantByMe))
+			}
+			for _, s := range message.ReactionSummary {
+				if s.ReactedByMe != tt.wantByMe[s.Emoji] {
+					t.Errorf("reactedByMe for %s = %v, want %v", s.Emoji, s.ReactedByMe, tt.wantByMe[s.Emoji])
+				}
+				if s.Count != tt.wantCounts[s.Emoji] || len(s.Usernames) != s.Count {
+					t.Errorf("%s counted %d with users %v, want %d", s.Emoji, s.Count, s.Usernames, tt.wantCounts[s.Emoji])
+				}
+			}
+			if fmt.Sprint(message.MyReactions) != fmt.Sprint(tt.wantMine) {
+				t.Errorf("myReactions = %v, want %v", message.MyReactions, tt.wantMine)
+			}
+		})
+	}
+}
+
+func TestMessageReceipts(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.newUser(t, "alice")
+	bob := s.newUser(t, "bob")
+	carol := s.newUser(t, "carol")
+	dave := s.newUser(t, "dave")
+	groupID, err := s.db.StartConversation(alice, []string{bob, carol}, "Trio", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	messageID, _, _, err := s.db.AddMessage(groupID, alice, "text", "Meeting at 5", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	if _, err := s.db.UpdateMessageStatus(messageID, bob, "read"); err != nil {
+		t.Fatalf("UpdateMessageStatus: %v", err)
+	}
+
+	type receipts struct {
+		Recipients []struct {
+			UserID    string  `json:"userId"`
+			Status    string  `json:"status"`
+			UpdatedAt *string `json:"updatedAt"`
+		} `json:"recipients"`
+	}
+	statuses := func(path, userID string) map[string]string {
+		t.Helper()
+		w := s.serve(http.MethodGet, path, userID, "")
+		expectStatus(t, w, http.StatusOK)
+		var response receipts
+		decodeJSON(t, w, &response)
+		got := make(map[string]string)
+		for _, r := range response.Recipients {
+			got[r.UserID] = r.Status
+			if (r.UpdatedAt != nil) != (r.UserID == bob) {
+				t.Errorf("%s: updatedAt %v for %s", path, r.UpdatedAt, r.UserID)
+			}
+		}
+		return got
+	}
+
+	// The status keeps listing the recipients who haven't reported the message as sent, for the sender only
+	got := statuses("/messages/"+messageID+"/status", alice)
+	if len(got) != 2 || got[bob] != "read" || got[carol] != "sent" {
+		t.Errorf("status seen by the sender = %v, want bob read and carol sent", got)
+	}
+	expectStatus(t, s.serve(http.MethodGet, "/messages/"+messageID+"/status", bob, ""), http.StatusForbidden)
+
+	// The receipts list them as delivered, for every participant
+	for _, userID := range []string{alice, bob, carol} {
+		got := statuses("/messages/"+messageID+"/receipts", userID)
+		if len(got) != 2 || got[bob] != "read" || got[carol] != "delivered" {
+			t.Errorf("receipts seen by %s = %v, want bob read and carol delivered", userID, got)
+		}
+	}
+	expectStatus(t, s.serve(http.MethodGet, "/messages/"+messageID+"/receipts", dave, ""), http.StatusForbidden)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"unicode/utf8"
+)
+
+// Code points that combine with others into a single emoji, see Unicode Technical Standard #51
+const (
+	zeroWidthJoiner       = 0x200D
+	variationSelector16   = 0xFE0F
+	combiningKeycap       = 0x20E3
+	skinToneModifierFirst = 0x1F3FB
+	skinToneModifierLast  = 0x1F3FF
+	regionalIndicatorA    = 0x1F1E6
+	regionalIndicatorZ    = 0x1F1FF
+	blackFlag             = 0x1F3F4
+	tagFirst              = 0xE0020
+	tagLast               = 0xE007E
+	cancelTag             = 0xE007F
+)
+
+// Reactions are a single emoji, longer strings are rejected before being parsed. The longest emoji in use, like
+// kissing couples with two skin tones, are around ten code points
+const maxEmojiRunes = 32
+
+// emojiRanges are the code points that can start an emoji or follow a zero width joiner. They are a superset of the
+// Emoji property of Unicode, which also covers a few symbols that aren't emoji, but no plain letters or digits
+var emojiRanges = [][2]rune{
+	{0x00A9, 0x00A9},   // ©
+	{0x00AE, 0x00AE},   // ®
+	{0x203C, 0x203C},   // ‼
+	{0x2049, 0x2049},   // ⁉
+	{0x2122, 0x2122},   // ™
+	{0x2139, 0x2139},   // ℹ
+	{0x2194, 0x21AA},   // Arrows
+	{0x231A, 0x23FF},   // Miscellaneous Technical, like ⌚ and ⏰
+	{0x24C2, 0x24C2},   // Ⓜ
+	{0x25AA, 0x25FE},   // Geometric Shapes
+	{0x2600, 0x27BF},   // Miscellaneous Symbols and Dingbats
+	{0x2934, 0x2935},   // ⤴ ⤵
+	{0x2B05, 0x2B55},   // Arrows and shapes like ⬆ and ⭐
+	{0x3030, 0x3030},   // 〰
+	{0x303D, 0x303D},   // 〽
+	{0x3297, 0x3299},   // ㊗ ㊙
+	{0x1F000, 0x1F1E5}, // Mahjong and playing cards, enclosed alphanumerics
+	{0x1F200, 0x1FAFF}, // Pictographs, emoticons, transport and symbols
+}
+
+func isEmojiBase(r rune) bool {
+	for _, rng := range emojiRanges {
+		if r >= rng[0] && r <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidEmoji checks that a string is exactly one emoji. Besides single pictographs it accepts flags made of two
+// regional indicators, keycaps like 1️⃣, tag sequences like the flag of Scotland, emoji with a variation selector or
+// a skin tone modifier, and sequences of these joined by zero width joiners like 👨‍👩‍👧. Text, including
+// whitespace and several emoji in a row, is rejected
+func isValidEmoji(s string) bool {
+	if s == "" || !utf8.ValidString(s) || utf8.RuneCountInString(s) > maxEmojiRunes {
+		return false
+	}
+	runes := []rune(s)
+
+	// A flag is a pair of regional indicators, which don't combine with anything else
+	if runes[0] >= regionalIndicatorA && runes[0] <= regionalIndicatorZ {
+		return len(runes) == 2 && runes[1] >= regionalIndicatorA && runes[1] <= regionalIndicatorZ
+	}
+
+	// A keycap is a digit, # or * followed by the combining keycap, with an optional variation selector in between
+	if r := runes[0]; (r >= '0' && r <= '9') || r == '#' || r == '*' {
+		rest := runes[1:]
+		if len(rest) > 0 && rest[0] == variationSelector16 {
+			rest = rest[1:]
+		}
+		return len(rest) == 1 && rest[0] == combiningKeycap
+	}
+
+	i := 0
+	for {
+		// Each element of a sequence is a pictograph, optionally followed by a variation selector or a skin tone
+		// modifier. Modifiers are emoji on their own too
+		if i >= len(runes) || !isEmojiBase(runes[i]) {
+			return false
+		}
+		base := runes[i]
+		i++
+		if i < len(runes) && (runes[i] == variationSelector16 || isSkinToneModifier(runes[i])) {
+			i++
+		}
+
+		// Subdivision flags are the black flag followed by tags, ended by the cancel tag
+		if base == blackFlag && i < len(runes) && runes[i] >= tagFirst && runes[i] <= tagLast {
+			for i < len(runes) && runes[i] >= tagFirst && runes[i] <= tagLast {
+				i++
+			}
+			if i >= len(runes) || runes[i] != cancelTag {
+				return false
+			}
+			i++
+		}
+
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner {
+			return false
+		}
+		i++
+	}
+}
+
+func isSkinToneModifier(r rune) bool {
+	return r >= skinToneModifierFirst && r <= skinToneModifierLast
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsValidEmoji(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{"thumbs up", "👍", true},
+		{"heart with variation selector", "❤️", true},
+		{"heart without variation selector", "❤", true},
+		{"thumbs up with skin tone", "👍🏽", true},
+		{"skin tone modifier alone", "🏿", true},
+		{"family", "👨‍👩‍👧", true},
+		{"family of four", "👨‍👩‍👧‍👦", true},
+		{"couple with heart and skin tones", "🧑🏻‍❤️‍🧑🏿", true},
+		{"woman technologist", "👩‍💻", true},
+		{"rainbow flag", "🏳️‍🌈", true},
+		{"flag of Italy", "🇮🇹", true},
+		{"flag of Scotland", "🏴󠁧󠁢󠁳󠁣󠁴󠁿", true},
+		{"keycap", "1️⃣", true},
+		{"keycap without variation selector", "#⃣", true},
+		{"copyright sign", "©", true},
+
+		{"empty", "", false},
+		{"letter", "a", false},
+		{"word", "hello", false},
+		{"digit", "7", false},
+		{"space", " ", false},
+		{"emoji with a trailing space", "👍 ", false},
+		{"emoji followed by text", "👍ok", false},
+		{"two emoji", "👍👍", false},
+		{"single regional indicator", "🇮", false},
+		{"three regional indicators", "🇮🇹🇮", false},
+		{"trailing zero width joiner", "👨\u200d", false},
+		{"leading zero width joiner", "\u200d👨", false},
+		{"joined letter", "👨\u200da", false},
+		{"variation selector alone", "\ufe0f", false},
+		{"unterminated tag sequence", "🏴\U000E0067\U000E0062", false},
+		{"invalid UTF-8", "\xff", false},
+		{"too long", strings.Repeat("👨\u200d", 20) + "👨", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isValidEmoji(tt.input); got != tt.want {
+				t.Errorf("isValidEmoji(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,90 @@
 package api
 
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gerdalukosiute/WASAText/service/database"
+)
+
 // Error message constants
 const (
 	ErrInternalServerMsg = "Internal server error"
+	slowModeErrorMsg     = "Slow mode is enabled, please wait before sending another message"
+	reactionRateErrorMsg = "Too many reactions, please slow down"
+	usernameRateErrorMsg = "Too many username checks, please slow down"
 )
+
+// Every error response carries a machine-readable code next to its message. Errors coming from the database get the
+// code of their sentinel, see databaseErrors, the others a generic one for their HTTP status
+const codeInternalError = "INTERNAL_ERROR"
+
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:                   "BAD_REQUEST",
+	http.StatusUnauthorized:                 "UNAUTHENTICATED",
+	http.StatusForbidden:                    "FORBIDDEN",
+	http.StatusNotFound:                     "NOT_FOUND",
+	http.StatusConflict:                     "CONFLICT",
+	http.StatusRequestEntityTooLarge:        "PAYLOAD_TOO_LARGE",
+	http.StatusUnsupportedMediaType:         "UNSUPPORTED_MEDIA_TYPE",
+	http.StatusRequestedRangeNotSatisfiable: "RANGE_NOT_SATISFIABLE",
+	http.StatusTooManyRequests:              "TOO_MANY_REQUESTS",
+	http.StatusInternalServerError:          codeInternalError,
+	http.StatusServiceUnavailable:           "SERVICE_UNAVAILABLE",
+}
+
+// databaseErrors maps the error sentinels of the database to the code and HTTP status of the response
+var databaseErrors = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{database.ErrUserNotFound, "USER_NOT_FOUND", http.StatusNotFound},
+	{database.ErrDuplicateUsername, "USERNAME_TAKEN", http.StatusBadRequest},
+	{database.ErrUnauthorized, "UNAUTHORIZED", http.StatusForbidden},
+	{database.ErrConversationNotFound, "CONVERSATION_NOT_FOUND", http.StatusNotFound},
+	{database.ErrMessageNotFound, "MESSAGE_NOT_FOUND", http.StatusNotFound},
+	{database.ErrGroupNotFound, "GROUP_NOT_FOUND", http.StatusNotFound},
+	{database.ErrInvalidGroupName, "INVALID_GROUP_NAME", http.StatusBadRequest},
+	{database.ErrUserAlreadyInGroup, "USER_ALREADY_IN_GROUP", http.StatusConflict},
+	{database.ErrInvalidNameLength, "INVALID_NAME_LENGTH", http.StatusBadRequest},
+	{database.ErrInvalidNameFormat, "INVALID_NAME_FORMAT", http.StatusBadRequest},
+	{database.ErrNameAlreadyTaken, "NAME_TAKEN", http.StatusConflict},
+	{database.ErrMediaNotFound, "MEDIA_NOT_FOUND", http.StatusNotFound},
+	{database.ErrEmptyMessageContent, "EMPTY_MESSAGE", http.StatusBadRequest},
+	{database.ErrMessageNotFlagged, "MESSAGE_NOT_FLAGGED", http.StatusNotFound},
+	{database.ErrSlowMode, "SLOW_MODE", http.StatusTooManyRequests},
+	{database.ErrForwardingDisabled, "FORWARDING_DISABLED", http.StatusForbidden},
+	{database.ErrMessageNotPending, "MESSAGE_NOT_PENDING", http.StatusConflict},
+	{database.ErrReactionNotAllowed, "REACTION_NOT_ALLOWED", http.StatusBadRequest},
+	{database.ErrSelfReaction, "SELF_REACTION", http.StatusBadRequest},
+	{database.ErrNoColdStore, "NO_COLD_STORE", http.StatusServiceUnavailable},
+	{database.ErrRemoveSelf, "REMOVE_SELF", http.StatusBadRequest},
+	{database.ErrBioTooLong, "BIO_TOO_LONG", http.StatusBadRequest},
+	{database.ErrUserNotBlocked, "USER_NOT_BLOCKED", http.StatusNotFound},
+	{database.ErrTooManyPinned, "TOO_MANY_PINNED", http.StatusConflict},
+	{database.ErrGroupConversation, "GROUP_CONVERSATION", http.StatusConflict},
+	{database.ErrInternalServer, codeInternalError, http.StatusInternalServerError},
+}
+
+// databaseErrorCode returns the code and HTTP status for an error returned by the database. Errors that aren't
+// sentinels are internal errors
+func databaseErrorCode(err error) (string, int) {
+	for _, e := range databaseErrors {
+		if errors.Is(err, e.err) {
+			return e.code, e.status
+		}
+	}
+	return codeInternalError, http.StatusInternalServerError
+}
+
+// statusErrorCode returns the generic code for an HTTP status
+func statusErrorCode(statusCode int) string {
+	if code, ok := statusErrorCodes[statusCode]; ok {
+		return code
+	}
+	if statusCode >= 500 {
+		return codeInternalError
+	}
+	return "BAD_REQUEST"
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+)
+
+// Types of the events pushed to the clients connected to /ws
+const (
+	eventNewMessage       = "new_message"
+	eventReaction         = "reaction"
+	eventReactionRemoved  = "reaction_removed"
+	eventStatusChange     = "status_change"
+	eventLinkPreview      = "link_preview"
+	eventConversationRead = "conversation_read"
+)
+
+// A subscriber more than subscriberBuffer events behind is dropped, it catches up by syncing once reconnected
+const subscriberBuffer = 64
+
+// event is the envelope of the events pushed over /ws. Payload is the same object the REST endpoint making the change
+// responds with
+type event struct {
+	Type           string      `json:"type"`
+	ConversationID string      `json:"conversationId"`
+	Payload        interface{} `json:"payload"`
+}
+
+// subscriber receives the events of a user over a WebSocket or an event stream, optionally only those of a single
+// conversation. done is closed when the subscriber is removed from the hub, closeCode tells WebSocket clients why
+type subscriber struct {
+	conversationID string
+	send           chan []byte
+	done           chan struct{}
+	closeCode      uint16
+}
+
+// eventHub keeps track of the subscribers of each user and pushes events to them. Events are published after the
+// change they describe has been committed, and publishing never blocks: subscribers too slow to keep up are dropped
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*subscriber]struct{}
+	closed      bool
+
+	// connections counts the subscribers whose connection hasn't been closed yet
+	connections sync.WaitGroup
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[string]map[*subscriber]struct{})}
+}
+
+// subscribe registers a subscriber to the events of a user, only those of the given conversation if conversationID is
+// set. It returns nil once the hub is closed. The caller has to call connections.Done once its connection is closed
+func (h *eventHub) subscribe(userID, conversationID string) *subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	sub := &subscriber{
+		conversationID: conversationID,
+		send:           make(chan []byte, subscriberBuffer),
+		done:           make(chan struct{}),
+		closeCode:      wsCloseNormal,
+	}
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[*subscriber]struct{})
+	}
+	h.subscribers[userID][sub] = struct{}{}
+	h.connections.Add(1)
+	return sub
+}
+
+// unsubscribe removes a subscriber, closing its done channel. Removing a subscriber twice is a no-op
+func (h *eventHub) unsubscribe(userID string, sub *subscriber, closeCode uint16) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(userID, sub, closeCode)
+}
+
+func (h *eventHub) removeLocked(userID string, sub *subscriber, closeCode uint16) {
+	if _, ok := h.subscribers[userID][sub]; !ok {
+		return
+	}
+	delete(h.subscribers[userID], sub)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+	sub.closeCode = closeCode
+	close(sub.done)
+}
+
+// disconnect removes the subscribers of a user to a conversation once they left it, or all the user's subscribers
+// when conversationID is empty
+func (h *eventHub) disconnect(userID, conversationID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers[userID] {
+		if conversationID == "" || sub.conversationID == conversationID {
+			h.removeLocked(userID, sub, wsCloseNormal)
+		}
+	}
+}
+
+// hasSubscribers reports whether anybody is subscribed, so that events nobody would receive aren't built
+func (h *eventHub) hasSubscribers() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers) > 0
+}
+
+// publish queues an event for the subscribers of the given users
+func (h *eventHub) publish(userIDs []string, e event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, userID := range userIDs {
+		for sub := range h.subscribers[userID] {
+			if sub.conversationID != "" && sub.conversationID != e.ConversationID {
+				continue
+			}
+			select {
+			case sub.send <- data:
+			default:
+				h.removeLocked(userID, sub, wsCloseGoingAway)
+			}
+		}
+	}
+	return nil
+}
+
+// close disconnects all the subscribers and stops accepting new ones. It returns once every subscriber's connection
+// has been closed
+func (h *eventHub) close() {
+	h.mu.Lock()
+	h.closed = true
+	for userID, subs := range h.subscribers {
+		for sub := range subs {
+			h.removeLocked(userID, sub, wsCloseGoingAway)
+		}
+	}
+	h.mu.Unlock()
+
+	h.connections.Wait()
+}
+
+// publishToConversation pushes an event to the connected participants of a conversation. The change the event
+// describes already succeeded, so failures are only logged
+func (rt *_router) publishToConversation(ctx reqcontext.RequestContext, conversationID, eventType string, payload interface{}) {
+	if !rt.events.hasSubscribers() {
+		return
+	}
+
+	participants, err := rt.db.GetConversationParticipants(conversationID)
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("Failed to get the participants to push an event to")
+		return
+	}
+	userIDs := make([]string, len(participants))
+	for i, p := range participants {
+		userIDs[i] = p.ID
+	}
+
+	err = rt.events.publish(userIDs, event{
+		Type:           eventType,
+		ConversationID: conversationID,
+		Payload:        payload,
+	})
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("Failed to publish event")
+	}
+}
+
+// publishToMessageConversation pushes an event about a message to the connected participants of its conversation
+func (rt *_router) publishToMessageConversation(ctx reqcontext.RequestContext, messageID, eventType string, payload interface{}) {
+	if !rt.events.hasSubscribers() {
+		return
+	}
+
+	conversationID, err := rt.db.GetMessageConversationID(messageID)
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("Failed to get the conversation to push an event to")
+		return
+	}
+	rt.publishToConversation(ctx, conversationID, eventType, payload)
+}
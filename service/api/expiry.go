@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Number of expired messages deleted per transaction by the message sweeper. The sweeper checks whether it has to stop
+// between batches
+const expiredMessageBatchSize = 100
+
+// Handles setting how long the messages of a conversation are kept before they disappear
+func (rt *_router) handleSetMessageTTL(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+
+	logger := ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+	})
+	logger.Info("Handling set message TTL request")
+
+	var req struct {
+		TTLSeconds *int `json:"ttlSeconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.TTLSeconds == nil {
+		sendJSONError(w, "ttlSeconds is required", http.StatusBadRequest)
+		return
+	}
+	ttl := time.Duration(*req.TTLSeconds) * time.Second
+	if *req.TTLSeconds != 0 && (ttl < database.MinMessageTTL || ttl > database.MaxMessageTTL) {
+		sendJSONError(w, fmt.Sprintf("ttlSeconds must be 0 or between %d and %d",
+			int(database.MinMessageTTL.Seconds()), int(database.MaxMessageTTL.Seconds())), http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.SetMessageTTL(conversationID, userID, ttl); err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "No permission to change the message expiration")
+			return
+		}
+		logger.WithError(err).Error("Failed to set message TTL")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		ConversationID string `json:"conversationId"`
+		TTLSeconds     int    `json:"ttlSeconds"`
+	}{
+		ConversationID: conversationID,
+		TTLSeconds:     *req.TTLSeconds,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// startMessageSweeper starts a background goroutine that deletes expired messages, once right away and then every
+// interval, until Close is called. Expired messages are hidden from the conversations before they are deleted, so the
+// interval only bounds how long they stay in the database
+func (rt *_router) startMessageSweeper(interval time.Duration) {
+	rt.stopSweeper = make(chan struct{})
+	rt.sweeperDone = make(chan struct{})
+
+	go func() {
+		defer close(rt.sweeperDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			rt.deleteExpiredMessages()
+
+			select {
+			case <-rt.stopSweeper:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// deleteExpiredMessages deletes all the messages that expired, a batch at a time
+func (rt *_router) deleteExpiredMessages() {
+	now := time.Now().UTC()
+
+	var deleted int
+batches:
+	for {
+		count, err := rt.db.DeleteExpiredMessages(now, expiredMessageBatchSize)
+		deleted += count
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("Failed to delete expired messages")
+			break
+		}
+		if count < expiredMessageBatchSize {
+			break
+		}
+
+		select {
+		case <-rt.stopSweeper:
+			break batches
+		default:
+		}
+	}
+
+	if deleted > 0 {
+		rt.baseLogger.WithField("count", deleted).Info("Deleted expired messages")
+	}
+}
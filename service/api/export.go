@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Handles exporting a conversation as a downloadable file
+func (rt *_router) handleExportConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+	}).Info("Handling export conversation request")
+
+	// Conversations are exported as JSON unless a text transcript is asked for
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "txt":
+	default:
+		sendJSONError(w, "Unsupported export format", http.StatusBadRequest)
+		return
+	}
+
+	// Only participants can export a conversation
+	conversation, err := rt.db.GetConversationInfo(conversationID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get conversation details")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	// Groups without a title get one derived from their participants
+	if conversation.IsGroup && strings.TrimSpace(conversation.Title) == "" {
+		conversation.Title = defaultGroupTitle(conversation.Participants, userID)
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"conversation-%s.json\"", conversationID))
+		w.WriteHeader(http.StatusOK)
+
+		if err := rt.writeJSONExport(w, conversation, userID); err != nil {
+			ctx.Logger.WithError(err).Error("Failed to write conversation export")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"conversation-%s.txt\"", conversationID))
+	w.WriteHeader(http.StatusOK)
+
+	if err := rt.writeTextTranscript(w, conversation, userID); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to write conversation transcript")
+	}
+}
+
+// writeJSONExport writes the conversation as seen by the user as a JSON document: its title, creation time and
+// participants, followed by all of its messages with their reactions in chronological order. Like the transcript,
+// the messages are streamed from the database
+func (rt *_router) writeJSONExport(w io.Writer, conversation *database.ConversationDetails, userID string) error {
+	head := struct {
+		ConversationID string                `json:"conversationId"`
+		Title          string                `json:"title"`
+		IsGroup        bool                  `json:"isGroup"`
+		CreatedAt      string                `json:"createdAt"`
+		ExportedAt     string                `json:"exportedAt"`
+		Participants   []ParticipantResponse `json:"participants"`
+	}{
+		ConversationID: conversation.ID,
+		Title:          conversation.Title,
+		IsGroup:        conversation.IsGroup,
+		CreatedAt:      conversation.CreatedAt.Format(time.RFC3339),
+		ExportedAt:     time.Now().UTC().Format(time.RFC3339),
+		Participants:   convertParticipants(conversation.Participants),
+	}
+
+	return streamJSONObject(w, head, "messages", func(messages *jsonArrayWriter) error {
+		return rt.db.ForEachMessage(conversation.ID, userID, true, func(m database.Message) error {
+			return messages.Write(rt.convertMessage(m, userID))
+		})
+	})
+}
+
+// writeTextTranscript writes a human-readable transcript of a conversation as seen by the user, one
+// "[timestamp] sender: content" line per message in chronological order. Media messages are rendered as their type
+// followed by the media URL. Messages are streamed from the database, so the transcript is never held in memory as a
+// whole
+func (rt *_router) writeTextTranscript(out io.Writer, conversation *database.ConversationDetails, userID string) error {
+	w := bufio.NewWriter(out)
+
+	if _, err := fmt.Fprintf(w, "Conversation: %s\nCreated: %s\n\n", conversation.Title, conversation.CreatedAt.Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	err := rt.db.ForEachMessage(conversation.ID, userID, true, func(m database.Message) error {
+		content := m.Content
+		if m.Type == database.MessageTypeDeleted {
+			content = deletedMessagePlaceholder
+		} else if m.Type != "text" {
+			content = fmt.Sprintf("[%s] %s", m.Type, m.Content)
+		}
+		if m.IsForwarded {
+			content = "(forwarded) " + content
+		}
+
+		_, err := fmt.Fprintf(w, "[%s] %s: %s\n", m.Timestamp.Format(time.RFC3339), m.Sender, content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// Handles exporting all the data of the user: their profile, the conversations they are in, the messages they sent
+// and the reactions they made. Messages and reactions are streamed, as they can be many
+func (rt *_router) handleExportUserData(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling export user data request")
+
+	user, err := rt.db.GetUserProfile(userID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			sendDatabaseError(w, err, "User not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get user profile")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	conversations, _, err := rt.db.GetUserConversations(userID, database.ConversationFilter{})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get user conversations")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	conversationResponses := convertConversations(conversations)
+
+	type profileInfo struct {
+		UserID         string `json:"userId"`
+		Username       string `json:"username"`
+		ProfilePhotoID string `json:"profilePhotoId,omitempty"`
+		Bio            string `json:"bio,omitempty"`
+		CreatedAt      string `json:"createdAt,omitempty"`
+	}
+	profile := profileInfo{
+		UserID:         user.ID,
+		Username:       user.Name,
+		ProfilePhotoID: user.PhotoID,
+		Bio:            user.Bio,
+	}
+	if user.CreatedAt != nil {
+		profile.CreatedAt = user.CreatedAt.Format(time.RFC3339)
+	}
+
+	head := struct {
+		ExportedAt    string                 `json:"exportedAt"`
+		Profile       profileInfo            `json:"profile"`
+		Conversations []ConversationResponse `json:"conversations"`
+	}{
+		ExportedAt:    time.Now().UTC().Format(time.RFC3339),
+		Profile:       profile,
+		Conversations: conversationResponses,
+	}
+
+	type sentMessage struct {
+		ConversationID string `json:"conversationId"`
+		MessageResponse
+	}
+	type reactionInfo struct {
+		InteractionID string `json:"interactionId"`
+		MessageID     string `json:"messageId"`
+		Content       string `json:"content"`
+		Timestamp     string `json:"timestamp"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"user-%s.json\"", userID))
+	w.WriteHeader(http.StatusOK)
+
+	err = streamJSONFields(w, head,
+		jsonArrayField{name: "messages", fill: func(messages *jsonArrayWriter) error {
+			return rt.db.ForEachSentMessage(userID, func(conversationID string, m database.Message) error {
+				return messages.Write(sentMessage{ConversationID: conversationID, MessageResponse: rt.convertMessage(m, userID)})
+			})
+		}},
+		jsonArrayField{name: "reactions", fill: func(reactions *jsonArrayWriter) error {
+			return rt.db.ForEachUserReaction(userID, func(c database.Comment) error {
+				return reactions.Write(reactionInfo{
+					InteractionID: c.ID,
+					MessageID:     c.MessageID,
+					Content:       c.Content,
+					Timestamp:     c.Timestamp.Format(time.RFC3339),
+				})
+			})
+		}},
+	)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to write user data export")
+	}
+}
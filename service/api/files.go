@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFileSize is the size limit of the files sent as file messages, larger than the one of photos as documents and
+// archives tend to be bigger
+const maxFileSize = 25 << 20
+
+// maxFilenameLength is the maximum length in bytes of the original name of an attached file
+const maxFilenameLength = 255
+
+// fileMimeTypes maps the extensions of the files that can be attached to a message to the mime type they are served
+// with. Files are always served as attachments, so the list is about what's useful to share rather than what's safe
+// to display
+var fileMimeTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".txt":  "text/plain",
+	".csv":  "text/csv",
+	".rtf":  "application/rtf",
+	".zip":  "application/zip",
+	".7z":   "application/x-7z-compressed",
+	".gz":   "application/gzip",
+	".tar":  "application/x-tar",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+}
+
+var errInvalidFilename = errors.New("invalid filename")
+
+// cleanFilename reduces the filename sent by a client to its base name and checks that it can be stored and sent back
+// in a Content-Disposition header
+func cleanFilename(name string) (string, error) {
+	// Clients may send a full path, with either separator
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSpace(name)
+
+	if name == "" || name == "." || name == ".." || len(name) > maxFilenameLength || !utf8.ValidString(name) {
+		return "", errInvalidFilename
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", errInvalidFilename
+		}
+	}
+	return name, nil
+}
+
+// fileMimeType returns the mime type of an attached file from its extension, or an empty string when files of this
+// type can't be attached
+func fileMimeType(filename string) string {
+	return fileMimeTypes[strings.ToLower(filepath.Ext(filename))]
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Handles flagging a message for follow-up, with an optional reminder time
+func (rt *_router) handleFlagMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"userID":    userID,
+	}).Info("Handling flag message request")
+
+	// The body is optional, a flag doesn't need a reminder
+	var req struct {
+		RemindAt *string `json:"remindAt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.Logger.WithError(err).Error("Failed to decode request body")
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var remindAt *time.Time
+	if req.RemindAt != nil {
+		parsed, err := time.Parse(time.RFC3339, *req.RemindAt)
+		if err != nil {
+			sendJSONError(w, "remindAt must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		if !parsed.After(time.Now()) {
+			sendJSONError(w, "remindAt must be in the future", http.StatusBadRequest)
+			return
+		}
+		remindAt = &parsed
+	}
+
+	if err := rt.db.FlagMessage(messageID, userID, remindAt); err != nil {
+		if errors.Is(err, database.ErrMessageNotFound) {
+			sendDatabaseError(w, err, "Message not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "No permission to flag this message")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to flag message")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		MessageID string  `json:"messageId"`
+		Flagged   bool    `json:"flagged"`
+		RemindAt  *string `json:"remindAt"`
+	}{
+		MessageID: messageID,
+		Flagged:   true,
+	}
+	if remindAt != nil {
+		formatted := remindAt.Format(time.RFC3339)
+		response.RemindAt = &formatted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles clearing the flag and reminder on a message
+func (rt *_router) handleUnflagMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"userID":    userID,
+	}).Info("Handling unflag message request")
+
+	if err := rt.db.UnflagMessage(messageID, userID); err != nil {
+		if errors.Is(err, database.ErrMessageNotFlagged) {
+			sendDatabaseError(w, err, "Message is not flagged")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to unflag message")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		MessageID string `json:"messageId"`
+		Flagged   bool   `json:"flagged"`
+	}{
+		MessageID: messageID,
+		Flagged:   false,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles listing the user's flagged messages, soonest reminder first. Reminders whose time has passed are marked
+// as due
+func (rt *_router) handleGetFlaggedMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling get flagged messages request")
+
+	messages, err := rt.db.GetFlaggedMessages(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get flagged messages")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type flaggedMessageInfo struct {
+		MessageID      string `json:"messageId"`
+		ConversationID string `json:"conversationId"`
+		Sender         struct {
+			Username string `json:"username"`
+			UserID   string `json:"userId"`
+		} `json:"sender"`
+		Type        string  `json:"type"`
+		Content     string  `json:"content"`
+		Timestamp   string  `json:"timestamp"`
+		FlaggedAt   string  `json:"flaggedAt"`
+		RemindAt    *string `json:"remindAt"`
+		ReminderDue bool    `json:"reminderDue"`
+	}
+
+	now := time.Now()
+	flaggedMessages := make([]flaggedMessageInfo, len(messages))
+	for i, message := range messages {
+		info := flaggedMessageInfo{
+			MessageID:      message.MessageID,
+			ConversationID: message.ConversationID,
+			Type:           message.Type,
+			Content:        message.Content,
+			Timestamp:      message.Timestamp.Format(time.RFC3339),
+			FlaggedAt:      message.FlaggedAt.Format(time.RFC3339),
+		}
+		info.Sender.Username = message.Sender
+		info.Sender.UserID = message.SenderID
+		if message.RemindAt != nil {
+			formatted := message.RemindAt.Format(time.RFC3339)
+			info.RemindAt = &formatted
+			info.ReminderDue = !message.RemindAt.After(now)
+		}
+		flaggedMessages[i] = info
+	}
+
+	response := struct {
+		Messages []flaggedMessageInfo `json:"messages"`
+		Total    int                  `json:"total"`
+	}{
+		Messages: flaggedMessages,
+		Total:    len(flaggedMessages),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Formats of text messages, telling clients how to render them. The format is stored as the content type of the
+// message
+const (
+	formatPlain    = "plain"
+	formatMarkdown = "markdown"
+)
+
+var formatContentTypes = map[string]string{
+	formatPlain:    "text/plain",
+	formatMarkdown: "text/markdown",
+}
+
+// messageFormat returns the format of a text message from its content type, messages sent before formats existed
+// are plain text
+func messageFormat(contentType string) string {
+	if contentType == formatContentTypes[formatMarkdown] {
+		return formatMarkdown
+	}
+	return formatPlain
+}
+
+// sanitizeMarkdown normalizes line endings, drops control characters and escapes "<" so that clients rendering the
+// markdown never render raw HTML. The result can be longer than the input
+func sanitizeMarkdown(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+
+	var b strings.Builder
+	for _, r := range content {
+		switch {
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '\n' || r == '\t':
+			b.WriteRune(r)
+		case unicode.IsControl(r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
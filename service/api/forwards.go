@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Maximum number of hops returned for a chain of forwards
+const maxForwardChainDepth = 50
+
+// forwardHopResponse is a hop of a chain of forwards. Consecutive hops the user can't access are summarized as a
+// single hidden entry with their count
+type forwardHopResponse struct {
+	MessageID      string          `json:"messageId,omitempty"`
+	ConversationID string          `json:"conversationId,omitempty"`
+	Sender         *SenderResponse `json:"sender,omitempty"`
+	Timestamp      string          `json:"timestamp,omitempty"`
+	IsForwarded    bool            `json:"isForwarded,omitempty"`
+	Hidden         bool            `json:"hidden,omitempty"`
+	HiddenCount    int             `json:"hiddenCount,omitempty"`
+}
+
+// Handles listing the chain of forwards that led to a message, starting from the original message
+func (rt *_router) handleGetForwardChain(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"userID":    userID,
+	}).Info("Handling get forward chain request")
+
+	chain, err := rt.db.GetForwardChain(messageID, userID, maxForwardChainDepth)
+	if err != nil {
+		if errors.Is(err, database.ErrMessageNotFound) {
+			sendDatabaseError(w, err, "Message not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "No permission to view this message")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get forward chain")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	hops := []forwardHopResponse{}
+	for _, hop := range chain.Hops {
+		if !hop.Accessible {
+			if len(hops) > 0 && hops[len(hops)-1].Hidden {
+				hops[len(hops)-1].HiddenCount++
+			} else {
+				hops = append(hops, forwardHopResponse{Hidden: true, HiddenCount: 1})
+			}
+			continue
+		}
+		hops = append(hops, forwardHopResponse{
+			MessageID:      hop.MessageID,
+			ConversationID: hop.ConversationID,
+			Sender: &SenderResponse{
+				Username: hop.Sender,
+				UserID:   hop.SenderID,
+			},
+			Timestamp:   hop.Timestamp.Format(time.RFC3339),
+			IsForwarded: hop.IsForwarded,
+		})
+	}
+
+	response := struct {
+		MessageID     string               `json:"messageId"`
+		Hops          []forwardHopResponse `json:"hops"`
+		Depth         int                  `json:"depth"`
+		SourceDeleted bool                 `json:"sourceDeleted"`
+		Truncated     bool                 `json:"truncated"`
+	}{
+		MessageID:     messageID,
+		Hops:          hops,
+		Depth:         len(chain.Hops),
+		SourceDeleted: chain.SourceDeleted,
+		Truncated:     chain.Truncated,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles listing the conversations a message was forwarded into, among the ones the user participates in
+func (rt *_router) handleGetForwardDestinations(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"userID":    userID,
+	}).Info("Handling get forward destinations request")
+
+	destinations, err := rt.db.GetForwardDestinations(messageID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrMessageNotFound) {
+			sendDatabaseError(w, err, "Message not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "No permission to view this message")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get forward destinations")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type forwardDestinationResponse struct {
+		ConversationID string         `json:"conversationId"`
+		IsGroup        bool           `json:"isGroup"`
+		MessageID      string         `json:"messageId"`
+		ForwardedBy    SenderResponse `json:"forwardedBy"`
+		Timestamp      string         `json:"timestamp"`
+	}
+
+	forwards := make([]forwardDestinationResponse, len(destinations))
+	for i, d := range destinations {
+		forwards[i] = forwardDestinationResponse{
+			ConversationID: d.ConversationID,
+			IsGroup:        d.IsGroup,
+			MessageID:      d.MessageID,
+			ForwardedBy: SenderResponse{
+				Username: d.Forwarder,
+				UserID:   d.ForwarderID,
+			},
+			Timestamp: d.Timestamp.Format(time.RFC3339),
+		}
+	}
+
+	response := struct {
+		MessageID string                       `json:"messageId"`
+		Forwards  []forwardDestinationResponse `json:"forwards"`
+		Total     int                          `json:"total"`
+	}{
+		MessageID: messageID,
+		Forwards:  forwards,
+		Total:     len(forwards),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
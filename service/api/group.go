@@ -28,6 +28,7 @@ func (rt *_router) handleAddToGroup(w http.ResponseWriter, r *http.Request, ps h
 	var req struct {
 		Usernames []string `json:"usernames"`
 	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUsernamesBodyBytes)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		ctx.Logger.WithError(err).Warn("Invalid request body")
 		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
@@ -40,6 +41,11 @@ func (rt *_router) handleAddToGroup(w http.ResponseWriter, r *http.Request, ps h
 		sendJSONError(w, "Usernames are required", http.StatusBadRequest)
 		return
 	}
+	if len(req.Usernames) > maxUsernamesPerRequest {
+		ctx.Logger.WithField("usernamesCount", len(req.Usernames)).Warn("Too many usernames")
+		sendJSONError(w, fmt.Sprintf("At most %d usernames are allowed", maxUsernamesPerRequest), http.StatusBadRequest)
+		return
+	}
 
 	// Add users to group
 	result, err := rt.db.AddUsersToGroup(groupID, userID, req.Usernames)
@@ -58,7 +64,7 @@ func (rt *_router) handleAddToGroup(w http.ResponseWriter, r *http.Request, ps h
 		// Use errors.Is for proper error checking
 		if errors.Is(err, database.ErrGroupNotFound) {
 			ctx.Logger.Warn("Attempt to add users to non-existent group")
-			sendJSONError(w, "Group not found", http.StatusNotFound)
+			sendDatabaseError(w, err, "Group not found")
 			return
 		} else if errors.Is(err, database.ErrUnauthorized) {
 			ctx.Logger.Warn("Unauthorized attempt to add users to group")
@@ -79,8 +85,11 @@ func (rt *_router) handleAddToGroup(w http.ResponseWriter, r *http.Request, ps h
 			Username string `json:"username"`
 			UserID   string `json:"userId"`
 		} `json:"addedUsers"`
-		FailedUsers        []string `json:"failedUsers"`
-		UpdatedMemberCount int      `json:"updatedMemberCount"`
+		FailedUsers []struct {
+			Username string `json:"username"`
+			Reason   string `json:"reason"`
+		} `json:"failedUsers"`
+		UpdatedMemberCount int `json:"updatedMemberCount"`
 		AddedBy            struct {
 			Username string `json:"username"`
 			UserID   string `json:"userId"`
@@ -93,7 +102,10 @@ func (rt *_router) handleAddToGroup(w http.ResponseWriter, r *http.Request, ps h
 			Username string `json:"username"`
 			UserID   string `json:"userId"`
 		}, len(result.AddedUsers)),
-		FailedUsers:        result.FailedUsers,
+		FailedUsers: make([]struct {
+			Username string `json:"username"`
+			Reason   string `json:"reason"`
+		}, len(result.FailedUsers)),
 		UpdatedMemberCount: result.UpdatedMemberCount,
 		AddedBy: struct {
 			Username string `json:"username"`
@@ -116,6 +128,17 @@ func (rt *_router) handleAddToGroup(w http.ResponseWriter, r *http.Request, ps h
 		}
 	}
 
+	// Copy failed users and the reason they failed to response
+	for i, failure := range result.FailedUsers {
+		response.FailedUsers[i] = struct {
+			Username string `json:"username"`
+			Reason   string `json:"reason"`
+		}{
+			Username: failure.Username,
+			Reason:   failure.Reason,
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -136,24 +159,24 @@ func (rt *_router) handleLeaveGroup(w http.ResponseWriter, r *http.Request, ps h
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to leave group")
 
-		var statusCode int
 		var errorMessage string
 
 		if errors.Is(err, database.ErrUnauthorized) {
-			statusCode = http.StatusForbidden
 			errorMessage = "You are not a member of this group"
 		} else if errors.Is(err, database.ErrGroupNotFound) {
-			statusCode = http.StatusNotFound
 			errorMessage = "Group not found"
 		} else {
-			statusCode = http.StatusInternalServerError
-			errorMessage = ErrInternalServerMsg
+			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+			return
 		}
 
-		sendJSONError(w, errorMessage, statusCode)
+		sendDatabaseError(w, err, errorMessage)
 		return
 	}
 
+	// End the user's event streams of the group
+	rt.events.disconnect(userID, groupID)
+
 	// Create the response according to the API documentation
 	response := struct {
 		GroupID string `json:"groupId"`
@@ -175,7 +198,7 @@ func (rt *_router) handleLeaveGroup(w http.ResponseWriter, r *http.Request, ps h
 		},
 		IsGroupDeleted:       isGroupDeleted,
 		RemainingMemberCount: remainingMemberCount,
-		LeftAt:               time.Now().Format(time.RFC3339),
+		LeftAt:               time.Now().UTC().Format(time.RFC3339),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -216,27 +239,22 @@ func (rt *_router) handleSetGroupName(w http.ResponseWriter, r *http.Request, ps
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to set group name")
 
-		var statusCode int
 		var errorMessage string
 
 		if errors.Is(err, database.ErrUnauthorized) {
-			statusCode = http.StatusForbidden
 			errorMessage = "No permission to update"
 		} else if errors.Is(err, database.ErrGroupNotFound) {
-			statusCode = http.StatusNotFound
 			errorMessage = "Group not found"
 		} else if errors.Is(err, database.ErrInvalidGroupName) {
-			statusCode = http.StatusBadRequest
 			errorMessage = "Invalid group name format"
 		} else if errors.Is(err, database.ErrNameAlreadyTaken) {
-			statusCode = http.StatusConflict
 			errorMessage = "Group with this name already exists"
 		} else {
-			statusCode = http.StatusInternalServerError
-			errorMessage = ErrInternalServerMsg
+			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+			return
 		}
 
-		sendJSONError(w, errorMessage, statusCode)
+		sendDatabaseError(w, err, errorMessage)
 		return
 	}
 
@@ -270,7 +288,7 @@ func (rt *_router) handleSetGroupName(w http.ResponseWriter, r *http.Request, ps
 			Username: username,
 			UserID:   userID,
 		},
-		UpdatedAt:   time.Now().Format(time.RFC3339),
+		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
 		MemberCount: memberCount,
 	}
 
@@ -337,31 +355,29 @@ func (rt *_router) handleSetGroupPhoto(w http.ResponseWriter, r *http.Request, p
 		return
 	}
 
-	// Detect content type
-	contentType := http.DetectContentType(fileBytes)
+	// Check that the photo is an image the clients can display
+	info, err := rt.validateImage(fileBytes)
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("Invalid photo")
+		sendImageError(w, err)
+		return
+	}
+	contentType := info.MimeType
+
 	// Update the group photo
 	oldPhotoID, newPhotoID, err := rt.db.SetGroupPhoto(groupID, userID, fileBytes, contentType)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to set group photo")
 
-		var statusCode int
-		var errorMessage string
-
 		if errors.Is(err, database.ErrUnauthorized) {
-			statusCode = http.StatusForbidden
-			errorMessage = "No permission to update photo"
+			sendDatabaseError(w, err, "No permission to update photo")
 		} else if errors.Is(err, database.ErrGroupNotFound) {
-			statusCode = http.StatusNotFound
-			errorMessage = "Group not found"
+			sendDatabaseError(w, err, "Group not found")
 		} else if strings.Contains(err.Error(), "unsupported content type") {
-			statusCode = http.StatusUnsupportedMediaType
-			errorMessage = "Invalid file type, expected image"
+			sendJSONError(w, "Invalid file type, expected image", http.StatusUnsupportedMediaType)
 		} else {
-			statusCode = http.StatusInternalServerError
-			errorMessage = ErrInternalServerMsg
+			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
 		}
-
-		sendJSONError(w, errorMessage, statusCode)
 		return
 	}
 
@@ -394,7 +410,7 @@ func (rt *_router) handleSetGroupPhoto(w http.ResponseWriter, r *http.Request, p
 			Username: username,
 			UserID:   userID,
 		},
-		UpdatedAt: time.Now().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -403,3 +419,533 @@ func (rt *_router) handleSetGroupPhoto(w http.ResponseWriter, r *http.Request, p
 		ctx.Logger.WithError(err).Error("Failed to encode response")
 	}
 }
+
+// Handles listing the admins of a group
+func (rt *_router) handleGetGroupAdmins(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	groupID := ps.ByName("groupId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID": groupID,
+		"userID":  userID,
+	}).Info("Handling get group admins request")
+
+	// Only members can see who the admins are
+	isMember, err := rt.db.IsGroupMember(groupID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			sendDatabaseError(w, err, "Group not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to check group membership")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	if !isMember {
+		sendJSONError(w, "You are not a member of this group", http.StatusForbidden)
+		return
+	}
+
+	admins, err := rt.db.GetGroupAdmins(groupID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get group admins")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type adminInfo struct {
+		Username string `json:"username"`
+		UserID   string `json:"userId"`
+		Role     string `json:"role"`
+	}
+
+	adminInfos := make([]adminInfo, len(admins))
+	for i, admin := range admins {
+		adminInfos[i] = adminInfo{
+			Username: admin.Name,
+			UserID:   admin.ID,
+			Role:     admin.Role,
+		}
+	}
+
+	response := struct {
+		GroupID string      `json:"groupId"`
+		Admins  []adminInfo `json:"admins"`
+	}{
+		GroupID: groupID,
+		Admins:  adminInfos,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles listing the members of a group ordered by name, optionally filtered by a name prefix
+func (rt *_router) handleGetGroupMembers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	groupID := ps.ByName("groupId")
+	search := strings.TrimSpace(r.URL.Query().Get("search"))
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID": groupID,
+		"userID":  userID,
+		"search":  search,
+	}).Info("Handling get group members request")
+
+	members, err := rt.db.GetGroupMembers(groupID, userID, search)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			sendDatabaseError(w, err, "Group not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "You are not a member of this group")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get group members")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type memberInfo struct {
+		Username       string `json:"username"`
+		UserID         string `json:"userId"`
+		ProfilePhotoID string `json:"profilePhotoId,omitempty"`
+		Bio            string `json:"bio,omitempty"`
+		IsAdmin        bool   `json:"isAdmin"`
+	}
+
+	memberInfos := make([]memberInfo, len(members))
+	for i, m := range members {
+		memberInfos[i] = memberInfo{
+			Username:       m.Name,
+			UserID:         m.ID,
+			ProfilePhotoID: m.PhotoID,
+			Bio:            m.Bio,
+			IsAdmin:        m.IsAdmin,
+		}
+	}
+
+	response := struct {
+		GroupID string       `json:"groupId"`
+		Members []memberInfo `json:"members"`
+		Total   int          `json:"total"`
+	}{
+		GroupID: groupID,
+		Members: memberInfos,
+		Total:   len(memberInfos),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles listing the history of a group (creation, members added and leaving, renames and photo changes) in
+// chronological order
+func (rt *_router) handleGetGroupTimeline(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	groupID := ps.ByName("groupId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID": groupID,
+		"userID":  userID,
+	}).Info("Handling get group timeline request")
+
+	limit, offset, err := parsePagination(r.URL.Query(), 50, 200)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, total, err := rt.db.GetGroupTimeline(groupID, userID, limit, offset)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			sendDatabaseError(w, err, "Group not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "You are not a member of this group")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get group timeline")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type eventInfo struct {
+		EventID   int64           `json:"eventId"`
+		Type      string          `json:"type"`
+		Actor     SenderResponse  `json:"actor"`
+		Target    *SenderResponse `json:"target,omitempty"`
+		Details   string          `json:"details,omitempty"`
+		Timestamp string          `json:"timestamp"`
+	}
+
+	eventInfos := make([]eventInfo, len(events))
+	for i, e := range events {
+		eventInfos[i] = eventInfo{
+			EventID: e.ID,
+			Type:    e.Type,
+			Actor: SenderResponse{
+				Username: e.Actor.Name,
+				UserID:   e.Actor.ID,
+			},
+			Details:   e.Details,
+			Timestamp: e.Timestamp.Format(time.RFC3339),
+		}
+		if e.Target != nil {
+			eventInfos[i].Target = &SenderResponse{
+				Username: e.Target.Name,
+				UserID:   e.Target.ID,
+			}
+		}
+	}
+
+	response := struct {
+		GroupID string      `json:"groupId"`
+		Events  []eventInfo `json:"events"`
+		Total   int         `json:"total"`
+		Limit   int         `json:"limit"`
+		Offset  int         `json:"offset"`
+	}{
+		GroupID: groupID,
+		Events:  eventInfos,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// GroupSettingsResponse represents the settings of a group
+type GroupSettingsResponse struct {
+	SlowModeSeconds    int  `json:"slowModeSeconds"`
+	ForwardingDisabled bool `json:"forwardingDisabled"`
+	ApprovalRequired   bool `json:"approvalRequired"`
+	// Left out when members can react with any emoji
+	AllowedReactions []string `json:"allowedReactions,omitempty"`
+}
+
+func newGroupSettingsResponse(settings database.GroupSettings) GroupSettingsResponse {
+	return GroupSettingsResponse{
+		SlowModeSeconds:    settings.SlowModeSeconds,
+		ForwardingDisabled: settings.ForwardingDisabled,
+		ApprovalRequired:   settings.ApprovalRequired,
+		AllowedReactions:   settings.AllowedReactions,
+	}
+}
+
+// Maximum interval between a member's messages in slow mode
+const maxSlowModeSeconds = 3600
+
+// Maximum number of emoji a group can restrict reactions to
+const maxAllowedReactions = 20
+
+// Handles group admins changing the group settings, only the settings present in the request are changed
+func (rt *_router) handleUpdateGroupSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	groupID := ps.ByName("groupId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID": groupID,
+		"userID":  userID,
+	}).Info("Handling update group settings request")
+
+	var req struct {
+		SlowModeSeconds    *int      `json:"slowModeSeconds"`
+		ForwardingDisabled *bool     `json:"forwardingDisabled"`
+		ApprovalRequired   *bool     `json:"approvalRequired"`
+		AllowedReactions   *[]string `json:"allowedReactions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to decode request body")
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.SlowModeSeconds != nil && (*req.SlowModeSeconds < 0 || *req.SlowModeSeconds > maxSlowModeSeconds) {
+		sendJSONError(w, fmt.Sprintf("slowModeSeconds must be between 0 and %d", maxSlowModeSeconds), http.StatusBadRequest)
+		return
+	}
+
+	// An empty list lifts the restriction, duplicates are dropped
+	if req.AllowedReactions != nil {
+		if len(*req.AllowedReactions) > maxAllowedReactions {
+			sendJSONError(w, fmt.Sprintf("allowedReactions can't have more than %d emoji", maxAllowedReactions), http.StatusBadRequest)
+			return
+		}
+		seen := make(map[string]bool)
+		allowed := []string{}
+		for _, emoji := range *req.AllowedReactions {
+			if !isValidEmoji(emoji) {
+				sendJSONError(w, "allowedReactions must only contain emoji", http.StatusBadRequest)
+				return
+			}
+			if !seen[emoji] {
+				seen[emoji] = true
+				allowed = append(allowed, emoji)
+			}
+		}
+		req.AllowedReactions = &allowed
+	}
+
+	settings, err := rt.db.UpdateGroupSettings(groupID, userID, database.GroupSettingsUpdate{
+		SlowModeSeconds:    req.SlowModeSeconds,
+		ForwardingDisabled: req.ForwardingDisabled,
+		ApprovalRequired:   req.ApprovalRequired,
+		AllowedReactions:   req.AllowedReactions,
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			sendDatabaseError(w, err, "Group not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "Only group admins can change the group settings")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to update group settings")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID":            groupID,
+		"slowModeSeconds":    settings.SlowModeSeconds,
+		"forwardingDisabled": settings.ForwardingDisabled,
+		"approvalRequired":   settings.ApprovalRequired,
+		"allowedReactions":   settings.AllowedReactions,
+	}).Info("Group settings updated")
+
+	response := struct {
+		GroupID  string                `json:"groupId"`
+		Settings GroupSettingsResponse `json:"settings"`
+	}{
+		GroupID:  groupID,
+		Settings: newGroupSettingsResponse(*settings),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles group admins listing the messages waiting for their approval, oldest first
+func (rt *_router) handleGetPendingMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	groupID := ps.ByName("groupId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID": groupID,
+		"userID":  userID,
+	}).Info("Handling get pending messages request")
+
+	messages, err := rt.db.GetPendingMessages(groupID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			sendDatabaseError(w, err, "Group not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "Only group admins can see the messages pending approval")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get pending messages")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	pending := make([]MessageResponse, len(messages))
+	for i, m := range messages {
+		pending[i] = rt.convertMessage(m, userID)
+	}
+
+	response := struct {
+		GroupID  string            `json:"groupId"`
+		Messages []MessageResponse `json:"messages"`
+		Total    int               `json:"total"`
+	}{
+		GroupID:  groupID,
+		Messages: pending,
+		Total:    len(pending),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles group admins approving a message, which makes it visible to the whole group
+func (rt *_router) handleApproveMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"userID":    userID,
+	}).Info("Handling approve message request")
+
+	message, groupID, err := rt.db.ApproveMessage(messageID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrMessageNotFound) {
+			sendDatabaseError(w, err, "Message not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "Only group admins can approve messages")
+			return
+		}
+		if errors.Is(err, database.ErrMessageNotPending) {
+			sendDatabaseError(w, err, "Message is not pending approval")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to approve message")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"groupID":   groupID,
+		"senderID":  message.SenderID,
+	}).Info("Message approved")
+
+	response := struct {
+		GroupID string          `json:"groupId"`
+		Message MessageResponse `json:"message"`
+	}{
+		GroupID: groupID,
+		Message: rt.convertMessage(*message, userID),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+	// The message is delivered to the group once approved
+	rt.publishToConversation(ctx, groupID, eventNewMessage, response.Message)
+}
+
+// Handles group admins removing all the reactions a user added in the group, as a moderation tool
+func (rt *_router) handleDeleteUserReactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	groupID := ps.ByName("groupId")
+	targetUserID := r.URL.Query().Get("userId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID":      groupID,
+		"userID":       userID,
+		"targetUserID": targetUserID,
+	}).Info("Handling delete user reactions request")
+
+	if targetUserID == "" {
+		sendJSONError(w, "Missing required query parameter 'userId'", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := rt.db.DeleteUserReactions(groupID, userID, targetUserID)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			sendDatabaseError(w, err, "Group not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "Only group admins can remove the reactions of other users")
+			return
+		}
+		if errors.Is(err, database.ErrUserNotFound) {
+			sendDatabaseError(w, err, "User not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to delete user reactions")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	// Moderation actions are always logged, so they can be reviewed later
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID":      groupID,
+		"adminID":      userID,
+		"targetUserID": targetUserID,
+		"deleted":      deleted,
+	}).Warn("Group admin removed the reactions of a user")
+
+	response := struct {
+		GroupID string `json:"groupId"`
+		UserID  string `json:"userId"`
+		Deleted int    `json:"deleted"`
+	}{
+		GroupID: groupID,
+		UserID:  targetUserID,
+		Deleted: deleted,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles a group admin removing another member from the group
+func (rt *_router) handleRemoveGroupMember(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	groupID := ps.ByName("groupId")
+	targetUserID := ps.ByName("userId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID":      groupID,
+		"userID":       userID,
+		"targetUserID": targetUserID,
+	}).Info("Handling remove group member request")
+
+	remaining, err := rt.db.RemoveUserFromGroup(groupID, userID, targetUserID)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			sendDatabaseError(w, err, "Group not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "Only group admins can remove members")
+			return
+		}
+		if errors.Is(err, database.ErrRemoveSelf) {
+			sendDatabaseError(w, err, "You can't remove yourself, leave the group instead")
+			return
+		}
+		if errors.Is(err, database.ErrUserNotFound) {
+			sendDatabaseError(w, err, "User is not a member of this group")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to remove group member")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	// Moderation actions are always logged, so they can be reviewed later
+	ctx.Logger.WithFields(logrus.Fields{
+		"groupID":      groupID,
+		"adminID":      userID,
+		"targetUserID": targetUserID,
+	}).Warn("Group admin removed a member")
+
+	rt.events.disconnect(targetUserID, groupID)
+
+	response := struct {
+		GroupID            string `json:"groupId"`
+		RemovedUserID      string `json:"removedUserId"`
+		RemovedBy          string `json:"removedBy"`
+		UpdatedMemberCount int    `json:"updatedMemberCount"`
+	}{
+		GroupID:            groupID,
+		RemovedUserID:      targetUserID,
+		RemovedBy:          userID,
+		UpdatedMemberCount: remaining,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Fetching a page for a preview has to complete within linkPreviewTimeout, and only the first maxLinkPreviewBody
+// bytes are read. At most maxConcurrentLinkPreviews pages are fetched at once, messages sent while they all are
+// get no preview
+const (
+	linkPreviewTimeout        = 5 * time.Second
+	maxLinkPreviewBody        = 512 << 10
+	maxLinkPreviewRedirects   = 5
+	maxConcurrentLinkPreviews = 4
+)
+
+// Longer titles and descriptions are truncated
+const (
+	maxPreviewTitleLength       = 200
+	maxPreviewDescriptionLength = 500
+	maxPreviewSiteNameLength    = 100
+)
+
+var errBlockedAddress = errors.New("address not allowed for link previews")
+
+// linkRegex matches the http(s) URLs in a text, trailing punctuation is trimmed by firstLink
+var linkRegex = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+var (
+	titleRegex     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaRegex      = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attributeRegex = regexp.MustCompile(`(?s)([a-zA-Z_:.-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// blockedNetworks are the ranges not covered by the net.IP methods used in isPublicIP that still aren't reachable on
+// the public internet
+var blockedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // "This" network
+		"100.64.0.0/10",   // Carrier-grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // Documentation
+		"198.18.0.0/15",   // Benchmarking
+		"198.51.100.0/24", // Documentation
+		"203.0.113.0/24",  // Documentation
+		"240.0.0.0/4",     // Reserved, including the broadcast address
+		"64:ff9b::/96",    // IPv4/IPv6 translation, could reach private IPv4 addresses
+		"2001:db8::/32",   // Documentation
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// LinkPreviewResponse describes the page a text message links to
+type LinkPreviewResponse struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+}
+
+func newLinkPreviewResponse(preview *database.LinkPreview) *LinkPreviewResponse {
+	if preview == nil {
+		return nil
+	}
+	return &LinkPreviewResponse{
+		URL:         preview.URL,
+		Title:       preview.Title,
+		Description: preview.Description,
+		ImageURL:    preview.ImageURL,
+		SiteName:    preview.SiteName,
+	}
+}
+
+// linkPreviewer fetches the pages linked to by messages in the background. Only public addresses are connected to,
+// checked after name resolution and on every redirect, so that messages can't be used to reach the server's network
+type linkPreviewer struct {
+	client *http.Client
+	slots  chan struct{}
+
+	// ctx is canceled on close, aborting the fetches in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+}
+
+func newLinkPreviewer() *linkPreviewer {
+	dialer := &net.Dialer{
+		Timeout: linkPreviewTimeout,
+		// Control is called with the resolved address of every connection, including those made for redirects
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errBlockedAddress
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		// A proxy would make the connections, bypassing the address check
+		Proxy:                  nil,
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    linkPreviewTimeout,
+		ResponseHeaderTimeout:  linkPreviewTimeout,
+		MaxResponseHeaderBytes: 64 << 10,
+		DisableKeepAlives:      true,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   linkPreviewTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxLinkPreviewRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &linkPreviewer{
+		client: client,
+		slots:  make(chan struct{}, maxConcurrentLinkPreviews),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// isPublicIP reports whether an address is reachable on the public internet
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// start takes a slot for a fetch, it returns false when all of them are taken or the previewer is closed. The
+// caller has to call finish once done
+func (p *linkPreviewer) start() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return false
+	}
+	p.running.Add(1)
+	return true
+}
+
+func (p *linkPreviewer) finish() {
+	<-p.slots
+	p.running.Done()
+}
+
+// close aborts the fetches in progress and waits for them to return
+func (p *linkPreviewer) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.cancel()
+	p.running.Wait()
+}
+
+// fetch downloads a page and builds its preview from its OpenGraph tags, falling back to its title and description.
+// It returns nil when the page has neither
+func (p *linkPreviewer) fetch(link string) (*database.LinkPreview, error) {
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", "WASAText-LinkPreview/1.0")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLinkPreviewBody))
+	if err != nil {
+		return nil, err
+	}
+	return parseLinkPreview(link, resp.Request.URL, string(body)), nil
+}
+
+// parseLinkPreview extracts the preview of a page from its head. Relative image URLs are resolved against pageURL,
+// where the page was fetched from after redirects
+func parseLinkPreview(link string, pageURL *url.URL, page string) *database.LinkPreview {
+	if end := strings.Index(strings.ToLower(page), "</head>"); end >= 0 {
+		page = page[:end]
+	}
+	page = strings.ToValidUTF8(page, "")
+
+	meta := make(map[string]string)
+	for _, tag := range metaRegex.FindAllString(page, -1) {
+		var key, content string
+		for _, attr := range attributeRegex.FindAllStringSubmatch(tag, -1) {
+			value := attr[2] + attr[3] + attr[4]
+			switch strings.ToLower(attr[1]) {
+			case "property", "name":
+				key = strings.ToLower(strings.TrimSpace(value))
+			case "content":
+				content = value
+			}
+		}
+		// The first occurrence of a tag wins, as with OpenGraph arrays
+		if _, ok := meta[key]; key != "" && !ok {
+			meta[key] = content
+		}
+	}
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if value := cleanPreviewText(meta[key]); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	preview := &database.LinkPreview{
+		URL:         link,
+		Title:       first("og:title", "twitter:title"),
+		Description: first("og:description", "twitter:description", "description"),
+		SiteName:    first("og:site_name"),
+	}
+	if preview.Title == "" {
+		if match := titleRegex.FindStringSubmatch(page); match != nil {
+			preview.Title = cleanPreviewText(match[1])
+		}
+	}
+	if preview.Title == "" && preview.Description == "" {
+		return nil
+	}
+	preview.Title, _ = truncateRunes(preview.Title, maxPreviewTitleLength)
+	preview.Description, _ = truncateRunes(preview.Description, maxPreviewDescriptionLength)
+	preview.SiteName, _ = truncateRunes(preview.SiteName, maxPreviewSiteNameLength)
+
+	if image := first("og:image", "og:image:url", "og:image:secure_url", "twitter:image"); image != "" {
+		if imageURL, err := pageURL.Parse(image); err == nil && (imageURL.Scheme == "http" || imageURL.Scheme == "https") {
+			preview.ImageURL = imageURL.String()
+		}
+	}
+	return preview
+}
+
+// cleanPreviewText decodes the HTML entities of a text and collapses its whitespace
+func cleanPreviewText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// firstLink returns the first http(s) URL in a text, or an empty string when there is none
+func firstLink(content string) string {
+	for _, match := range linkRegex.FindAllString(content, -1) {
+		match = strings.TrimRight(match, ".,;:!?'")
+		// A closing parenthesis is part of the link only when it has an opening one, as in Wikipedia links
+		for strings.HasSuffix(match, ")") && strings.Count(match, "(") < strings.Count(match, ")") {
+			match = strings.TrimRight(strings.TrimSuffix(match, ")"), ".,;:!?'")
+		}
+		parsed, err := url.Parse(match)
+		if err != nil || parsed.Hostname() == "" {
+			continue
+		}
+		return match
+	}
+	return ""
+}
+
+// previewLink fetches the preview of the first link in a text message in the background and stores it with the
+// message. Once stored, the preview is pushed to the participants, unless the message is pending approval
+func (rt *_router) previewLink(ctx reqcontext.RequestContext, conversationID, messageID, content string, publish bool) {
+	link := firstLink(content)
+	if link == "" {
+		return
+	}
+	logger := ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"link":      link,
+	})
+	if !rt.linkPreviews.start() {
+		logger.Debug("Skipped link preview, too many in progress")
+		return
+	}
+
+	go func() {
+		defer rt.linkPreviews.finish()
+
+		preview, err := rt.linkPreviews.fetch(link)
+		if err != nil {
+			logger.WithError(err).Debug("Failed to fetch link preview")
+			return
+		}
+		if preview == nil {
+			return
+		}
+		if err := rt.db.SetLinkPreview(messageID, *preview); err != nil {
+			logger.WithError(err).Error("Failed to store link preview")
+			return
+		}
+
+		if publish {
+			payload := struct {
+				MessageID   string               `json:"messageId"`
+				LinkPreview *LinkPreviewResponse `json:"linkPreview"`
+			}{
+				MessageID:   messageID,
+				LinkPreview: newLinkPreviewResponse(preview),
+			}
+			rt.publishToConversation(ctx, conversationID, eventLinkPreview, payload)
+		}
+	}()
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -15,3 +17,20 @@ func (rt *_router) liveness(w http.ResponseWriter, r *http.Request, ps httproute
 		return
 	}*/
 }
+
+// readiness is an HTTP handler that checks whether the server can serve traffic, unlike liveness it fails while the
+// database can't be reached
+func (rt *_router) readiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	if err := rt.db.Ping(); err != nil {
+		ctx.Logger.WithError(err).Error("Readiness check failed, database unreachable")
+		sendJSONError(w, "Database unreachable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Status string `json:"status"`
+	}{Status: "ready"}); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLocationLabelLength is the maximum length in characters of the label of a location message
+const maxLocationLabelLength = 100
+
+// LocationResponse is the location shared by a location message
+type LocationResponse struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Label     string  `json:"label,omitempty"`
+}
+
+// newLocation validates the coordinates and label sent for a location message
+func newLocation(latitude, longitude *float64, label string) (*LocationResponse, error) {
+	if latitude == nil || longitude == nil {
+		return nil, errors.New("Latitude and longitude are required")
+	}
+	if math.IsNaN(*latitude) || *latitude < -90 || *latitude > 90 {
+		return nil, errors.New("Latitude must be between -90 and 90")
+	}
+	if math.IsNaN(*longitude) || *longitude < -180 || *longitude > 180 {
+		return nil, errors.New("Longitude must be between -180 and 180")
+	}
+
+	label = strings.TrimSpace(label)
+	if utf8.RuneCountInString(label) > maxLocationLabelLength {
+		return nil, fmt.Errorf("Label exceeds maximum length of %d characters", maxLocationLabelLength)
+	}
+
+	return &LocationResponse{
+		Latitude:  *latitude,
+		Longitude: *longitude,
+		Label:     label,
+	}, nil
+}
+
+// parseLocation reads the location stored in the content of a location message, it returns nil if the content can't
+// be parsed
+func parseLocation(content string) *LocationResponse {
+	var location LocationResponse
+	if err := json.Unmarshal([]byte(content), &location); err != nil {
+		return nil
+	}
+	return &location
+}
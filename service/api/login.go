@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
 	"github.com/julienschmidt/httprouter"
@@ -17,8 +18,14 @@ type loginRequest struct {
 // loginResponse describes the data sent as response to a login request.
 type loginResponse struct {
 	Identifier string `json:"identifier"`
+	// Set while notifications are snoozed
+	SnoozedUntil           string `json:"snoozedUntil,omitempty"`
+	SnoozeRemainingSeconds int    `json:"snoozeRemainingSeconds,omitempty"`
 }
 
+// loginNameRegex matches the names users can log in with: alphanumeric characters, underscores, and hyphens
+var loginNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,16}$`)
+
 // handleLogin is the HTTP endpoint that handles user login
 func (rt *_router) handleLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	var req loginRequest
@@ -36,8 +43,7 @@ func (rt *_router) handleLogin(w http.ResponseWriter, r *http.Request, ps httpro
 	}
 
 	// Validate name pattern: alphanumeric characters, underscores, and hyphens
-	namePattern := regexp.MustCompile(`^[a-zA-Z0-9_-]{3,16}$`)
-	if !namePattern.MatchString(req.Name) {
+	if !loginNameRegex.MatchString(req.Name) {
 		ctx.Logger.WithField("name", req.Name).Warn("Invalid name format")
 		sendJSONError(w, "Name must contain only alphanumeric characters, underscores, and hyphens", http.StatusBadRequest)
 		return
@@ -56,6 +62,17 @@ func (rt *_router) handleLogin(w http.ResponseWriter, r *http.Request, ps httpro
 		Identifier: userID,
 	}
 
+	snoozeUntil, err := rt.db.GetSnoozeUntil(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get snooze")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	if snoozeUntil != nil {
+		resp.SnoozedUntil = snoozeUntil.Format(time.RFC3339)
+		resp.SnoozeRemainingSeconds = int(time.Until(*snoozeUntil).Seconds())
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
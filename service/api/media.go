@@ -1,35 +1,89 @@
 package api
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"image"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
 	"github.com/gerdalukosiute/WASAText/service/database"
 	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
 )
 
+// mediaIDRegex matches the IDs of uploaded media ("media" followed by a timestamp) and of profile and group photos
+// ("photo_" followed by part of the user ID, a timestamp and a random number), between 10 and 50 characters long
+var mediaIDRegex = regexp.MustCompile("^(media|photo)[a-zA-Z0-9_-]{5,45}$")
+
+// Media files never change once stored, so clients may cache them for mediaCacheMaxAge without revalidating. Caching
+// is private, as whether a file is visible depends on the user
+const mediaCacheMaxAge = 365 * 24 * time.Hour
+
 // handleGetMedia handles requests to retrieve media files
 func (rt *_router) handleGetMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
 	mediaID := ps.ByName("mediaId")
+	rt.serveMedia(w, r, mediaID, `"`+mediaID+`"`, ctx, userID, rt.db.GetMediaFile)
+}
+
+// handleGetMediaThumbnail handles requests to retrieve the thumbnail of a media file. Media without a thumbnail, as
+// it isn't an image or is small already, is served as is
+func (rt *_router) handleGetMediaThumbnail(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	mediaID := ps.ByName("mediaId")
+	rt.serveMedia(w, r, mediaID, `"`+mediaID+`-thumbnail"`, ctx, userID, rt.db.GetMediaThumbnail)
+}
 
-	// Validate mediaId length only, allowing both media and photo prefixes
-	if len(mediaID) < 10 || len(mediaID) > 50 {
-		ctx.Logger.WithField("mediaID", mediaID).Warn("Invalid media ID length")
+// serveMedia checks that a media file is visible to the user and writes what get returns for it, honoring single byte
+// ranges so that clients can resume downloads and stream large files. The content behind a media ID never changes,
+// so etag is derived from the ID and requests with a matching If-None-Match get a 304 without loading the file
+func (rt *_router) serveMedia(w http.ResponseWriter, r *http.Request, mediaID, etag string, ctx reqcontext.RequestContext, userID string, get func(string) ([]byte, string, error)) {
+	// Reject malformed IDs before they reach the database, allowing both media and photo prefixes
+	if !mediaIDRegex.MatchString(mediaID) {
+		ctx.Logger.WithField("mediaID", mediaID).Warn("Invalid media ID format")
 		sendJSONError(w, "Invalid media ID format", http.StatusBadRequest)
 		return
 	}
 
+	// Check that the media is visible to the user before loading it. Media the user can't see is reported as not
+	// found, so that media IDs can't be enumerated
+	canAccess, err := rt.db.CanAccessMedia(userID, mediaID)
+	if err != nil {
+		ctx.Logger.WithError(err).WithField("mediaID", mediaID).Error("Failed to check media access")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	if !canAccess {
+		ctx.Logger.WithFields(logrus.Fields{
+			"mediaID": mediaID,
+			"userID":  userID,
+		}).Warn("Unauthorized attempt to access media file")
+		sendJSONError(w, "Media file not found", http.StatusNotFound)
+		return
+	}
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		setMediaCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	// Get the media file from the database
-	fileData, mimeType, err := rt.db.GetMediaFile(mediaID)
+	fileData, mimeType, err := get(mediaID)
 	if err != nil {
 		ctx.Logger.WithError(err).WithField("mediaID", mediaID).Error("Failed to get media file")
 
 		// Check if the media file was not found
-		if errors.Is(err, database.ErrMediaNotFound) || strings.Contains(err.Error(), "not found") {
-			sendJSONError(w, "Media file not found", http.StatusNotFound)
+		if errors.Is(err, database.ErrMediaNotFound) {
+			sendDatabaseError(w, err, "Media file not found")
 			return
 		}
 
@@ -37,12 +91,286 @@ func (rt *_router) handleGetMedia(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
-	// Set the content type and write the file data
+	// Attached files are downloaded under their original name rather than displayed
+	filename, err := rt.db.GetMediaFilename(mediaID)
+	if err != nil {
+		ctx.Logger.WithError(err).WithField("mediaID", mediaID).Error("Failed to get media filename")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	if filename != "" {
+		if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); disposition != "" {
+			w.Header().Set("Content-Disposition", disposition)
+		}
+	}
+
+	// Set the content type and write the file data, or the requested part of it
 	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Accept-Ranges", "bytes")
+	setMediaCacheHeaders(w, etag)
+
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		start, end, err := parseByteRange(rangeHeader, len(fileData))
+		switch {
+		case errors.Is(err, errRangeNotSatisfiable):
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(fileData)))
+			sendJSONError(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		case err == nil:
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(fileData)))
+			fileData = fileData[start : end+1]
+			status = http.StatusPartialContent
+		}
+		// Ranges that can't be parsed are ignored, and the whole file is sent
+	}
+
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(fileData)))
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	if _, err := w.Write(fileData); err != nil {
 		ctx.Logger.WithError(err).Error("Failed to write media file to response")
 	}
 }
+
+// setMediaCacheHeaders lets clients cache a media file for good
+func setMediaCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", int(mediaCacheMaxAge.Seconds())))
+}
+
+// etagMatches reports whether an If-None-Match header lists the ETag. If-None-Match uses the weak comparison, so a
+// W/ prefix is ignored
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	errInvalidRange        = errors.New("invalid range")
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// parseByteRange parses a Range header asking for a single byte range of a file of the given size, and returns the
+// first and last byte of the range. It returns errInvalidRange for malformed headers and requests for several
+// ranges, which are answered with the whole file, and errRangeNotSatisfiable for ranges past the end of the file
+func parseByteRange(header string, size int) (int, int, error) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, 0, errInvalidRange
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	if strings.Contains(spec, ",") {
+		return 0, 0, errInvalidRange
+	}
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return 0, 0, errInvalidRange
+	}
+	first, last := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	// "bytes=-n" asks for the last n bytes
+	if first == "" {
+		n, err := strconv.ParseUint(last, 10, 63)
+		if err != nil {
+			return 0, 0, errInvalidRange
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, errRangeNotSatisfiable
+		}
+		if n > uint64(size) {
+			n = uint64(size)
+		}
+		return size - int(n), size - 1, nil
+	}
+
+	start, err := strconv.ParseUint(first, 10, 63)
+	if err != nil {
+		return 0, 0, errInvalidRange
+	}
+	end := uint64(size) - 1
+	if last != "" {
+		end, err = strconv.ParseUint(last, 10, 63)
+		if err != nil || end < start {
+			return 0, 0, errInvalidRange
+		}
+	}
+	if start >= uint64(size) {
+		return 0, 0, errRangeNotSatisfiable
+	}
+	if end >= uint64(size) {
+		end = uint64(size) - 1
+	}
+
+	return int(start), int(end), nil
+}
+
+// errUnsupportedImage is returned by validateImage for uploads that aren't a JPEG, PNG or GIF image
+var errUnsupportedImage = errors.New("unsupported media type, only JPEG, PNG and GIF images are allowed")
+
+// imageInfo describes an uploaded image as found by validateImage
+type imageInfo struct {
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// validateImage checks that an upload really is a JPEG, PNG or GIF image by decoding its header, rather than trusting
+// the declared or sniffed content type, and checks GIFs against the size limits. It returns errUnsupportedImage for
+// anything else, and the image's mime type and dimensions otherwise
+func (rt *_router) validateImage(data []byte) (imageInfo, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return imageInfo{}, errUnsupportedImage
+	}
+	switch format {
+	case "jpeg", "png":
+	case "gif":
+		if err := rt.validateGIF(data); err != nil {
+			return imageInfo{}, err
+		}
+	default:
+		return imageInfo{}, errUnsupportedImage
+	}
+
+	return imageInfo{
+		MimeType: "image/" + format,
+		Width:    config.Width,
+		Height:   config.Height,
+	}, nil
+}
+
+// sendImageError answers an upload rejected by validateImage
+func sendImageError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnsupportedImage) {
+		sendJSONError(w, "Unsupported media type. Only JPEG, PNG, and GIF images are allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+	sendJSONError(w, err.Error(), http.StatusBadRequest)
+}
+
+// validateGIF checks an uploaded GIF against the configured dimension and frame limits. Data that is not a GIF is
+// accepted as is. Large GIFs are rejected rather than transcoded, so the stored file is always the uploaded one
+func (rt *_router) validateGIF(data []byte) error {
+	if http.DetectContentType(data) != "image/gif" {
+		return nil
+	}
+
+	// Check the dimensions first, as it only requires reading the header
+	config, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid GIF image: %w", err)
+	}
+	if config.Width > rt.maxGIFDimension || config.Height > rt.maxGIFDimension {
+		return fmt.Errorf("GIF dimensions exceed the maximum of %dx%d pixels", rt.maxGIFDimension, rt.maxGIFDimension)
+	}
+
+	// Count the frames without decoding them, a small upload can hold thousands of large frames
+	frames, err := countGIFFrames(data, rt.maxGIFFrames+1)
+	if err != nil {
+		return fmt.Errorf("invalid GIF image: %w", err)
+	}
+	if frames > rt.maxGIFFrames {
+		return fmt.Errorf("GIF exceeds the maximum of %d frames", rt.maxGIFFrames)
+	}
+
+	return nil
+}
+
+var errTruncatedGIF = errors.New("unexpected end of data")
+
+// countGIFFrames counts the frames of a GIF by walking its blocks, skipping extensions and image data without decoding
+// them. It stops once limit frames are found. Frames extending past the logical screen are rejected, as image/gif
+// does
+func countGIFFrames(data []byte, limit int) (int, error) {
+	const (
+		headerSize          = 6
+		screenDescriptorLen = 7
+		imageDescriptorLen  = 9
+		extensionIntroducer = 0x21
+		imageSeparator      = 0x2C
+		trailer             = 0x3B
+		colorTableFlag      = 0x80
+	)
+
+	if len(data) < headerSize+screenDescriptorLen {
+		return 0, errTruncatedGIF
+	}
+	if version := string(data[:headerSize]); version != "GIF87a" && version != "GIF89a" {
+		return 0, errors.New("not a GIF")
+	}
+	width := int(data[6]) | int(data[7])<<8
+	height := int(data[8]) | int(data[9])<<8
+	pos := headerSize + screenDescriptorLen
+	if flags := data[10]; flags&colorTableFlag != 0 {
+		pos += 3 << ((flags & 0x07) + 1)
+	}
+
+	// skipSubBlocks skips a sequence of data sub-blocks, each prefixed by its size and ended by an empty one
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errTruncatedGIF
+			}
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+
+	frames := 0
+	for frames < limit {
+		if pos >= len(data) {
+			return 0, errTruncatedGIF
+		}
+		block := data[pos]
+		pos++
+
+		switch block {
+		case extensionIntroducer:
+			// The extension label, followed by its sub-blocks
+			pos++
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case imageSeparator:
+			if pos+imageDescriptorLen > len(data) {
+				return 0, errTruncatedGIF
+			}
+			d := data[pos : pos+imageDescriptorLen]
+			left, top := int(d[0])|int(d[1])<<8, int(d[2])|int(d[3])<<8
+			frameWidth, frameHeight := int(d[4])|int(d[5])<<8, int(d[6])|int(d[7])<<8
+			if left+frameWidth > width || top+frameHeight > height {
+				return 0, errors.New("frame bounds larger than image bounds")
+			}
+			pos += imageDescriptorLen
+			if flags := d[8]; flags&colorTableFlag != 0 {
+				pos += 3 << ((flags & 0x07) + 1)
+			}
+			// The minimum LZW code size, followed by the compressed pixels
+			pos++
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case trailer:
+			if frames == 0 {
+				return 0, errors.New("missing image data")
+			}
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("unknown block type 0x%02x", block)
+		}
+	}
+	return frames, nil
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// encodeGIF encodes an animation of frames frames of size x size pixels
+func encodeGIF(t *testing.T, size, frames int) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, size, size), palette))
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatalf("encoding GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// largeAnimatedGIF builds a valid GIF of frames uniform frames of size x size pixels. Each frame compresses to a few
+// kilobytes, so the GIF is small but takes gigabytes to decode as a whole
+func largeAnimatedGIF(t *testing.T, size, frames int) []byte {
+	t.Helper()
+	var one bytes.Buffer
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.Black, color.White})
+	if err := gif.Encode(&one, img, nil); err != nil {
+		t.Fatalf("encoding GIF: %v", err)
+	}
+
+	// The header is followed by the global color table, a single frame and the trailer
+	data := one.Bytes()
+	header := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		header += 3 << ((flags & 0x07) + 1)
+	}
+	if data[header] != 0x2C {
+		t.Fatalf("unexpected block 0x%02x after the GIF header", data[header])
+	}
+	frame := data[header : len(data)-1]
+
+	var buf bytes.Buffer
+	buf.Write(data[:header])
+	for i := 0; i < frames; i++ {
+		buf.Write(frame)
+	}
+	buf.WriteByte(0x3B)
+	return buf.Bytes()
+}
+
+func TestCountGIFFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		limit   int
+		want    int
+		wantErr bool
+	}{
+		{"single frame", encodeGIF(t, 16, 1), 10, 1, false},
+		{"animation", encodeGIF(t, 16, 5), 10, 5, false},
+		{"stops at the limit", encodeGIF(t, 16, 5), 3, 3, false},
+		{"large frames", largeAnimatedGIF(t, 2048, 1000), 101, 101, false},
+		{"not a GIF", []byte("PNG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 10, 0, true},
+		{"truncated", encodeGIF(t, 16, 2)[:40], 10, 0, true},
+		{"no frames", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x3B"), 10, 0, true},
+		{"frame outside the screen", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x2C\x00\x00\x00\x00\x02\x00\x02\x00\x00\x02\x00\x3B"), 10, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := countGIFFrames(tt.data, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("countGIFFrames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("countGIFFrames() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateGIF(t *testing.T) {
+	rt := &_router{maxGIFFrames: 100, maxGIFDimension: 2048}
+
+	if err := rt.validateGIF(encodeGIF(t, 32, 100)); err != nil {
+		t.Errorf("GIF within the limits rejected: %v", err)
+	}
+	if err := rt.validateGIF(encodeGIF(t, 32, 101)); err == nil || !strings.Contains(err.Error(), "frames") {
+		t.Errorf("GIF with too many frames: got %v, want a frame limit error", err)
+	}
+	if err := rt.validateGIF(encodeGIF(t, 2049, 1)); err == nil || !strings.Contains(err.Error(), "dimensions") {
+		t.Errorf("GIF too large: got %v, want a dimension limit error", err)
+	}
+
+	// A thousand full size frames in an upload of a few megabytes are rejected without decoding them
+	data := largeAnimatedGIF(t, 2048, 1000)
+	if len(data) > 10<<20 {
+		t.Fatalf("test GIF is %d bytes, expected a small upload", len(data))
+	}
+	start := time.Now()
+	if err := rt.validateGIF(data); err == nil || !strings.Contains(err.Error(), "frames") {
+		t.Errorf("oversized animation: got %v, want a frame limit error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("rejecting the oversized animation took %v", elapsed)
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `"media123"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"media123"`, true},
+		{`W/"media123"`, true},
+		{`"other", "media123"`, true},
+		{`"other",W/"media123"`, true},
+		{"*", true},
+		{`"other"`, false},
+		{`media123`, false},
+		{`"media1234"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGetMediaConditional(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.newUser(t, "alice")
+	bob := s.newUser(t, "bob")
+	conversationID, err := s.db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	data := encodeGIF(t, 16, 1)
+	mediaID, _, err := s.db.StoreMediaFile(data, "image/gif", "")
+	if err != nil {
+		t.Fatalf("StoreMediaFile: %v", err)
+	}
+	if _, _, _, err := s.db.AddMessage(conversationID, alice, "photo", "/media/"+mediaID, "image/gif", nil, 0); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	w := s.serve(http.MethodGet, "/media/"+mediaID, bob, "")
+	expectStatus(t, w, http.StatusOK)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag header")
+	}
+	if cacheControl := w.Header().Get("Cache-Control"); !strings.Contains(cacheControl, "immutable") ||
+		!strings.Contains(cacheControl, "max-age=") {
+		t.Errorf("Cache-Control %q, want a long lived immutable response", cacheControl)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data) {
+		t.Error("served file differs from the stored one")
+	}
+
+	// Asking again with the ETag gets a 304 without the file
+	r := httptest.NewRequest(http.MethodGet, "/media/"+mediaID, nil)
+	r.Header.Set("X-User-ID", bob)
+	r.Header.Set("If-None-Match", etag)
+	w = s.do(r)
+	expectStatus(t, w, http.StatusNotModified)
+	if w.Body.Len() != 0 {
+		t.Errorf("304 response with a %d bytes body", w.Body.Len())
+	}
+	if w.Header().Get("ETag") != etag {
+		t.Errorf("304 response with ETag %q, want %q", w.Header().Get("ETag"), etag)
+	}
+
+	// The ETag doesn't grant access to others
+	carol := s.newUser(t, "carol")
+	r.Header.Set("X-User-ID", carol)
+	w = s.do(r)
+	if w.Code == http.StatusNotModified || w.Code == http.StatusOK {
+		t.Errorf("user outside the conversation got status %d", w.Code)
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		header    string
+		size      int
+		wantFirst int
+		wantLast  int
+		wantErr   error
+	}{
+		{"bytes=0-99", 1000, 0, 99, nil},
+		{"bytes=100-", 1000, 100, 999, nil},
+		{"bytes=-100", 1000, 900, 999, nil},
+		{"bytes=-2000", 1000, 0, 999, nil},
+		{"bytes=500-5000", 1000, 500, 999, nil},
+		{"bytes= 10 - 20 ", 1000, 10, 20, nil},
+		{"bytes=999-999", 1000, 999, 999, nil},
+		{"bytes=1000-", 1000, 0, 0, errRangeNotSatisfiable},
+		{"bytes=-0", 1000, 0, 0, errRangeNotSatisfiable},
+		{"bytes=0-", 0, 0, 0, errRangeNotSatisfiable},
+		{"bytes=20-10", 1000, 0, 0, errInvalidRange},
+		{"bytes=0-10,20-30", 1000, 0, 0, errInvalidRange},
+		{"bytes=abc", 1000, 0, 0, errInvalidRange},
+		{"bytes=a-b", 1000, 0, 0, errInvalidRange},
+		{"bytes=--5", 1000, 0, 0, errInvalidRange},
+		{"items=0-10", 1000, 0, 0, errInvalidRange},
+		{"bytes=99999999999999999999-", 1000, 0, 0, errInvalidRange},
+	}
+	for _, tt := range tests {
+		first, last, err := parseByteRange(tt.header, tt.size)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("parseByteRange(%q, %d) error = %v, want %v", tt.header, tt.size, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (first != tt.wantFirst || last != tt.wantLast) {
+			t.Errorf("parseByteRange(%q, %d) = %d-%d, want %d-%d", tt.header, tt.size, first, last, tt.wantFirst, tt.wantLast)
+		}
+	}
+}
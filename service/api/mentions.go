@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+// At most maxMentions distinct users are looked up for a single message, further mentions are left as plain text
+const maxMentions = 20
+
+// MentionResponse is a user mentioned in a message
+type MentionResponse struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+}
+
+// isUsernameByte reports whether b can be part of a username, see loginNameRegex
+func isUsernameByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_' || b == '-'
+}
+
+// parseMentions returns the distinct usernames mentioned in a text as @username. An @ preceded by a username
+// character, as in an email address, doesn't start a mention, and tokens that can't be usernames are skipped
+func parseMentions(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for i := 0; i < len(content) && len(usernames) < maxMentions; i++ {
+		if content[i] != '@' || (i > 0 && isUsernameByte(content[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(content) && isUsernameByte(content[end]) {
+			end++
+		}
+		username := content[i+1 : end]
+		if loginNameRegex.MatchString(username) && !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+		i = end - 1
+	}
+	return usernames
+}
+
+// Handles listing the messages in which the user was mentioned, newest first
+func (rt *_router) handleGetMentions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling get mentions request")
+
+	limit, offset, err := parsePagination(r.URL.Query(), 50, 200)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mentions, total, err := rt.db.GetMentions(userID, limit, offset)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get mentions")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type mentionInfo struct {
+		MessageID      string `json:"messageId"`
+		ConversationID string `json:"conversationId"`
+		Sender         struct {
+			Username string `json:"username"`
+			UserID   string `json:"userId"`
+		} `json:"sender"`
+		Type      string `json:"type"`
+		Content   string `json:"content"`
+		Timestamp string `json:"timestamp"`
+	}
+
+	messages := make([]mentionInfo, len(mentions))
+	for i, mention := range mentions {
+		info := mentionInfo{
+			MessageID:      mention.MessageID,
+			ConversationID: mention.ConversationID,
+			Type:           mention.Type,
+			Content:        mention.Content,
+			Timestamp:      mention.Timestamp.Format(time.RFC3339),
+		}
+		info.Sender.Username = mention.Sender
+		info.Sender.UserID = mention.SenderID
+		messages[i] = info
+	}
+
+	response := struct {
+		Messages []mentionInfo `json:"messages"`
+		Total    int           `json:"total"`
+		Limit    int           `json:"limit"`
+		Offset   int           `json:"offset"`
+	}{
+		Messages: messages,
+		Total:    total,
+		Limit:    limit,
+		Offset:   offset,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
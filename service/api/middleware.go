@@ -1,10 +1,12 @@
 package api
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"net/http"
 
 	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -20,16 +22,58 @@ func (rt *_router) withAuth(handler authenticatedHandler) httprouter.Handle {
 			http.Error(w, "Unauthorized: Missing user identifier", http.StatusUnauthorized)
 			return
 		}
+		// Nobody can act as the placeholder standing in for deleted accounts
+		if userID == database.DeletedUserID {
+			http.Error(w, "Unauthorized: Invalid user identifier", http.StatusUnauthorized)
+			return
+		}
 
 		handler(w, r, ps, ctx, userID)
 	})
 }
 
-// function to send JSON-formatted error responses
+// withAdmin wraps a handler reserved to administrators, authenticated by the X-Admin-Key header
+func (rt *_router) withAdmin(handler httpRouterHandler) httprouter.Handle {
+	return rt.wrap(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+		// Admin endpoints are disabled when no key is configured
+		if rt.adminKey == "" {
+			sendJSONError(w, "Not found", http.StatusNotFound)
+			return
+		}
+
+		adminKey := r.Header.Get("X-Admin-Key")
+		if subtle.ConstantTimeCompare([]byte(adminKey), []byte(rt.adminKey)) != 1 {
+			ctx.Logger.Warn("Invalid admin key")
+			sendJSONError(w, "Unauthorized: Invalid admin key", http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r, ps, ctx)
+	})
+}
+
+// function to send JSON-formatted error responses, with the generic code for the status
 func sendJSONError(w http.ResponseWriter, message string, statusCode int) {
+	sendJSONErrorCode(w, message, statusErrorCode(statusCode), statusCode)
+}
+
+// sendDatabaseError sends the response for an error returned by the database, with the code and status of its
+// sentinel
+func sendDatabaseError(w http.ResponseWriter, err error, message string) {
+	code, statusCode := databaseErrorCode(err)
+	sendJSONErrorCode(w, message, code, statusCode)
+}
+
+func sendJSONErrorCode(w http.ResponseWriter, message, code string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	errResp := map[string]string{"error": message}
+	errResp := struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}{
+		Error: message,
+		Code:  code,
+	}
 	if err := json.NewEncoder(w).Encode(errResp); err != nil {
 		http.Error(w, ErrInternalServerMsg, http.StatusInternalServerError)
 	}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// parsePagination reads the limit and offset query parameters, returning defaultLimit when no limit is given. The
+// error is meant to be returned to the client
+func parsePagination(query url.Values, defaultLimit int, maxLimit int) (limit int, offset int, err error) {
+	limit = defaultLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, parseErr := strconv.Atoi(value)
+		if parseErr != nil || parsed < 1 || parsed > maxLimit {
+			return 0, 0, fmt.Errorf("Limit must be a number between 1 and %d", maxLimit)
+		}
+		limit = parsed
+	}
+	if value := query.Get("offset"); value != "" {
+		parsed, parseErr := strconv.Atoi(value)
+		if parseErr != nil || parsed < 0 {
+			return 0, 0, errors.New("Offset must be a non-negative number")
+		}
+		offset = parsed
+	}
+	return limit, offset, nil
+}
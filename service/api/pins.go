@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Handles pinning a conversation to the top of the user's conversation list
+func (rt *_router) handlePinConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+	}).Info("Handling pin conversation request")
+
+	pinnedAt, err := rt.db.PinConversation(conversationID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "User is not a participant in this conversation")
+			return
+		}
+		if errors.Is(err, database.ErrTooManyPinned) {
+			sendDatabaseError(w, err, fmt.Sprintf("At most %d conversations can be pinned, unpin one first", database.MaxPinnedConversations))
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to pin conversation")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		ConversationID string `json:"conversationId"`
+		IsPinned       bool   `json:"isPinned"`
+		PinnedAt       string `json:"pinnedAt"`
+	}{
+		ConversationID: conversationID,
+		IsPinned:       true,
+		PinnedAt:       pinnedAt.Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles unpinning a conversation, moving it back among the others by last message time
+func (rt *_router) handleUnpinConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+	}).Info("Handling unpin conversation request")
+
+	if err := rt.db.UnpinConversation(conversationID, userID); err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "User is not a participant in this conversation")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to unpin conversation")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		ConversationID string `json:"conversationId"`
+		IsPinned       bool   `json:"isPinned"`
+	}{
+		ConversationID: conversationID,
+		IsPinned:       false,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows each key at most limit events in any sliding window of the given length. It is kept in memory,
+// so limits are per server instance and reset on restart
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	events map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for the key if it is within the limit. Otherwise it returns false along with how long to wait
+// before the next event is allowed
+func (l *rateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+
+	// Drop the events that left the window
+	events := l.events[key]
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	events = events[i:]
+
+	if len(events) >= l.limit {
+		l.events[key] = events
+		return false, events[0].Sub(cutoff)
+	}
+
+	l.events[key] = append(events, now)
+	l.sweep(cutoff)
+	return true, 0
+}
+
+// sweep forgets the keys without events in the window, once the map has grown large enough for it to matter
+func (l *rateLimiter) sweep(cutoff time.Time) {
+	if len(l.events) < 1024 {
+		return
+	}
+	for key, events := range l.events {
+		if !events[len(events)-1].After(cutoff) {
+			delete(l.events, key)
+		}
+	}
+}
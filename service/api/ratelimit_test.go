@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(3, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := l.Allow("alice"); !allowed {
+			t.Fatalf("event %d within the limit denied", i+1)
+		}
+	}
+	allowed, retryAfter := l.Allow("alice")
+	if allowed {
+		t.Fatal("event over the limit allowed")
+	}
+	if retryAfter <= 0 || retryAfter > 50*time.Millisecond {
+		t.Errorf("retry after %v, want within the window", retryAfter)
+	}
+
+	// Keys are limited separately
+	if allowed, _ := l.Allow("bob"); !allowed {
+		t.Error("event of another key denied")
+	}
+
+	// Events are allowed again once the earlier ones left the window
+	time.Sleep(retryAfter + 5*time.Millisecond)
+	if allowed, _ := l.Allow("alice"); !allowed {
+		t.Error("event after the window denied")
+	}
+}
+
+func TestReactionRateLimit(t *testing.T) {
+	s := newTestServer(t)
+	s.rt.reactionLimiter = newRateLimiter(3, time.Minute)
+	alice := s.newUser(t, "alice")
+	bob := s.newUser(t, "bob")
+	conversationID, err := s.db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	messageID, _, _, err := s.db.AddMessage(conversationID, alice, "text", "hello", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	// Adding and removing reactions both count towards the limit
+	w := s.serve(http.MethodPost, "/messages/"+messageID+"/comments", bob, `{"content":"👍"}`)
+	expectStatus(t, w, http.StatusCreated)
+	var comment struct {
+		InteractionID string `json:"interactionId"`
+	}
+	decodeJSON(t, w, &comment)
+	if comment.InteractionID == "" {
+		t.Fatalf("no interaction ID in %s", w.Body.String())
+	}
+	w = s.serve(http.MethodDelete, "/messages/"+messageID+"/comments/"+comment.InteractionID, bob, "")
+	expectStatus(t, w, http.StatusOK)
+	w = s.serve(http.MethodPost, "/messages/"+messageID+"/comments", bob, `{"content":"❤️"}`)
+	expectStatus(t, w, http.StatusCreated)
+
+	w = s.serve(http.MethodPost, "/messages/"+messageID+"/comments", bob, `{"content":"😂"}`)
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	var response struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error != reactionRateErrorMsg {
+		t.Errorf("unexpected response %s", w.Body.String())
+	}
+
+	// Other users aren't affected
+	w = s.serve(http.MethodPost, "/messages/"+messageID+"/comments", alice, `{"content":"😂"}`)
+	expectStatus(t, w, http.StatusCreated)
+}
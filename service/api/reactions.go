@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Handles listing who reacted to a message, optionally only with a given emoji
+func (rt *_router) handleGetReactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+	query := r.URL.Query()
+	emoji := query.Get("emoji")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"userID":    userID,
+		"emoji":     emoji,
+	}).Info("Handling get reactions request")
+
+	if emoji != "" && !isValidEmoji(emoji) {
+		sendJSONError(w, "Emoji must be a valid emoji", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, err := parsePagination(query, 50, 100)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reactions, total, err := rt.db.GetReactions(messageID, userID, emoji, limit, offset)
+	if err != nil {
+		if errors.Is(err, database.ErrMessageNotFound) {
+			sendDatabaseError(w, err, "Message not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "No permission to view reactions")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get reactions")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type reactionInfo struct {
+		Username  string `json:"username"`
+		UserID    string `json:"userId"`
+		Emoji     string `json:"emoji"`
+		Timestamp string `json:"timestamp"`
+	}
+
+	reactionInfos := make([]reactionInfo, len(reactions))
+	for i, reaction := range reactions {
+		reactionInfos[i] = reactionInfo{
+			Username:  reaction.Username,
+			UserID:    reaction.UserID,
+			Emoji:     reaction.Content,
+			Timestamp: reaction.Timestamp.Format(time.RFC3339),
+		}
+	}
+
+	response := struct {
+		MessageID string         `json:"messageId"`
+		Emoji     string         `json:"emoji,omitempty"`
+		Reactions []reactionInfo `json:"reactions"`
+		Total     int            `json:"total"`
+		Limit     int            `json:"limit"`
+		Offset    int            `json:"offset"`
+	}{
+		MessageID: messageID,
+		Emoji:     emoji,
+		Reactions: reactionInfos,
+		Total:     total,
+		Limit:     limit,
+		Offset:    offset,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles listing all reactions to a message grouped by emoji, in the order each emoji was first used
+func (rt *_router) handleGetComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"userID":    userID,
+	}).Info("Handling get comments request")
+
+	// Messages the user can't see are reported as missing
+	isAuthorized, err := rt.db.IsUserAuthorized(userID, messageID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to check authorization")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	if !isAuthorized {
+		sendJSONError(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	comments, err := rt.db.GetComments(messageID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get comments")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type reactor struct {
+		Username  string `json:"username"`
+		UserID    string `json:"userId"`
+		Timestamp string `json:"timestamp"`
+	}
+	type emojiGroup struct {
+		Emoji string    `json:"emoji"`
+		Count int       `json:"count"`
+		Users []reactor `json:"users"`
+	}
+
+	groups := []emojiGroup{}
+	index := make(map[string]int)
+	for _, c := range comments {
+		i, ok := index[c.Content]
+		if !ok {
+			i = len(groups)
+			index[c.Content] = i
+			groups = append(groups, emojiGroup{Emoji: c.Content})
+		}
+		groups[i].Count++
+		groups[i].Users = append(groups[i].Users, reactor{
+			Username:  c.Username,
+			UserID:    c.UserID,
+			Timestamp: c.Timestamp.Format(time.RFC3339),
+		})
+	}
+
+	response := struct {
+		MessageID string       `json:"messageId"`
+		Reactions []emojiGroup `json:"reactions"`
+		Total     int          `json:"total"`
+	}{
+		MessageID: messageID,
+		Reactions: groups,
+		Total:     len(comments),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles listing the emoji the user recently reacted with, most recent first
+func (rt *_router) handleGetRecentEmoji(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling get recent emoji request")
+
+	recent, err := rt.db.GetRecentEmoji(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get recent emoji")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type recentEmojiResponse struct {
+		Emoji      string `json:"emoji"`
+		UseCount   int    `json:"useCount"`
+		LastUsedAt string `json:"lastUsedAt"`
+	}
+
+	emoji := make([]recentEmojiResponse, len(recent))
+	for i, e := range recent {
+		emoji[i] = recentEmojiResponse{
+			Emoji:      e.Emoji,
+			UseCount:   e.UseCount,
+			LastUsedAt: e.LastUsedAt.Format(time.RFC3339),
+		}
+	}
+
+	response := struct {
+		Emoji []recentEmojiResponse `json:"emoji"`
+	}{
+		Emoji: emoji,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
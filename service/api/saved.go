@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// savedMessageResponse represents a message in the user's Saved Messages
+type savedMessageResponse struct {
+	MessageID      string `json:"messageId"`
+	Type           string `json:"type"`
+	Content        string `json:"content"`
+	ContentType    string `json:"contentType,omitempty"`
+	OriginalSender struct {
+		Username string `json:"username"`
+		UserID   string `json:"userId"`
+	} `json:"originalSender"`
+	OriginalTimestamp string `json:"originalTimestamp"`
+	SavedAt           string `json:"savedAt"`
+}
+
+func newSavedMessageResponse(message database.ForwardedMessage) savedMessageResponse {
+	response := savedMessageResponse{
+		MessageID:         message.ID,
+		Type:              message.Type,
+		Content:           message.Content,
+		ContentType:       message.ContentType,
+		OriginalTimestamp: message.OriginalTimestamp.Format(time.RFC3339),
+		SavedAt:           message.Timestamp.Format(time.RFC3339),
+	}
+	response.OriginalSender.Username = message.OriginalSender.Name
+	response.OriginalSender.UserID = message.OriginalSender.ID
+	return response
+}
+
+// Handles copying a message into the user's Saved Messages
+func (rt *_router) handleSaveMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"userID":    userID,
+		"messageID": messageID,
+	}).Info("Handling save message request")
+
+	savedMessage, conversationID, err := rt.db.SaveMessage(messageID, userID)
+	if err != nil {
+		var errorMessage string
+
+		if errors.Is(err, database.ErrMessageNotFound) {
+			errorMessage = "Message not found"
+		} else if errors.Is(err, database.ErrUnauthorized) {
+			errorMessage = "No permission to save this message"
+		} else if errors.Is(err, database.ErrForwardingDisabled) {
+			errorMessage = "Saving messages from this conversation is disabled"
+		} else {
+			ctx.Logger.WithError(err).Error(ErrInternalServerMsg)
+			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+			return
+		}
+
+		ctx.Logger.WithError(err).Error(errorMessage)
+		sendDatabaseError(w, err, errorMessage)
+		return
+	}
+
+	response := struct {
+		ConversationID    string               `json:"conversationId"`
+		OriginalMessageID string               `json:"originalMessageId"`
+		SavedMessage      savedMessageResponse `json:"savedMessage"`
+	}{
+		ConversationID:    conversationID,
+		OriginalMessageID: messageID,
+		SavedMessage:      newSavedMessageResponse(*savedMessage),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles listing the user's Saved Messages
+func (rt *_router) handleGetSavedMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling get saved messages request")
+
+	messages, err := rt.db.GetSavedMessages(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get saved messages")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	savedMessages := make([]savedMessageResponse, len(messages))
+	for i, message := range messages {
+		savedMessages[i] = newSavedMessageResponse(message)
+	}
+
+	response := struct {
+		Messages []savedMessageResponse `json:"messages"`
+		Total    int                    `json:"total"`
+	}{
+		Messages: savedMessages,
+		Total:    len(savedMessages),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// minMessageSearchLength is the shortest search term accepted, shorter ones match almost every message
+const minMessageSearchLength = 2
+
+// Search results show a snippet of the matching message of at most searchSnippetLength characters, starting up to
+// searchSnippetLead characters before the match
+const (
+	searchSnippetLength = 100
+	searchSnippetLead   = 30
+)
+
+// Handles searching the text messages of a conversation by keyword, most recent first
+func (rt *_router) handleSearchMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+	}).Info("Handling search messages request")
+
+	if utf8.RuneCountInString(q) < minMessageSearchLength {
+		sendJSONError(w, "Search query must be at least 2 characters long", http.StatusBadRequest)
+		return
+	}
+
+	isParticipant, err := rt.db.IsUserInConversation(userID, conversationID)
+	if err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to check user participation in conversation")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		sendJSONError(w, "User is not a participant in this conversation", http.StatusForbidden)
+		return
+	}
+
+	messages, err := rt.db.SearchMessagesInConversation(conversationID, q)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to search messages")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]MessageResponse, len(messages))
+	for i, m := range messages {
+		results[i] = rt.convertMessage(m, userID)
+	}
+
+	response := struct {
+		ConversationID string            `json:"conversationId"`
+		Query          string            `json:"query"`
+		Messages       []MessageResponse `json:"messages"`
+		Total          int               `json:"total"`
+	}{
+		ConversationID: conversationID,
+		Query:          q,
+		Messages:       results,
+		Total:          len(results),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// Handles searching the text messages of all the user's conversations by keyword. Matches are grouped by conversation,
+// the conversation with the most recent match first
+func (rt *_router) handleSearchAllMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	ctx.Logger.WithField("userID", userID).Info("Handling search all messages request")
+
+	if utf8.RuneCountInString(q) < minMessageSearchLength {
+		sendJSONError(w, "Search query must be at least 2 characters long", http.StatusBadRequest)
+		return
+	}
+
+	hits, total, err := rt.db.SearchUserMessages(userID, q)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to search messages")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	type hitInfo struct {
+		MessageID      string         `json:"messageId"`
+		ConversationID string         `json:"conversationId"`
+		Sender         SenderResponse `json:"sender"`
+		Snippet        string         `json:"snippet"`
+		Timestamp      string         `json:"timestamp"`
+	}
+	type conversationHits struct {
+		ConversationID string    `json:"conversationId"`
+		Title          string    `json:"title"`
+		LastMatchAt    string    `json:"lastMatchAt"`
+		Messages       []hitInfo `json:"messages"`
+	}
+
+	// Hits come most recent first, so the first hit of each conversation is its last match
+	groups := []conversationHits{}
+	index := make(map[string]int)
+	for _, h := range hits {
+		i, ok := index[h.ConversationID]
+		if !ok {
+			i = len(groups)
+			index[h.ConversationID] = i
+			groups = append(groups, conversationHits{
+				ConversationID: h.ConversationID,
+				Title:          h.ConversationTitle,
+				LastMatchAt:    h.Timestamp.Format(time.RFC3339),
+			})
+		}
+		groups[i].Messages = append(groups[i].Messages, hitInfo{
+			MessageID:      h.MessageID,
+			ConversationID: h.ConversationID,
+			Sender: SenderResponse{
+				Username: h.Sender.Name,
+				UserID:   h.Sender.ID,
+			},
+			Snippet:   searchSnippet(h.Content, q),
+			Timestamp: h.Timestamp.Format(time.RFC3339),
+		})
+	}
+
+	response := struct {
+		Query         string             `json:"query"`
+		Conversations []conversationHits `json:"conversations"`
+		Returned      int                `json:"returned"`
+		Total         int                `json:"total"`
+	}{
+		Query:         q,
+		Conversations: groups,
+		Returned:      len(hits),
+		Total:         total,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// searchSnippet returns the part of content around the first match of query, bounded to searchSnippetLength
+// characters. Matching ignores case like the database search does
+func searchSnippet(content, query string) string {
+	// The match is only located when lowering the case keeps the byte offsets, otherwise the snippet starts at the
+	// beginning
+	start := 0
+	lower := strings.ToLower(content)
+	if i := strings.Index(lower, strings.ToLower(query)); i > 0 && len(lower) == len(content) {
+		start = utf8.RuneCountInString(content[:i]) - searchSnippetLead
+	}
+	if start <= 0 {
+		snippet, _ := truncateRunes(content, searchSnippetLength)
+		return snippet
+	}
+
+	runes := []rune(content)
+	snippet, _ := truncateRunes(string(runes[start:]), searchSnippetLength-1)
+	return "…" + snippet
+}
@@ -2,5 +2,13 @@ package api
 
 // Close should close everything opened in the lifecycle of the `_router`; for example, background goroutines.
 func (rt *_router) Close() error {
+	if rt.stopArchiver != nil {
+		close(rt.stopArchiver)
+		<-rt.archiverDone
+	}
+	close(rt.stopSweeper)
+	<-rt.sweeperDone
+	rt.linkPreviews.close()
+	rt.events.close()
 	return nil
 }
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// A heartbeat comment is sent every sseHeartbeatInterval, so that proxies don't close idle streams and disconnected
+// clients are noticed
+const sseHeartbeatInterval = 15 * time.Second
+
+// Handles streaming the events of a conversation as server-sent events, for clients that can't use the WebSocket at
+// /ws. Each event is sent as a "data:" line holding the same envelope as on /ws. The stream ends when the client
+// disconnects or leaves the conversation
+func (rt *_router) handleConversationEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+
+	logger := ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+	})
+	logger.Info("Handling conversation events request")
+
+	isParticipant, err := rt.db.IsUserInConversation(userID, conversationID)
+	if err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		logger.WithError(err).Error("Failed to check participation")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		sendJSONError(w, "User is not a participant in this conversation", http.StatusForbidden)
+		return
+	}
+
+	// The stream outlives the write timeout of the server, so it's written to the connection directly
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		logger.Error("Response writer doesn't support hijacking the connection")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	sub := rt.events.subscribe(userID, conversationID)
+	if sub == nil {
+		sendJSONError(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer rt.events.connections.Done()
+
+	header := w.Header().Clone()
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		logger.WithError(err).Error("Failed to hijack the connection")
+		rt.events.unsubscribe(userID, sub, wsCloseNormal)
+		return
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		rt.events.unsubscribe(userID, sub, wsCloseNormal)
+		return
+	}
+
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "close")
+	if _, err := rw.WriteString("HTTP/1.1 200 OK\r\n"); err != nil {
+		rt.events.unsubscribe(userID, sub, wsCloseNormal)
+		return
+	}
+	if err := header.Write(rw); err != nil {
+		rt.events.unsubscribe(userID, sub, wsCloseNormal)
+		return
+	}
+	if err := writeSSE(conn, rw.Writer, "\r\n: connected\n\n"); err != nil {
+		rt.events.unsubscribe(userID, sub, wsCloseNormal)
+		return
+	}
+	logger.Info("Event stream opened")
+
+	// Clients don't send anything once the stream started, so reading only ends when they disconnect
+	go func() {
+		_, _ = io.Copy(io.Discard, rw.Reader)
+		rt.events.unsubscribe(userID, sub, wsCloseNormal)
+	}()
+
+	ticker := time.NewTicker(sseHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data := <-sub.send:
+			err = writeSSE(conn, rw.Writer, fmt.Sprintf("data: %s\n\n", data))
+		case <-ticker.C:
+			err = writeSSE(conn, rw.Writer, ": heartbeat\n\n")
+		case <-sub.done:
+			logger.Info("Event stream closed")
+			return
+		}
+		if err != nil {
+			logger.WithError(err).Debug("Failed to write to event stream")
+			rt.events.unsubscribe(userID, sub, wsCloseNormal)
+		}
+	}
+}
+
+// writeSSE writes part of an event stream and flushes it to the client right away
+func writeSSE(conn net.Conn, w *bufio.Writer, s string) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	if _, err := w.WriteString(s); err != nil {
+		return err
+	}
+	return w.Flush()
+}
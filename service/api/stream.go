@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// jsonArrayWriter writes the elements of a JSON array one at a time
+type jsonArrayWriter struct {
+	w     io.Writer
+	count int
+}
+
+// Write encodes v and appends it to the array
+func (a *jsonArrayWriter) Write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if a.count > 0 {
+		if _, err := io.WriteString(a.w, ","); err != nil {
+			return err
+		}
+	}
+	if _, err := a.w.Write(data); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+// jsonArrayField is an array field of a streamed JSON object, its elements are written by fill
+type jsonArrayField struct {
+	name string
+	fill func(*jsonArrayWriter) error
+}
+
+// streamJSONObject writes head, which must encode to a JSON object, followed by an extra array field whose elements
+// are written one at a time by fill, so that large arrays never have to be held in memory. The output is the same
+// as encoding the whole object with a json.Encoder, except that the array field comes last
+func streamJSONObject(w io.Writer, head interface{}, field string, fill func(*jsonArrayWriter) error) error {
+	return streamJSONFields(w, head, jsonArrayField{name: field, fill: fill})
+}
+
+// streamJSONFields is streamJSONObject with several array fields, written in order after head
+func streamJSONFields(w io.Writer, head interface{}, fields ...jsonArrayField) error {
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	if len(data) < 2 || data[0] != '{' {
+		return errors.New("streamed JSON head is not an object")
+	}
+
+	buf := bufio.NewWriter(w)
+	if _, err := buf.Write(data[:len(data)-1]); err != nil {
+		return err
+	}
+	for i, field := range fields {
+		key, err := json.Marshal(field.name)
+		if err != nil {
+			return err
+		}
+		if len(data) > 2 || i > 0 {
+			if err := buf.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if _, err := buf.Write(key); err != nil {
+			return err
+		}
+		if _, err := buf.WriteString(":["); err != nil {
+			return err
+		}
+
+		if err := field.fill(&jsonArrayWriter{w: buf}); err != nil {
+			return err
+		}
+
+		if err := buf.WriteByte(']'); err != nil {
+			return err
+		}
+	}
+
+	if _, err := buf.WriteString("}\n"); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type streamTestItem struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+}
+
+// fillItems returns a fill function writing items
+func fillItems(items []streamTestItem) func(*jsonArrayWriter) error {
+	return func(a *jsonArrayWriter) error {
+		for _, item := range items {
+			if err := a.Write(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestStreamJSONObjectMatchesEncoder(t *testing.T) {
+	type head struct {
+		Title string `json:"title"`
+		Count int    `json:"count,omitempty"`
+	}
+	items := []streamTestItem{{1, "one"}, {2, "<two> & \"quoted\""}, {3, "émoji 👍"}}
+
+	tests := []struct {
+		name  string
+		head  interface{}
+		items []streamTestItem
+		// buffered is the same response encoded at once, with the array as the last field
+		buffered interface{}
+	}{
+		{
+			"fields and items",
+			head{Title: "chat", Count: 3},
+			items,
+			struct {
+				head
+				Items []streamTestItem `json:"items"`
+			}{head{Title: "chat", Count: 3}, items},
+		},
+		{
+			"no items",
+			head{Title: "empty"},
+			nil,
+			struct {
+				head
+				Items []streamTestItem `json:"items"`
+			}{head{Title: "empty"}, []streamTestItem{}},
+		},
+		{
+			"empty head",
+			struct{}{},
+			items,
+			struct {
+				Items []streamTestItem `json:"items"`
+			}{items},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var streamed bytes.Buffer
+			if err := streamJSONObject(&streamed, tt.head, "items", fillItems(tt.items)); err != nil {
+				t.Fatalf("streamJSONObject: %v", err)
+			}
+			if !json.Valid(streamed.Bytes()) {
+				t.Fatalf("streamed output is not valid JSON: %s", streamed.String())
+			}
+
+			var buffered bytes.Buffer
+			if err := json.NewEncoder(&buffered).Encode(tt.buffered); err != nil {
+				t.Fatalf("encoding: %v", err)
+			}
+			if streamed.String() != buffered.String() {
+				t.Errorf("streamed output\n%s\ndiffers from the buffered output\n%s", streamed.String(), buffered.String())
+			}
+		})
+	}
+}
+
+func TestStreamJSONFields(t *testing.T) {
+	var streamed bytes.Buffer
+	err := streamJSONFields(&streamed, struct {
+		User string `json:"user"`
+	}{"alice"},
+		jsonArrayField{name: "messages", fill: fillItems([]streamTestItem{{1, "hi"}})},
+		jsonArrayField{name: "reactions", fill: fillItems(nil)},
+	)
+	if err != nil {
+		t.Fatalf("streamJSONFields: %v", err)
+	}
+
+	want := `{"user":"alice","messages":[{"id":1,"text":"hi"}],"reactions":[]}` + "\n"
+	if streamed.String() != want {
+		t.Errorf("streamJSONFields() = %s, want %s", streamed.String(), want)
+	}
+}
+
+func TestStreamJSONObjectErrors(t *testing.T) {
+	var out bytes.Buffer
+	if err := streamJSONObject(&out, []int{1}, "items", fillItems(nil)); err == nil {
+		t.Error("a head that isn't an object was accepted")
+	}
+
+	errFill := errors.New("fill failed")
+	err := streamJSONObject(&out, struct{}{}, "items", func(*jsonArrayWriter) error { return errFill })
+	if !errors.Is(err, errFill) {
+		t.Errorf("got %v, want the error of fill", err)
+	}
+}
+
+func TestConversationDetailsStreamed(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.newUser(t, "alice")
+	bob := s.newUser(t, "bob")
+	conversationID, err := s.db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	const messages = 50
+	for i := 0; i < messages; i++ {
+		if _, _, _, err := s.db.AddMessage(conversationID, alice, "text", fmt.Sprintf("message %d", i), "text/plain", nil, 0); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+	}
+
+	w := s.serve(http.MethodGet, "/conversations/"+conversationID, bob, "")
+	expectStatus(t, w, http.StatusOK)
+	if !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("response is not valid JSON: %s", w.Body.String())
+	}
+	var response struct {
+		ConversationID string            `json:"conversationId"`
+		Participants   []json.RawMessage `json:"participants"`
+		Messages       []MessageResponse `json:"messages"`
+	}
+	decodeJSON(t, w, &response)
+	if response.ConversationID != conversationID || len(response.Participants) != 2 {
+		t.Errorf("unexpected conversation %s with %d participants", response.ConversationID, len(response.Participants))
+	}
+	if len(response.Messages) != messages {
+		t.Fatalf("%d messages, want %d", len(response.Messages), messages)
+	}
+	if response.Messages[0].Content != fmt.Sprintf("message %d", messages-1) {
+		t.Errorf("first message is %q, want the newest", response.Messages[0].Content)
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Page size of the messages returned when syncing by sequence number
+const (
+	defaultSyncLimit = 100
+	maxSyncLimit     = 500
+)
+
+// Handles syncing the messages of a conversation, returning the messages delivered after the afterSeq sequence number
+// in order. Clients keep the seq of the last message they received and pass it on the next sync
+func (rt *_router) handleGetMessagesAfterSeq(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+	query := r.URL.Query()
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+		"afterSeq":       query.Get("afterSeq"),
+	}).Info("Handling get messages after sequence number request")
+
+	var afterSeq int64
+	if value := query.Get("afterSeq"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			sendJSONError(w, "afterSeq must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		afterSeq = parsed
+	}
+
+	limit, _, err := parsePagination(query, defaultSyncLimit, maxSyncLimit)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	messages, maxSeq, err := rt.db.GetMessagesAfterSeq(conversationID, userID, afterSeq, limit)
+	if err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "User is not a participant in this conversation")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get messages after sequence number")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	synced := make([]MessageResponse, len(messages))
+	for i, m := range messages {
+		synced[i] = rt.convertMessage(m, userID)
+	}
+
+	response := struct {
+		ConversationID string            `json:"conversationId"`
+		Messages       []MessageResponse `json:"messages"`
+		MaxSeq         int64             `json:"maxSeq"`
+		HasMore        bool              `json:"hasMore"`
+	}{
+		ConversationID: conversationID,
+		Messages:       synced,
+		MaxSeq:         maxSeq,
+		HasMore:        len(messages) > 0 && messages[len(messages)-1].Seq < maxSeq,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Named themes the clients know how to render. Any other theme has to be a hex color
+var conversationThemes = map[string]bool{
+	"light":    true,
+	"dark":     true,
+	"ocean":    true,
+	"forest":   true,
+	"sunset":   true,
+	"rose":     true,
+	"lavender": true,
+}
+
+var themeColorRegex = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
+
+// Handles setting the user's own theme for a conversation. An empty theme resets it to the default
+func (rt *_router) handleSetConversationTheme(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	conversationID := ps.ByName("conversationId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"conversationID": conversationID,
+		"userID":         userID,
+	}).Info("Handling set conversation theme request")
+
+	var req struct {
+		Theme *string `json:"theme"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to decode request body")
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Theme == nil {
+		sendJSONError(w, "Theme is required", http.StatusBadRequest)
+		return
+	}
+
+	theme := strings.TrimSpace(*req.Theme)
+	if themeColorRegex.MatchString(theme) {
+		theme = strings.ToLower(theme)
+	} else if theme != "" && !conversationThemes[theme] {
+		sendJSONError(w, "Theme must be one of light, dark, ocean, forest, sunset, rose, lavender or a hex color such as #1e90ff", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.SetConversationTheme(conversationID, userID, theme); err != nil {
+		if errors.Is(err, database.ErrConversationNotFound) {
+			sendDatabaseError(w, err, "Conversation not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "User is not a participant in this conversation")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to set conversation theme")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		ConversationID string `json:"conversationId"`
+		Theme          string `json:"theme"`
+	}{
+		ConversationID: conversationID,
+		Theme:          theme,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/gerdalukosiute/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Handles getting the thread of a message: the message itself first, then its replies in chronological order
+func (rt *_router) handleGetReplies(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	messageID := ps.ByName("messageId")
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"messageID": messageID,
+		"userID":    userID,
+	}).Info("Handling get replies request")
+
+	thread, err := rt.db.GetReplies(messageID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrMessageNotFound) {
+			sendDatabaseError(w, err, "Message not found")
+			return
+		}
+		if errors.Is(err, database.ErrUnauthorized) {
+			sendDatabaseError(w, err, "No permission to view this message")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get replies")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	messages := make([]MessageResponse, len(thread))
+	for i, m := range thread {
+		messages[i] = rt.convertMessage(m, userID)
+	}
+
+	response := struct {
+		MessageID  string            `json:"messageId"`
+		Messages   []MessageResponse `json:"messages"`
+		ReplyCount int               `json:"replyCount"`
+	}{
+		MessageID:  messageID,
+		Messages:   messages,
+		ReplyCount: len(thread) - 1,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
@@ -3,10 +3,12 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
 	"github.com/gerdalukosiute/WASAText/service/database"
@@ -65,7 +67,7 @@ func (rt *_router) handleUpdateUsername(w http.ResponseWriter, r *http.Request,
 		}
 		if errors.Is(err, database.ErrDuplicateUsername) {
 			ctx.Logger.WithField("newName", req.NewName).Warn("Username already taken")
-			sendJSONError(w, "Username already taken", http.StatusBadRequest)
+			sendDatabaseError(w, err, "Username already taken")
 			return
 		}
 
@@ -96,6 +98,134 @@ func (rt *_router) handleUpdateUsername(w http.ResponseWriter, r *http.Request,
 	}
 }
 
+// snoozeRequest represents the request body for snoozing notifications
+type snoozeRequest struct {
+	DurationMinutes *int `json:"durationMinutes"`
+}
+
+// Bounds for the snooze duration, a duration of 0 ends the snooze early
+const maxSnoozeMinutes = 7 * 24 * 60
+
+// bioRequest represents the request body for updating the bio
+type bioRequest struct {
+	Bio *string `json:"bio"`
+}
+
+// handlePutUserPath handles PUT requests to /user/{userId}. httprouter can't register /user/snooze and /user/bio next
+// to the userId wildcard, so they are dispatched here (neither can be a user ID, which is 12 characters long)
+func (rt *_router) handlePutUserPath(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	if ps.ByName("userId") == "snooze" {
+		rt.handleSnoozeNotifications(w, r, ps, ctx, userID)
+		return
+	}
+	if ps.ByName("userId") == "bio" {
+		rt.handleUpdateBio(w, r, ps, ctx, userID)
+		return
+	}
+	rt.handleUpdateUserPhoto(w, r, ps, ctx, userID)
+}
+
+// handleSnoozeNotifications handles PUT requests to /user/snooze, suppressing all notifications for a duration
+func (rt *_router) handleSnoozeNotifications(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling snooze notifications request")
+
+	var req snoozeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to decode request body")
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.DurationMinutes == nil {
+		sendJSONError(w, "Missing required field 'durationMinutes'", http.StatusBadRequest)
+		return
+	}
+	if *req.DurationMinutes < 0 || *req.DurationMinutes > maxSnoozeMinutes {
+		ctx.Logger.WithField("durationMinutes", *req.DurationMinutes).Warn("Invalid snooze duration")
+		sendJSONError(w, "Duration must be between 0 and 10080 minutes", http.StatusBadRequest)
+		return
+	}
+
+	var snoozeUntil *time.Time
+	if *req.DurationMinutes > 0 {
+		until := time.Now().Add(time.Duration(*req.DurationMinutes) * time.Minute)
+		snoozeUntil = &until
+	}
+
+	if err := rt.db.SetSnoozeUntil(userID, snoozeUntil); err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			sendJSONError(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to update snooze")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"userID":          userID,
+		"durationMinutes": *req.DurationMinutes,
+	}).Info("Notifications snoozed")
+
+	response := struct {
+		SnoozedUntil     *string `json:"snoozedUntil"`
+		RemainingSeconds int     `json:"remainingSeconds"`
+	}{}
+	if snoozeUntil != nil {
+		formatted := snoozeUntil.Format(time.RFC3339)
+		response.SnoozedUntil = &formatted
+		response.RemainingSeconds = *req.DurationMinutes * 60
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode JSON response")
+	}
+}
+
+// handleUpdateBio handles PUT requests to /user/bio, setting or clearing the user's "about" line
+func (rt *_router) handleUpdateBio(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling update bio request")
+
+	var req bioRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to decode request body")
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Bio == nil {
+		sendJSONError(w, "Missing required field 'bio'", http.StatusBadRequest)
+		return
+	}
+	bio := strings.TrimSpace(*req.Bio)
+
+	if err := rt.db.UpdateUserBio(userID, bio); err != nil {
+		if errors.Is(err, database.ErrBioTooLong) {
+			sendDatabaseError(w, err, fmt.Sprintf("Bio must be at most %d characters", database.MaxBioLength))
+			return
+		}
+		if errors.Is(err, database.ErrUserNotFound) {
+			sendJSONError(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to update bio")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("userID", userID).Info("Bio updated")
+
+	response := struct {
+		Bio string `json:"bio"`
+	}{
+		Bio: bio,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode JSON response")
+	}
+}
+
 // handleUpdateUserPhoto handles PUT requests to /user/{userId} for updating profile photos
 func (rt *_router) handleUpdateUserPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
 	ctx.Logger.WithField("userID", userID).Info("Handling update user photo request")
@@ -133,7 +263,7 @@ func (rt *_router) handleUpdateUserPhoto(w http.ResponseWriter, r *http.Request,
 	}
 
 	// Get the file from the form
-	file, header, err := r.FormFile("photo")
+	file, _, err := r.FormFile("photo")
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to get file from form")
 		sendJSONError(w, "No file provided or invalid file field", http.StatusBadRequest)
@@ -141,14 +271,6 @@ func (rt *_router) handleUpdateUserPhoto(w http.ResponseWriter, r *http.Request,
 	}
 	defer file.Close()
 
-	// Validate file type
-	contentType := header.Header.Get("Content-Type")
-	if !rt.db.IsValidImageType(contentType) {
-		ctx.Logger.WithField("contentType", contentType).Warn("Invalid file type")
-		sendJSONError(w, "Unsupported media type. Only JPEG, PNG, and GIF are allowed", http.StatusUnsupportedMediaType)
-		return
-	}
-
 	// Read the file data
 	fileData, err := io.ReadAll(file)
 	if err != nil {
@@ -164,6 +286,15 @@ func (rt *_router) handleUpdateUserPhoto(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	// Check that the photo is an image the clients can display, whatever content type the client declared
+	info, err := rt.validateImage(fileData)
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("Invalid photo")
+		sendImageError(w, err)
+		return
+	}
+	contentType := info.MimeType
+
 	// Update the user's photo directly in the database
 	oldPhotoID, newPhotoID, err := rt.db.UpdateUserPhoto(userID, fileData, contentType)
 	if err != nil {
@@ -172,7 +303,7 @@ func (rt *_router) handleUpdateUserPhoto(w http.ResponseWriter, r *http.Request,
 			"userID": userID,
 		}).Error("Failed to update user photo")
 		if errors.Is(err, database.ErrUserNotFound) {
-			sendJSONError(w, "User not found", http.StatusNotFound)
+			sendDatabaseError(w, err, "User not found")
 		} else {
 			sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
 		}
@@ -208,3 +339,100 @@ func (rt *_router) handleUpdateUserPhoto(w http.ResponseWriter, r *http.Request,
 		return
 	}
 }
+
+// handleDeleteUserPath handles DELETE requests to /user/{userId}/{item}. httprouter can't register /user/blocks/{userId}
+// next to /user/{userId}/photo, so both are dispatched here
+func (rt *_router) handleDeleteUserPath(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	if ps.ByName("userId") == "blocks" {
+		rt.handleUnblockUser(w, r, ps, ctx, userID)
+		return
+	}
+	if ps.ByName("item") == "photo" {
+		rt.handleRemoveUserPhoto(w, r, ps, ctx, userID)
+		return
+	}
+	sendJSONError(w, "Not found", http.StatusNotFound)
+}
+
+// handleRemoveUserPhoto handles DELETE requests to /user/{userId}/photo, clearing the user's profile photo
+func (rt *_router) handleRemoveUserPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling remove user photo request")
+
+	// Verify that the authenticated user matches the requested user ID
+	requestedUserID := ps.ByName("userId")
+	if userID != requestedUserID {
+		ctx.Logger.WithFields(logrus.Fields{
+			"authenticatedUserID": userID,
+			"requestedUserID":     requestedUserID,
+		}).Warn("Unauthorized attempt to remove another user's photo")
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	oldPhotoID, err := rt.db.RemoveUserPhoto(userID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			sendDatabaseError(w, err, "User not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to remove user photo")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+	if oldPhotoID == "" {
+		sendJSONError(w, "User has no profile photo", http.StatusNotFound)
+		return
+	}
+
+	response := struct {
+		UserID         string `json:"userId"`
+		RemovedPhotoID string `json:"removedPhotoId"`
+	}{
+		UserID:         userID,
+		RemovedPhotoID: oldPhotoID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
+
+// handleDeleteAccount handles DELETE requests to /user, deleting the account of the user. See database.DeleteUser for
+// what happens to their conversations and messages
+func (rt *_router) handleDeleteAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	ctx.Logger.WithField("userID", userID).Info("Handling delete account request")
+
+	username, err := rt.db.DeleteUser(userID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			sendDatabaseError(w, err, "User not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to delete account")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"userID":   userID,
+		"username": username,
+	}).Info("Account deleted")
+
+	rt.events.disconnect(userID, "")
+
+	response := struct {
+		UserID    string `json:"userId"`
+		Username  string `json:"username"`
+		DeletedAt string `json:"deletedAt"`
+	}{
+		UserID:    userID,
+		Username:  username,
+		DeletedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode response")
+	}
+}
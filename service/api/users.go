@@ -2,8 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
 	"github.com/julienschmidt/httprouter"
@@ -44,13 +48,25 @@ func (rt *_router) handleSearchUsers(w http.ResponseWriter, r *http.Request, ps
 		}
 	}
 
+	// Optionally leave out the user and the users they already have a 1:1 conversation with
+	excludePartners := false
+	switch r.URL.Query().Get("excludeExisting") {
+	case "", "false":
+	case "true":
+		excludePartners = true
+	default:
+		sendJSONError(w, "excludeExisting must be either 'true' or 'false'", http.StatusBadRequest)
+		return
+	}
+
 	ctx.Logger.WithFields(logrus.Fields{
 		"authenticatedUserID": userID,
 		"query":               trimmedQuery, // Log the trimmed query
+		"excludeExisting":     excludePartners,
 	}).Info("Authenticated user searching for users")
 
 	// Perform the search using the database with the trimmed query
-	users, total, err := rt.db.SearchUsers(trimmedQuery)
+	users, total, err := rt.db.SearchUsers(trimmedQuery, userID, excludePartners)
 	if err != nil {
 		ctx.Logger.WithFields(logrus.Fields{
 			"authenticatedUserID": userID,
@@ -67,6 +83,7 @@ func (rt *_router) handleSearchUsers(w http.ResponseWriter, r *http.Request, ps
 		Username       string `json:"username"`
 		UserID         string `json:"userId"`
 		ProfilePhotoID string `json:"profilePhotoId,omitempty"`
+		Bio            string `json:"bio,omitempty"`
 	}
 
 	userInfos := make([]UserInfo, len(users))
@@ -77,6 +94,7 @@ func (rt *_router) handleSearchUsers(w http.ResponseWriter, r *http.Request, ps
 			UserID:   user.ID,
 			// Only include profilePhotoId if it exists
 			ProfilePhotoID: user.PhotoID,
+			Bio:            user.Bio,
 		}
 	}
 
@@ -89,3 +107,47 @@ func (rt *_router) handleSearchUsers(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 }
+
+// Usernames can be checked without logging in, so checks are limited per client address to make it harder to
+// enumerate the registered users
+const (
+	usernameCheckRateLimit  = 30
+	usernameCheckRateWindow = time.Minute
+)
+
+// handleCheckUsernameAvailable handles GET requests to /users/available, telling whether a name is free to log in
+// with. Nothing is created
+func (rt *_router) handleCheckUsernameAvailable(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	allowed, retryAfter := rt.usernameLimiter.Allow(client)
+	if !allowed {
+		ctx.Logger.WithField("client", client).Warn("Username check rate limit exceeded")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		sendJSONError(w, usernameRateErrorMsg, http.StatusTooManyRequests)
+		return
+	}
+
+	// Apply the same rules as logging in
+	name := r.URL.Query().Get("name")
+	if !loginNameRegex.MatchString(name) {
+		sendJSONError(w, "Name must be 3-16 characters and contain only alphanumeric characters, underscores, and hyphens", http.StatusBadRequest)
+		return
+	}
+
+	available, err := rt.db.IsUsernameAvailable(name)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to check username availability")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Available bool `json:"available"`
+	}{available}); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to encode JSON response")
+	}
+}
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// websocketGUID is appended to the client's key to compute the accept key of the handshake, see RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes, only text frames are sent besides the control frames
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// Clients only send control frames, so frames longer than maxWebSocketFrame are rejected. Every write has to complete
+// within wsWriteTimeout. Clients are pinged every wsPingInterval and dropped when nothing is heard from them for
+// wsReadTimeout
+const (
+	maxWebSocketFrame = 4096
+	wsWriteTimeout    = 10 * time.Second
+	wsPingInterval    = 30 * time.Second
+	wsReadTimeout     = 2 * wsPingInterval
+)
+
+// Close status codes sent to the clients
+const (
+	wsCloseNormal    = 1000
+	wsCloseGoingAway = 1001
+	wsCloseProtocol  = 1002
+	wsCloseTooBig    = 1009
+)
+
+var (
+	errNotWebSocket          = errors.New("not a WebSocket handshake")
+	errUnmaskedFrame         = errors.New("WebSocket frame from the client is not masked")
+	errWebSocketFrameTooLong = errors.New("WebSocket frame is too long")
+)
+
+// wsConn is the server side of a WebSocket connection. Writes are serialized, as pongs are written by the goroutine
+// reading the connection while events are written by another one
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mu   sync.Mutex
+}
+
+// upgradeWebSocket completes the WebSocket handshake and takes over the connection. It returns errNotWebSocket when
+// the request isn't a WebSocket handshake, in which case nothing has been written yet
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return nil, errNotWebSocket
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errNotWebSocket
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, errNotWebSocket
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("response writer doesn't support hijacking the connection")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// The read and write timeouts of the server still apply to the hijacked connection
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	// SHA-1 is what the handshake prescribes, it isn't used for security here
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := rw.WriteString(response); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, br: rw.Reader}, nil
+}
+
+// headerHasToken reports whether a comma separated header contains the token, ignoring case
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame writes a single unfragmented frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = append(header, byte(n>>8), byte(n))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
+
+// writeText sends a text message
+func (c *wsConn) writeText(data []byte) error {
+	return c.writeFrame(wsOpText, data)
+}
+
+// writeClose sends a close frame with the given status code
+func (c *wsConn) writeClose(code uint16) error {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, code)
+	return c.writeFrame(wsOpClose, payload)
+}
+
+// readFrame reads the next frame sent by the client and unmasks its payload
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errUnmaskedFrame
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxWebSocketFrame {
+		return 0, nil, errWebSocketFrameTooLong
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
+
+// Close closes the underlying connection without a closing handshake
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+// handleWebSocket handles GET requests to /ws, upgrading the connection to a WebSocket over which new messages,
+// reactions and status changes in the user's conversations are pushed as they happen
+func (rt *_router) handleWebSocket(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, userID string) {
+	logger := ctx.Logger.WithField("userID", userID)
+	logger.Info("Handling WebSocket request")
+
+	if _, err := rt.db.GetUserNameByID(userID); err != nil {
+		logger.WithError(err).Warn("WebSocket requested by an unknown user")
+		sendJSONError(w, "Unauthorized: Invalid user identifier", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		if errors.Is(err, errNotWebSocket) {
+			sendJSONError(w, "Expected a WebSocket handshake", http.StatusBadRequest)
+			return
+		}
+		logger.WithError(err).Error("Failed to upgrade to WebSocket")
+		sendJSONError(w, ErrInternalServerMsg, http.StatusInternalServerError)
+		return
+	}
+
+	sub := rt.events.subscribe(userID, "")
+	if sub == nil {
+		_ = conn.writeClose(wsCloseGoingAway)
+		_ = conn.Close()
+		return
+	}
+	defer rt.events.connections.Done()
+	logger.Info("WebSocket client connected")
+
+	go rt.readWebSocket(logger, userID, conn, sub)
+
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data := <-sub.send:
+			err = conn.writeText(data)
+		case <-ticker.C:
+			err = conn.writeFrame(wsOpPing, nil)
+		case <-sub.done:
+			_ = conn.writeClose(sub.closeCode)
+			_ = conn.Close()
+			logger.Info("WebSocket client disconnected")
+			return
+		}
+		if err != nil {
+			logger.WithError(err).Debug("Failed to write to WebSocket")
+			rt.events.unsubscribe(userID, sub, wsCloseGoingAway)
+		}
+	}
+}
+
+// readWebSocket reads what the client sends until the connection is closed. Clients have nothing to say besides
+// control frames, so any other message is ignored
+func (rt *_router) readWebSocket(logger logrus.FieldLogger, userID string, conn *wsConn, sub *subscriber) {
+	for {
+		if err := conn.conn.SetReadDeadline(time.Now().Add(wsReadTimeout)); err != nil {
+			rt.events.unsubscribe(userID, sub, wsCloseGoingAway)
+			return
+		}
+
+		opcode, payload, err := conn.readFrame()
+		if err != nil {
+			closeCode := uint16(wsCloseGoingAway)
+			if errors.Is(err, errUnmaskedFrame) {
+				closeCode = wsCloseProtocol
+			} else if errors.Is(err, errWebSocketFrameTooLong) {
+				closeCode = wsCloseTooBig
+			}
+			logger.WithError(err).Debug("WebSocket read ended")
+			rt.events.unsubscribe(userID, sub, closeCode)
+			return
+		}
+
+		switch opcode {
+		case wsOpClose:
+			rt.events.unsubscribe(userID, sub, wsCloseNormal)
+			return
+		case wsOpPing:
+			if err := conn.writeFrame(wsOpPong, payload); err != nil {
+				rt.events.unsubscribe(userID, sub, wsCloseGoingAway)
+				return
+			}
+		}
+	}
+}
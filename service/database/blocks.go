@@ -0,0 +1,92 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// BlockUser blocks a user, so that the two users can no longer start a conversation together or message each other
+// in their 1:1 conversation, and neither shows up in the other's user search. Blocking an already blocked user
+// succeeds
+func (db *appdbimpl) BlockUser(blockerID, blockedID string) error {
+	var userExists bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ? AND id != ?)", blockedID, DeletedUserID).Scan(&userExists)
+	if err != nil {
+		return fmt.Errorf("error checking user existence: %w", err)
+	}
+	if !userExists {
+		return ErrUserNotFound
+	}
+
+	_, err = db.c.Exec(`
+		INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (blocker_id, blocked_id) DO NOTHING
+	`, blockerID, blockedID, nowUTC())
+	if err != nil {
+		return fmt.Errorf("error blocking user: %w", err)
+	}
+
+	return nil
+}
+
+// UnblockUser lifts a block set by the user
+func (db *appdbimpl) UnblockUser(blockerID, blockedID string) error {
+	result, err := db.c.Exec("DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?", blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("error unblocking user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotBlocked
+	}
+
+	return nil
+}
+
+// isBlockedBetween reports whether either user has blocked the other
+func isBlockedBetween(tx *sql.Tx, userID, otherUserID string) (bool, error) {
+	var blocked bool
+	err := tx.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)
+		)
+	`, userID, otherUserID, otherUserID, userID).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("error checking user blocks: %w", err)
+	}
+	return blocked, nil
+}
+
+// checkDirectMessageBlock returns ErrUnauthorized when the sender and the other participant of a 1:1 conversation
+// have blocked each other. Group conversations aren't affected by blocks
+func checkDirectMessageBlock(tx *sql.Tx, conversationID, senderID string) error {
+	var otherUserID string
+	err := tx.QueryRow(`
+		SELECT uc.user_id
+		FROM user_conversations uc
+		JOIN conversations c ON uc.conversation_id = c.id AND c.is_group = 0 AND c.is_self = 0
+		WHERE uc.conversation_id = ? AND uc.user_id != ?
+	`, conversationID, senderID).Scan(&otherUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching conversation partner: %w", err)
+	}
+
+	blocked, err := isBlockedBetween(tx, senderID, otherUserID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrUnauthorized
+	}
+	return nil
+}
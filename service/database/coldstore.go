@@ -0,0 +1,77 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ColdStore keeps the contents of media files moved out of the database by ArchiveMedia. Files are identified by a
+// key, which is the ID of the media file they were archived from
+type ColdStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// fileColdStore is a ColdStore keeping each archived media file in its own file inside a directory
+type fileColdStore struct {
+	dir string
+}
+
+// NewFileColdStore returns a ColdStore that keeps archived media files in dir, creating the directory if needed
+func NewFileColdStore(dir string) (ColdStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating cold storage directory: %w", err)
+	}
+	return &fileColdStore{dir: dir}, nil
+}
+
+func (s *fileColdStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(key))
+}
+
+// Put writes the file to a temporary file first, so that a crash never leaves a partially written file behind
+func (s *fileColdStore) Put(key string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(key)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error creating cold storage file: %w", err)
+	}
+	defer func() {
+		// Only left behind when something failed
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing cold storage file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error syncing cold storage file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing cold storage file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return fmt.Errorf("error moving cold storage file: %w", err)
+	}
+	return nil
+}
+
+func (s *fileColdStore) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("error reading cold storage file: %w", err)
+	}
+	return data, nil
+}
+
+// Delete succeeds when the file is already gone
+func (s *fileColdStore) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error deleting cold storage file: %w", err)
+	}
+	return nil
+}
@@ -6,13 +6,44 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-// Query to retrieve user conversations
-func (db *appdbimpl) GetUserConversations(userID string) ([]Conversation, int, error) {
+// conversationTitleCondition matches the conversations whose title as seen by the user, the other participant's name
+// for 1:1 conversations, is LIKE the pattern. It expects the conversation as c and the user's membership as uc
+const conversationTitleCondition = `COALESCE(CASE
+		WHEN c.is_group = 0 THEN (
+			SELECT u.name
+			FROM users u
+			JOIN user_conversations uc2 ON u.id = uc2.user_id
+			WHERE uc2.conversation_id = c.id AND u.id != uc.user_id
+			LIMIT 1
+		)
+		ELSE c.title
+	END, '') LIKE ? ESCAPE '\'`
+
+// conversationFilterConditions returns the conditions, to append to a WHERE clause, and their arguments selecting the
+// conversations matching the filter
+func conversationFilterConditions(filter ConversationFilter) (string, []interface{}) {
+	var conditions string
+	var args []interface{}
+	if filter.IsGroup != nil {
+		conditions += " AND c.is_group = ?"
+		args = append(args, *filter.IsGroup)
+	}
+	if filter.Title != "" {
+		conditions += " AND " + conversationTitleCondition
+		args = append(args, "%"+likeEscaper.Replace(filter.Title)+"%")
+	}
+	return conditions, args
+}
+
+// Query to retrieve user conversations, total is the number of conversations matching the filter
+func (db *appdbimpl) GetUserConversations(userID string, filter ConversationFilter) ([]Conversation, int, error) {
 	logrus.WithField("userID", userID).Info("Getting user conversations")
 	// First, check if the user exists
 	var exists bool
@@ -23,60 +54,78 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]Conversation, int, e
 	if !exists {
 		return nil, 0, ErrUserNotFound
 	}
+	filterConditions, filterArgs := conversationFilterConditions(filter)
+
 	// Get the total count of conversations
 	countQuery := `
 	SELECT COUNT(DISTINCT c.id)
 	FROM user_conversations uc
 	JOIN conversations c ON uc.conversation_id = c.id
-	WHERE uc.user_id = ?
-	`
+	WHERE uc.user_id = ? AND c.is_self = 0` + filterConditions
 	var total int
-	err = db.c.QueryRow(countQuery, userID).Scan(&total)
+	err = db.c.QueryRow(countQuery, append([]interface{}{userID}, filterArgs...)...).Scan(&total)
 	if err != nil {
 		logrus.WithError(err).Error("Error counting user conversations")
 		return nil, 0, fmt.Errorf("error counting user conversations: %w", err)
 	}
 	// Now get the conversations with details
 	query := `
-	SELECT c.id, c.title, c.is_group, c.created_at,
+	SELECT c.id, COALESCE(c.title, ''), c.is_group, c.created_at,
 		 CASE
-			 WHEN c.is_group = 0 THEN (
+			 WHEN c.is_group = 0 THEN COALESCE((
 				 SELECT u.name
 				 FROM users u
 				 JOIN user_conversations uc2 ON u.id = uc2.user_id
 				 WHERE uc2.conversation_id = c.id AND u.id != ?
 				 LIMIT 1
-			 )
+			 ), (SELECT u.name FROM users u WHERE u.id = c.removed_user_id))
 			 ELSE c.title
 		 END as display_title,
 		 CASE
-			 WHEN c.is_group = 0 THEN (
+			 WHEN c.is_group = 0 THEN COALESCE((
 				 SELECT u.photo_id
 				 FROM users u
 				 JOIN user_conversations uc2 ON u.id = uc2.user_id
 				 WHERE uc2.conversation_id = c.id AND u.id != ?
 				 LIMIT 1
-			 )
+			 ), (SELECT u.photo_id FROM users u WHERE u.id = c.removed_user_id))
 			 ELSE c.profile_photo
 		 END as display_photo,
-		 m.type, m.content, m.created_at as message_timestamp
+		 m.type, m.content, m.created_at as message_timestamp,
+		 COALESCE(cs.last_read_seq, 0),
+		 (
+			 SELECT COUNT(*)
+			 FROM messages mu
+			 WHERE mu.conversation_id = c.id AND mu.seq > COALESCE(cs.last_read_seq, 0) AND mu.sender_id != uc.user_id
+				 AND (mu.expires_at IS NULL OR mu.expires_at > ?)
+		 ) as unread_count,
+		 uc.pinned_at,
+		 (
+			 SELECT COUNT(*)
+			 FROM user_conversations uc3
+			 WHERE uc3.conversation_id = c.id
+		 ) as participant_count
 	FROM conversations c
 	JOIN user_conversations uc ON c.id = uc.conversation_id
+	LEFT JOIN conversation_settings cs ON cs.user_id = uc.user_id AND cs.conversation_id = c.id
 	LEFT JOIN (
 		SELECT m1.*
 		FROM messages m1
 		INNER JOIN (
 			SELECT conversation_id, MAX(created_at) as max_created_at
 			FROM messages
+			WHERE status != 'pending' AND (expires_at IS NULL OR expires_at > ?)
 			GROUP BY conversation_id
 		) m2 ON m1.conversation_id = m2.conversation_id AND m1.created_at = m2.max_created_at
+		WHERE m1.status != 'pending' AND (m1.expires_at IS NULL OR m1.expires_at > ?)
 	) m ON c.id = m.conversation_id
-	WHERE uc.user_id = ?
-	ORDER BY COALESCE(m.created_at, c.created_at) DESC
+	WHERE uc.user_id = ? AND c.is_self = 0` + filterConditions + `
+	ORDER BY uc.pinned_at IS NULL, uc.pinned_at DESC, COALESCE(m.created_at, c.created_at) DESC
 	LIMIT 10000
 	`
 
-	rows, err := db.c.Query(query, userID, userID, userID)
+	now := nowUTC()
+	rows, err := db.c.Query(query, append([]interface{}{userID, userID, now, now, now, userID}, filterArgs...)...)
 	if err != nil {
 		logrus.WithError(err).Error("Error querying user conversations")
 		return nil, 0, fmt.Errorf("error querying user conversations: %w", err)
@@ -87,7 +136,7 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]Conversation, int, e
 	for rows.Next() {
 		var conv Conversation
 		var displayTitle, displayPhoto, messageType, messageContent sql.NullString
-		var messageTimestamp, conversationCreatedAt sql.NullTime
+		var messageTimestamp, conversationCreatedAt, pinnedAt sql.NullTime
 
 		err := rows.Scan(
 			&conv.ID,
@@ -99,6 +148,10 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]Conversation, int, e
 			&messageType,
 			&messageContent,
 			&messageTimestamp,
+			&conv.LastReadSeq,
+			&conv.UnreadCount,
+			&pinnedAt,
+			&conv.ParticipantCount,
 		)
 		if err != nil {
 			logrus.WithError(err).Error("Error scanning conversation row")
@@ -120,6 +173,10 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]Conversation, int, e
 			conv.CreatedAt = conversationCreatedAt.Time
 		}
 
+		if pinnedAt.Valid {
+			conv.PinnedAt = &pinnedAt.Time
+		}
+
 		// Set the last message details
 		var msgType, msgContent string
 		var msgTimestamp time.Time
@@ -152,6 +209,12 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]Conversation, int, e
 			Timestamp: msgTimestamp,
 		}
 
+		// A conversation without messages was last active when it was created
+		conv.LastActivity = conv.CreatedAt
+		if messageTimestamp.Valid {
+			conv.LastActivity = messageTimestamp.Time
+		}
+
 		conversations = append(conversations, conv)
 	}
 
@@ -160,6 +223,20 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]Conversation, int, e
 		return nil, 0, fmt.Errorf("error iterating conversation rows: %w", err)
 	}
 
+	// The names for the titles of untitled groups are fetched at once, rather than for each group
+	for _, conv := range conversations {
+		if conv.IsGroup && strings.TrimSpace(conv.Title) == "" {
+			names, err := db.untitledGroupNames(userID)
+			if err != nil {
+				return nil, 0, err
+			}
+			for i := range conversations {
+				conversations[i].OtherParticipantNames = names[conversations[i].ID]
+			}
+			break
+		}
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"userID":            userID,
 		"conversationCount": len(conversations),
@@ -169,6 +246,42 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]Conversation, int, e
 	return conversations, total, nil
 }
 
+// untitledGroupNames returns the names of the first untitledGroupNameCount other participants, in alphabetical order,
+// of each group of the user without a title
+func (db *appdbimpl) untitledGroupNames(userID string) (map[string][]string, error) {
+	rows, err := db.c.Query(`
+		SELECT conversation_id, name
+		FROM (
+			SELECT uc.conversation_id, u.name,
+				ROW_NUMBER() OVER (PARTITION BY uc.conversation_id ORDER BY u.name) AS position
+			FROM user_conversations uc
+			JOIN users u ON u.id = uc.user_id
+			JOIN conversations c ON c.id = uc.conversation_id
+			JOIN user_conversations member ON member.conversation_id = c.id AND member.user_id = ?
+			WHERE c.is_group = 1 AND TRIM(COALESCE(c.title, '')) = '' AND uc.user_id != member.user_id
+		)
+		WHERE position <= ?
+		ORDER BY conversation_id, position
+	`, userID, untitledGroupNameCount)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching group participant names: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string][]string)
+	for rows.Next() {
+		var conversationID, name string
+		if err := rows.Scan(&conversationID, &name); err != nil {
+			return nil, fmt.Errorf("error scanning participant name: %w", err)
+		}
+		names[conversationID] = append(names[conversationID], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating participant names: %w", err)
+	}
+	return names, nil
+}
+
 // Query to start conversation
 func (db *appdbimpl) StartConversation(initiatorID string, recipientIDs []string, title string, isGroup bool) (string, error) {
 	tx, err := db.c.Begin()
@@ -182,6 +295,17 @@ func (db *appdbimpl) StartConversation(initiatorID string, recipientIDs []string
 		}
 	}()
 
+	// Users who blocked each other can't be brought together in a new conversation
+	for _, recipientID := range recipientIDs {
+		blocked, err := isBlockedBetween(tx, initiatorID, recipientID)
+		if err != nil {
+			return "", err
+		}
+		if blocked {
+			return "", ErrUnauthorized
+		}
+	}
+
 	// For 1:1 conversations, check if a conversation already exists
 	if !isGroup && len(recipientIDs) == 1 {
 		existingID, exists, err := db.GetExistingConversation(initiatorID, recipientIDs[0])
@@ -196,6 +320,21 @@ func (db *appdbimpl) StartConversation(initiatorID string, recipientIDs []string
 			return existingID, nil
 		}
 
+		// A conversation one of them removed from their list is given back to them rather than starting another one
+		removedID, found, err := findRemovedDirectConversation(tx, initiatorID, recipientIDs[0])
+		if err != nil {
+			return "", err
+		}
+		if found {
+			if err := restoreRemovedParticipant(tx, removedID); err != nil {
+				return "", err
+			}
+			if err := tx.Commit(); err != nil {
+				return "", fmt.Errorf("error committing transaction: %w", err)
+			}
+			return removedID, nil
+		}
+
 		// For 1:1 conversations, if title is not provided, use the recipient's name
 		if title == "" {
 			var recipientName string
@@ -216,7 +355,7 @@ func (db *appdbimpl) StartConversation(initiatorID string, recipientIDs []string
 	}
 
 	// Current time for created_at
-	now := time.Now()
+	now := nowUTC()
 
 	// Insert the new conversation
 	_, err = tx.Exec("INSERT INTO conversations (id, title, profile_photo, is_group, created_at) VALUES (?, ?, NULL, ?, ?)",
@@ -231,6 +370,9 @@ func (db *appdbimpl) StartConversation(initiatorID string, recipientIDs []string
 		if err != nil {
 			return "", fmt.Errorf("error creating group: %w", err)
 		}
+		if err = recordGroupEvent(tx, conversationID, GroupEventCreated, initiatorID, "", title); err != nil {
+			return "", err
+		}
 	}
 
 	// Add all participants (including the initiator) to the conversation
@@ -262,13 +404,22 @@ func (db *appdbimpl) StartConversation(initiatorID string, recipientIDs []string
 			return "", fmt.Errorf("error adding participant %s to conversation: %w", participantID, err)
 		}
 
-		// If it's a group, also add to group_members
+		// If it's a group, also add to group_members, the creator being its admin
 		if isGroup {
-			_, err = tx.Exec("INSERT INTO group_members (group_id, user_id) VALUES (?, ?)",
-				conversationID, participantID)
+			role := RoleMember
+			if participantID == initiatorID {
+				role = RoleAdmin
+			}
+			_, err = tx.Exec("INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, ?)",
+				conversationID, participantID, role)
 			if err != nil {
 				return "", fmt.Errorf("error adding participant %s to group: %w", participantID, err)
 			}
+			if participantID != initiatorID {
+				if err = recordGroupEvent(tx, conversationID, GroupEventMemberAdded, initiatorID, participantID, ""); err != nil {
+					return "", err
+				}
+			}
 		}
 	}
 
@@ -294,15 +445,18 @@ func (db *appdbimpl) GetUserIDByName(name string) (string, error) {
 
 // Gets an existing conversation in creation
 func (db *appdbimpl) GetExistingConversation(userID1, userID2 string) (string, bool, error) {
-	// Find conversations where both users are participants and it's not a group
+	// Find conversations where both users are participants and it's not a group. A conversation with anybody else
+	// in it isn't theirs alone, even when it isn't marked as a group
 	query := `
 	SELECT c.id
 	FROM conversations c
 	JOIN user_conversations uc1 ON c.id = uc1.conversation_id
 	JOIN user_conversations uc2 ON c.id = uc2.conversation_id
-	WHERE c.is_group = 0
+	WHERE c.is_group = 0 AND c.is_self = 0
 	AND uc1.user_id = ?
 	AND uc2.user_id = ?
+	AND (SELECT COUNT(*) FROM user_conversations uc WHERE uc.conversation_id = c.id) = 2
+	ORDER BY c.created_at
 	LIMIT 1
 	`
 
@@ -320,14 +474,149 @@ func (db *appdbimpl) GetExistingConversation(userID1, userID2 string) (string, b
 	return conversationID, true, nil
 }
 
-// Creates a unique conversation ID that matches the pattern ^[a-zA-Z0-9_-]{6,20}$
+// findRemovedDirectConversation looks for the 1:1 conversation of two users that one of them removed from their list
+// while the other kept it
+func findRemovedDirectConversation(tx *sql.Tx, userID1, userID2 string) (string, bool, error) {
+	var conversationID string
+	err := tx.QueryRow(`
+		SELECT c.id
+		FROM conversations c
+		JOIN user_conversations uc ON uc.conversation_id = c.id
+		WHERE c.is_group = 0 AND c.is_self = 0
+		AND ((uc.user_id = ? AND c.removed_user_id = ?) OR (uc.user_id = ? AND c.removed_user_id = ?))
+		AND (SELECT COUNT(*) FROM user_conversations WHERE conversation_id = c.id) = 1
+		ORDER BY c.created_at
+		LIMIT 1
+	`, userID1, userID2, userID2, userID1).Scan(&conversationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error checking for removed conversation: %w", err)
+	}
+	return conversationID, true, nil
+}
+
+// restoreRemovedParticipant puts the participant who removed a 1:1 conversation from their list back in it, so that
+// new messages reach them again. Conversations nobody removed are left as they are
+func restoreRemovedParticipant(tx *sql.Tx, conversationID string) error {
+	var removedUserID sql.NullString
+	err := tx.QueryRow("SELECT removed_user_id FROM conversations WHERE id = ?", conversationID).Scan(&removedUserID)
+	if err != nil {
+		return fmt.Errorf("error checking removed participant: %w", err)
+	}
+	if !removedUserID.Valid {
+		return nil
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO user_conversations (user_id, conversation_id) VALUES (?, ?)",
+		removedUserID.String, conversationID)
+	if err != nil {
+		return fmt.Errorf("error restoring removed participant: %w", err)
+	}
+	if _, err = tx.Exec("UPDATE conversations SET removed_user_id = NULL WHERE id = ?", conversationID); err != nil {
+		return fmt.Errorf("error clearing removed participant: %w", err)
+	}
+	return nil
+}
+
+// removeConversationForUserQueries delete what only matters to a user in a conversation they remove from their list.
+// They take the user ID and the conversation ID. Their reactions stay, as the other participant still sees them
+var removeConversationForUserQueries = []string{
+	"DELETE FROM message_read_status WHERE user_id = ? AND message_id IN (SELECT id FROM messages WHERE conversation_id = ?)",
+	"DELETE FROM flagged_messages WHERE user_id = ? AND message_id IN (SELECT id FROM messages WHERE conversation_id = ?)",
+	"DELETE FROM message_mentions WHERE user_id = ? AND message_id IN (SELECT id FROM messages WHERE conversation_id = ?)",
+	"DELETE FROM conversation_settings WHERE user_id = ? AND conversation_id = ?",
+	"DELETE FROM user_conversations WHERE user_id = ? AND conversation_id = ?",
+}
+
+// DeleteConversationForUser removes a one-on-one conversation from the user's list, the other participant keeps it.
+// The user is put back in it when a new message is sent in it or when either of them starts a conversation with the
+// other again. Once nobody is left in it, the conversation is deleted with all its messages. Groups are left with LeaveGroup
+// instead, and the conversation with oneself can't be removed
+func (db *appdbimpl) DeleteConversationForUser(userID, conversationID string) (fullyDeleted bool, err error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	var isGroup, isSelf bool
+	err = tx.QueryRow("SELECT is_group, is_self FROM conversations WHERE id = ?", conversationID).Scan(&isGroup, &isSelf)
+	if errors.Is(err, sql.ErrNoRows) || isSelf {
+		return false, ErrConversationNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking conversation type: %w", err)
+	}
+
+	var isParticipant bool
+	err = tx.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM user_conversations WHERE user_id = ? AND conversation_id = ?)", userID, conversationID,
+	).Scan(&isParticipant)
+	if err != nil {
+		return false, fmt.Errorf("error checking user participation: %w", err)
+	}
+	if !isParticipant {
+		return false, ErrUnauthorized
+	}
+	if isGroup {
+		return false, ErrGroupConversation
+	}
+
+	for _, query := range removeConversationForUserQueries {
+		if _, err := tx.Exec(query, userID, conversationID); err != nil {
+			return false, fmt.Errorf("error removing conversation for user: %w", err)
+		}
+	}
+
+	var remaining int
+	err = tx.QueryRow("SELECT COUNT(*) FROM user_conversations WHERE conversation_id = ?", conversationID).Scan(&remaining)
+	if err != nil {
+		return false, fmt.Errorf("error counting remaining participants: %w", err)
+	}
+	if remaining == 0 {
+		if err := deleteConversation(tx, conversationID); err != nil {
+			return false, err
+		}
+	} else {
+		_, err = tx.Exec("UPDATE conversations SET removed_user_id = ? WHERE id = ?", userID, conversationID)
+		if err != nil {
+			return false, fmt.Errorf("error recording removed participant: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return remaining == 0, nil
+}
+
+// conversationIDPattern is the pattern conversation IDs match
+var conversationIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{6,20}$`)
+
+// Creates a unique conversation ID that matches conversationIDPattern
 func (db *appdbimpl) GenerateConversationID() (string, error) {
 	// Try up to 10 times to generate a unique ID
 	for i := 0; i < 10; i++ {
-		// Generate a random number between 100 and 999999
-		// This will result in IDs between 7 and 10 characters long ("chat" + 3-6 digits)
-		randomNum := 100 + rand.Intn(999900)
-		candidateID := fmt.Sprintf("chat%d", randomNum)
+		// Zero padding the random number gives IDs of a fixed 14 characters ("chat" + 10 digits), whatever the
+		// number drawn
+		candidateID := fmt.Sprintf("chat%010d", rand.Int63n(10_000_000_000))
+		if !conversationIDPattern.MatchString(candidateID) {
+			return "", fmt.Errorf("generated conversation ID %q doesn't match the ID pattern", candidateID)
+		}
 
 		// Check if this ID already exists
 		var exists bool
@@ -346,18 +635,23 @@ func (db *appdbimpl) GenerateConversationID() (string, error) {
 	return "", fmt.Errorf("failed to generate a unique conversation ID after multiple attempts")
 }
 
-// Query to add message
-func (db *appdbimpl) AddMessage(conversationID, senderID, messageType, content string, contentType string, parentMessageID *string) (string, error) {
+// Query to add message, returns the ID and the initial status of the message
+func (db *appdbimpl) AddMessage(conversationID, senderID, messageType, content string, contentType string, parentMessageID *string, duration int) (string, string, int64, error) {
+	// Never store a message without content, whichever handler built it
+	if strings.TrimSpace(content) == "" {
+		return "", "", 0, ErrEmptyMessageContent
+	}
+
 	// Generate a message ID that matches the pattern ^[a-zA-Z0-9_-]{10,30}$
 	messageID, err := db.GenerateMessageID()
 	if err != nil {
-		return "", fmt.Errorf("error generating message ID: %w", err)
+		return "", "", 0, fmt.Errorf("error generating message ID: %w", err)
 	}
 
 	// Start a transaction
 	tx, err := db.c.Begin()
 	if err != nil {
-		return "", fmt.Errorf("error starting transaction: %w", err)
+		return "", "", 0, fmt.Errorf("error starting transaction: %w", err)
 	}
 
 	// Ensure transaction is rolled back if an error occurs
@@ -373,58 +667,92 @@ func (db *appdbimpl) AddMessage(conversationID, senderID, messageType, content s
 	var exists bool
 	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM conversations WHERE id = ?)", conversationID).Scan(&exists)
 	if err != nil {
-		return "", fmt.Errorf("error checking conversation existence: %w", err)
+		return "", "", 0, fmt.Errorf("error checking conversation existence: %w", err)
 	}
 	if !exists {
-		return "", ErrConversationNotFound
+		return "", "", 0, ErrConversationNotFound
+	}
+
+	if err := checkSlowMode(tx, conversationID, senderID); err != nil {
+		return "", "", 0, err
+	}
+	if err := restoreRemovedParticipant(tx, conversationID); err != nil {
+		return "", "", 0, err
+	}
+	if err := checkDirectMessageBlock(tx, conversationID, senderID); err != nil {
+		return "", "", 0, err
+	}
+
+	status, err := initialMessageStatus(tx, conversationID, senderID)
+	if err != nil {
+		return "", "", 0, err
+	}
+	seq, err := nextMessageSeq(tx, conversationID, status)
+	if err != nil {
+		return "", "", 0, err
 	}
 
 	// Get current time
-	now := time.Now()
+	now := nowUTC()
+	expiresAt, err := messageExpiry(tx, conversationID, now)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	// An empty parent isn't a reply, it's stored as NULL so that it doesn't break the foreign key
+	if parentMessageID != nil && *parentMessageID == "" {
+		parentMessageID = nil
+	}
 
 	// If this is a reply, validate that the parent message exists and is in the same conversation
-	if parentMessageID != nil && *parentMessageID != "" {
+	if parentMessageID != nil {
 		var parentExists bool
 		var parentConversationID string
 		err = tx.QueryRow(`
-			SELECT EXISTS(SELECT 1 FROM messages WHERE id = ?),
+			SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND type != ?),
 				   conversation_id
 			FROM messages
 			WHERE id = ?
-		`, *parentMessageID, *parentMessageID).Scan(&parentExists, &parentConversationID)
+		`, *parentMessageID, MessageTypeDeleted, *parentMessageID).Scan(&parentExists, &parentConversationID)
 
 		if err != nil {
-			return "", fmt.Errorf("error checking parent message: %w", err)
+			return "", "", 0, fmt.Errorf("error checking parent message: %w", err)
 		}
 
 		if !parentExists {
-			return "", ErrMessageNotFound
+			return "", "", 0, ErrMessageNotFound
 		}
 
 		if parentConversationID != conversationID {
-			return "", fmt.Errorf("parent message is not in the same conversation")
+			return "", "", 0, fmt.Errorf("parent message is not in the same conversation")
 		}
 	}
 
 	// Insert the message with content_type and parent_message_id
 	_, err = tx.Exec(`
-		INSERT INTO messages (id, conversation_id, sender_id, type, content, content_type, created_at, status, parent_message_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, messageID, conversationID, senderID, messageType, content, contentType, now, "delivered", parentMessageID)
+		INSERT INTO messages (
+			id, conversation_id, sender_id, type, content, content_type, created_at, status, parent_message_id, seq,
+			duration, expires_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, messageID, conversationID, senderID, messageType, content, contentType, now, status, parentMessageID, seq, sql.NullInt64{
+		Int64: int64(duration),
+		Valid: duration > 0,
+	}, expiresAt)
 
 	if err != nil {
-		return "", fmt.Errorf("error adding message: %w", err)
+		return "", "", 0, fmt.Errorf("error adding message: %w", err)
 	}
 
 	// Commit the transaction
 	if err = tx.Commit(); err != nil {
-		return "", fmt.Errorf("error committing transaction: %w", err)
+		return "", "", 0, fmt.Errorf("error committing transaction: %w", err)
 	}
 
 	// Set tx to nil to prevent rollback in defer function
 	tx = nil
 
-	return messageID, nil
+	return messageID, status, seq.Int64, nil
 }
 
 // Function to validate parent messages
@@ -434,11 +762,11 @@ func (db *appdbimpl) ValidateParentMessage(messageID, conversationID string) (bo
 	var msgConversationID string
 
 	err := db.c.QueryRow(`
-		SELECT EXISTS(SELECT 1 FROM messages WHERE id = ?),
+		SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND type != ?),
 			   conversation_id
 		FROM messages
 		WHERE id = ?
-	`, messageID, messageID).Scan(&exists, &msgConversationID)
+	`, messageID, MessageTypeDeleted, messageID).Scan(&exists, &msgConversationID)
 
 	if err != nil {
 		return false, fmt.Errorf("error checking message existence: %w", err)
@@ -493,14 +821,19 @@ func (db *appdbimpl) GetUserNameByID(userID string) (string, error) {
 	return username, nil
 }
 
-// Creates a unique message ID that matches the pattern ^[a-zA-Z0-9_-]{10,30}$
+// messageIDPattern is the pattern message IDs match
+var messageIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{10,30}$`)
+
+// Creates a unique message ID that matches messageIDPattern
 func (db *appdbimpl) GenerateMessageID() (string, error) {
 	// Try up to 10 times to generate a unique ID
 	for i := 0; i < 10; i++ {
-		// Generate a random number between 100000000 and 999999999999
-		// This will result in IDs between 11 and 15 characters long ("msg" + 8-12 digits)
-		randomNum := 100000000 + rand.Intn(999999999999-100000000)
-		candidateID := fmt.Sprintf("msg%d", randomNum)
+		// The bound doesn't fit in an int on 32 bit platforms, so the number is drawn as an int64. Zero padding gives
+		// IDs of a fixed 15 characters ("msg" + 12 digits)
+		candidateID := fmt.Sprintf("msg%012d", rand.Int63n(1_000_000_000_000))
+		if !messageIDPattern.MatchString(candidateID) {
+			return "", fmt.Errorf("generated message ID %q doesn't match the ID pattern", candidateID)
+		}
 
 		// Check if this ID already exists
 		var exists bool
@@ -519,11 +852,41 @@ func (db *appdbimpl) GenerateMessageID() (string, error) {
 	return "", fmt.Errorf("failed to generate a unique message ID after multiple attempts")
 }
 
+// commentIDPattern is the pattern interaction IDs match
+var commentIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{10,30}$`)
+
+// Creates a unique interaction ID for a reaction that matches commentIDPattern
+func (db *appdbimpl) GenerateCommentID() (string, error) {
+	// Try up to 10 times to generate a unique ID
+	for i := 0; i < 10; i++ {
+		// IDs are a fixed 15 characters ("int" + 12 digits), as message IDs
+		candidateID := fmt.Sprintf("int%012d", rand.Int63n(1_000_000_000_000))
+		if !commentIDPattern.MatchString(candidateID) {
+			return "", fmt.Errorf("generated interaction ID %q doesn't match the ID pattern", candidateID)
+		}
+
+		// Check if this ID already exists
+		var exists bool
+		err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM comments WHERE id = ?)", candidateID).Scan(&exists)
+		if err != nil {
+			return "", fmt.Errorf("error checking interaction ID existence: %w", err)
+		}
+
+		// If the ID doesn't exist, return it
+		if !exists {
+			return candidateID, nil
+		}
+	}
+
+	// If we couldn't generate a unique ID after 10 attempts, return an error
+	return "", fmt.Errorf("failed to generate a unique interaction ID after multiple attempts")
+}
+
 // Updated ForwardMessage function
 func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, userID string) (*ForwardedMessage, error) {
 	// Check if the original message exists
 	var originalMessageExists bool
-	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ?)", originalMessageID).Scan(&originalMessageExists)
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND type != ?)", originalMessageID, MessageTypeDeleted).Scan(&originalMessageExists)
 	if err != nil {
 		return nil, fmt.Errorf("error checking message existence: %w", err)
 	}
@@ -540,6 +903,10 @@ func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, use
 		return nil, ErrUnauthorized
 	}
 
+	if err := db.checkForwardingAllowed(originalMessageID); err != nil {
+		return nil, err
+	}
+
 	// Check if the target conversation exists
 	exists, err := db.ConversationExists(targetConversationID)
 	if err != nil {
@@ -575,10 +942,11 @@ func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, use
 		ContentType string
 		Timestamp   time.Time
 		Status      string
+		Duration    sql.NullInt64
 	}
 
 	err = tx.QueryRow(`
-		SELECT m.id, m.sender_id, u.name, m.type, m.content, m.content_type, m.created_at, m.status
+		SELECT m.id, m.sender_id, u.name, m.type, m.content, m.content_type, m.created_at, m.status, m.duration
 		FROM messages m
 		JOIN users u ON m.sender_id = u.id
 		WHERE m.id = ?
@@ -591,6 +959,7 @@ func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, use
 		&originalMessage.ContentType,
 		&originalMessage.Timestamp,
 		&originalMessage.Status,
+		&originalMessage.Duration,
 	)
 
 	if err != nil {
@@ -610,6 +979,25 @@ func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, use
 		return nil, ErrUnauthorized
 	}
 
+	if err := checkSlowMode(tx, targetConversationID, userID); err != nil {
+		return nil, err
+	}
+	if err := restoreRemovedParticipant(tx, targetConversationID); err != nil {
+		return nil, err
+	}
+	if err := checkDirectMessageBlock(tx, targetConversationID, userID); err != nil {
+		return nil, err
+	}
+
+	status, err := initialMessageStatus(tx, targetConversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := nextMessageSeq(tx, targetConversationID, status)
+	if err != nil {
+		return nil, err
+	}
+
 	// Generate a new message ID
 	newMessageID, err := db.GenerateMessageID()
 	if err != nil {
@@ -617,15 +1005,20 @@ func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, use
 	}
 
 	// Current time for the forwarded timestamp
-	now := time.Now()
+	now := nowUTC()
+	expiresAt, err := messageExpiry(tx, targetConversationID, now)
+	if err != nil {
+		return nil, err
+	}
 
 	// Insert the new forwarded message
 	_, err = tx.Exec(`
 		INSERT INTO messages (
 			id, conversation_id, sender_id, type, content, content_type,
-			created_at, status, is_forwarded, original_sender_id, original_timestamp
+			created_at, status, is_forwarded, original_sender_id, original_timestamp, original_message_id, seq, duration,
+			expires_at
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		newMessageID,
 		targetConversationID,
@@ -634,15 +1027,22 @@ func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, use
 		originalMessage.Content,
 		originalMessage.ContentType,
 		now,
-		"delivered",
+		status,
 		true,
 		originalMessage.SenderID,
 		originalMessage.Timestamp,
+		originalMessageID,
+		seq,
+		originalMessage.Duration,
+		expiresAt,
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("error inserting forwarded message: %w", err)
 	}
+	if err := copyLinkPreview(tx, originalMessageID, newMessageID); err != nil {
+		return nil, err
+	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
@@ -660,26 +1060,52 @@ func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, use
 		Content:     originalMessage.Content,
 		ContentType: originalMessage.ContentType,
 		Timestamp:   now,
-		Status:      "delivered",
+		Status:      status,
 		OriginalSender: User{
 			ID:   originalMessage.SenderID,
 			Name: originalMessage.SenderName,
 		},
 		OriginalTimestamp: originalMessage.Timestamp,
+		Seq:               seq.Int64,
 	}
 
 	return forwardedMessage, nil
 }
 
-// Checks if user is authorized to interact with message
+// checkForwardingAllowed returns ErrForwardingDisabled if the conversation of the message doesn't allow its messages
+// to be copied elsewhere
+func (db *appdbimpl) checkForwardingAllowed(messageID string) error {
+	var forwardingDisabled bool
+	err := db.c.QueryRow(`
+		SELECT c.forwarding_disabled
+		FROM messages m
+		JOIN conversations c ON m.conversation_id = c.id
+		WHERE m.id = ?
+	`, messageID).Scan(&forwardingDisabled)
+	if err != nil {
+		return fmt.Errorf("error checking forwarding restriction: %w", err)
+	}
+	if forwardingDisabled {
+		return ErrForwardingDisabled
+	}
+	return nil
+}
+
+// Checks if user is authorized to interact with message. Messages pending approval are only visible to their sender
+// and the group admins
 func (db *appdbimpl) IsUserAuthorized(userID string, messageID string) (bool, error) {
 	var count int
 	err := db.c.QueryRow(`
 		SELECT COUNT(*)
 		FROM messages m
 		JOIN user_conversations uc ON m.conversation_id = uc.conversation_id
-		WHERE m.id = ? AND uc.user_id = ?
-	`, messageID, userID).Scan(&count)
+		WHERE m.id = ? AND uc.user_id = ? AND (
+			m.status != ? OR m.sender_id = uc.user_id OR EXISTS(
+				SELECT 1 FROM group_members gm
+				WHERE gm.group_id = m.conversation_id AND gm.user_id = uc.user_id AND gm.role = ?
+			)
+		)
+	`, messageID, userID, MessageStatusPending, RoleAdmin).Scan(&count)
 
 	if err != nil {
 		return false, fmt.Errorf("error checking user authorization: %w", err)
@@ -699,7 +1125,13 @@ func (db *appdbimpl) ConversationExists(conversationID string) (bool, error) {
 }
 
 // Updated AddComment function to handle emoji reactions
-func (db *appdbimpl) AddComment(messageID, userID, content string) (*Comment, error) {
+func (db *appdbimpl) AddComment(messageID, userID, content string, allowSelfReaction bool) (*Comment, error) {
+	// Generate a unique interaction ID, only used if the user didn't react with this emoji yet
+	interactionID, err := db.GenerateCommentID()
+	if err != nil {
+		return nil, fmt.Errorf("error generating interaction ID: %w", err)
+	}
+
 	// Start a transaction
 	tx, err := db.c.Begin()
 	if err != nil {
@@ -717,14 +1149,14 @@ func (db *appdbimpl) AddComment(messageID, userID, content string) (*Comment, er
 	}()
 
 	// Check if the message exists
-	var exists bool
-	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ?)", messageID).Scan(&exists)
+	var senderID string
+	err = tx.QueryRow("SELECT sender_id FROM messages WHERE id = ? AND type != ?", messageID, MessageTypeDeleted).Scan(&senderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error checking message existence: %w", err)
 	}
-	if !exists {
-		return nil, ErrMessageNotFound
-	}
 
 	// Check if the user is authorized to comment on this message
 	isAuthorized, err := db.IsUserAuthorized(userID, messageID)
@@ -735,32 +1167,33 @@ func (db *appdbimpl) AddComment(messageID, userID, content string) (*Comment, er
 		return nil, ErrUnauthorized
 	}
 
-	// Generate a unique interaction ID that matches the pattern ^[a-zA-Z0-9_-]{10,30}$
-	interactionID := fmt.Sprintf("int%d", time.Now().UnixNano())
-	if len(interactionID) > 30 {
-		interactionID = interactionID[:30]
+	if !allowSelfReaction && senderID == userID {
+		return nil, ErrSelfReaction
+	}
+	if err := checkReactionAllowed(tx, messageID, content); err != nil {
+		return nil, err
 	}
 
-	timestamp := time.Now()
+	timestamp := nowUTC()
 
-	// Check if the user has already reacted to this message
+	// Users can add several different emoji to a message, check if the user already reacted with this one
 	var existingCommentID string
 	err = tx.QueryRow(`
 		SELECT id FROM comments
-		WHERE message_id = ? AND user_id = ?
-	`, messageID, userID).Scan(&existingCommentID)
+		WHERE message_id = ? AND user_id = ? AND content = ?
+	`, messageID, userID, content).Scan(&existingCommentID)
 
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return nil, fmt.Errorf("error checking existing reaction: %w", err)
 	}
 
 	if existingCommentID != "" {
-		// Update existing reaction
+		// Reacting again with the same emoji only refreshes the reaction
 		_, err = tx.Exec(`
 			UPDATE comments
-			SET content = ?, created_at = ?
+			SET created_at = ?
 			WHERE id = ?
-		`, content, timestamp, existingCommentID)
+		`, timestamp, existingCommentID)
 		if err != nil {
 			return nil, fmt.Errorf("error updating existing reaction: %w", err)
 		}
@@ -776,6 +1209,10 @@ func (db *appdbimpl) AddComment(messageID, userID, content string) (*Comment, er
 		}
 	}
 
+	if err = recordRecentEmoji(tx, userID, content, timestamp); err != nil {
+		return nil, err
+	}
+
 	// Commit the transaction
 	if err = tx.Commit(); err != nil {
 		return nil, fmt.Errorf("error committing transaction: %w", err)
@@ -881,7 +1318,8 @@ func (db *appdbimpl) UpdateMessageStatus(messageID, userID, newStatus string) (*
 	var conversationID string
 	var currentStatus string
 	var senderID string
-	err = tx.QueryRow("SELECT conversation_id, status, sender_id FROM messages WHERE id = ?", messageID).Scan(&conversationID, &currentStatus, &senderID)
+	var seq sql.NullInt64
+	err = tx.QueryRow("SELECT conversation_id, status, sender_id, seq FROM messages WHERE id = ?", messageID).Scan(&conversationID, &currentStatus, &senderID, &seq)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrMessageNotFound
@@ -904,8 +1342,13 @@ func (db *appdbimpl) UpdateMessageStatus(messageID, userID, newStatus string) (*
 		return nil, ErrUnauthorized
 	}
 
+	// Messages pending approval haven't been delivered to anyone yet
+	if currentStatus == MessageStatusPending {
+		return nil, ErrMessageNotFound
+	}
+
 	// Get the current time for updatedAt
-	updatedAt := time.Now()
+	updatedAt := nowUTC()
 
 	// Check if it's a group conversation
 	var isGroup bool
@@ -917,14 +1360,21 @@ func (db *appdbimpl) UpdateMessageStatus(messageID, userID, newStatus string) (*
 
 	// Update or insert the user's read status
 	_, err = tx.Exec(`
-		INSERT INTO message_read_status (message_id, user_id, status)
-		VALUES (?, ?, ?)
-		ON CONFLICT(message_id, user_id) DO UPDATE SET status = ?
-	`, messageID, userID, newStatus, newStatus)
+		INSERT INTO message_read_status (message_id, user_id, status, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(message_id, user_id) DO UPDATE SET status = excluded.status, updated_at = excluded.updated_at
+	`, messageID, userID, newStatus, updatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("error updating user read status: %w", err)
 	}
 
+	// Reading a message also reads everything before it
+	if newStatus == "read" && seq.Valid {
+		if err = advanceReadCursor(tx, conversationID, userID, seq.Int64); err != nil {
+			return nil, err
+		}
+	}
+
 	// Determine the overall message status
 	var overallStatus string
 	if isGroup {
@@ -987,6 +1437,72 @@ func (db *appdbimpl) UpdateMessageStatus(messageID, userID, newStatus string) (*
 	return statusUpdate, nil
 }
 
+// GetMessageReceipts returns the delivery and read state of a message for each participant of its conversation other
+// than the sender. Only the sender of the message can see them, unless the view lets any participant see them
+func (db *appdbimpl) GetMessageReceipts(messageID, userID string, view ReceiptsView) ([]MessageReceipt, error) {
+	var conversationID, senderID, status string
+	err := db.c.QueryRow("SELECT conversation_id, sender_id, status FROM messages WHERE id = ?", messageID).Scan(
+		&conversationID, &senderID, &status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("error fetching message: %w", err)
+	}
+	if senderID != userID {
+		if !view.AnyParticipant {
+			return nil, ErrUnauthorized
+		}
+		isParticipant, err := db.IsUserInConversation(userID, conversationID)
+		if err != nil {
+			return nil, err
+		}
+		if !isParticipant {
+			return nil, ErrUnauthorized
+		}
+		// Messages pending approval are only visible to their sender
+		if status == "pending" {
+			return nil, ErrMessageNotFound
+		}
+	}
+
+	unreported := view.Unreported
+	if unreported == "" {
+		unreported = "sent"
+	}
+
+	rows, err := db.c.Query(`
+		SELECT u.id, u.name, COALESCE(rs.status, ?), rs.updated_at
+		FROM user_conversations uc
+		JOIN users u ON uc.user_id = u.id
+		LEFT JOIN message_read_status rs ON rs.message_id = ? AND rs.user_id = uc.user_id
+		WHERE uc.conversation_id = ? AND uc.user_id != ?
+		ORDER BY u.name
+	`, unreported, messageID, conversationID, senderID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying message receipts: %w", err)
+	}
+	defer rows.Close()
+
+	var receipts []MessageReceipt
+	for rows.Next() {
+		var receipt MessageReceipt
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&receipt.User.ID, &receipt.User.Name, &receipt.Status, &updatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning message receipt: %w", err)
+		}
+		if updatedAt.Valid {
+			receipt.UpdatedAt = &updatedAt.Time
+		}
+		receipts = append(receipts, receipt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating message receipts: %w", err)
+	}
+
+	return receipts, nil
+}
+
 // Message deletion query
 func (db *appdbimpl) DeleteMessage(messageID, userID string) (*Message, string, error) {
 	var messageToDelete Message
@@ -1038,6 +1554,11 @@ func (db *appdbimpl) DeleteMessage(messageID, userID string) (*Message, string,
 		messageToDelete.Icon = ""
 	}
 
+	// Deleted messages stay as tombstones, which can't be deleted again
+	if messageToDelete.Type == MessageTypeDeleted {
+		return nil, "", ErrMessageNotFound
+	}
+
 	// Check if the user is the sender of the message
 	if messageToDelete.SenderID != userID {
 		return nil, "", ErrUnauthorized
@@ -1049,8 +1570,30 @@ func (db *appdbimpl) DeleteMessage(messageID, userID string) (*Message, string,
 		return nil, "", fmt.Errorf("error deleting reactions: %w", err)
 	}
 
-	// Delete the message
-	result, err := tx.Exec("DELETE FROM messages WHERE id = ?", messageID)
+	// Delete flags on the message
+	_, err = tx.Exec("DELETE FROM flagged_messages WHERE message_id = ?", messageID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error deleting flags: %w", err)
+	}
+
+	// Delete the mentions, a tombstone mentions nobody
+	_, err = tx.Exec("DELETE FROM message_mentions WHERE message_id = ?", messageID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error deleting mentions: %w", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM link_previews WHERE message_id = ?", messageID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error deleting link preview: %w", err)
+	}
+
+	// Replace the message with a tombstone, so that replies keep their parent. A photo or recording is left to the
+	// orphan media cleanup once nothing refers to it anymore
+	messageToDelete.DeletedAt = nowUTC()
+	result, err := tx.Exec(`
+		UPDATE messages SET type = ?, content = '', content_type = NULL, icon = NULL, duration = NULL, deleted_at = ?
+		WHERE id = ?
+	`, MessageTypeDeleted, messageToDelete.DeletedAt, messageID)
 	if err != nil {
 		return nil, "", fmt.Errorf("error deleting message: %w", err)
 	}
@@ -1076,63 +1619,26 @@ func (db *appdbimpl) DeleteMessage(messageID, userID string) (*Message, string,
 }
 
 func (db *appdbimpl) GetMessageByID(messageID string) (*Message, error) {
-	query := `
-		SELECT m.id, m.sender_id, u.name AS sender, m.type, m.content, m.icon, m.created_at, m.status
-		FROM messages m
-		JOIN users u ON m.sender_id = u.id
-		WHERE m.id = ?
-	`
-	var msg Message
-	var icon sql.NullString
-	err := db.c.QueryRow(query, messageID).Scan(
-		&msg.ID, &msg.SenderID, &msg.Sender, &msg.Type, &msg.Content, &icon, &msg.Timestamp, &msg.Status,
-	)
+	messages, err := db.queryMessages(selectMessagesQuery+" WHERE m.id = ? AND "+notExpiredCondition, messageID, nowUTC())
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrMessageNotFound
-		}
-		return nil, fmt.Errorf("error fetching message: %w", err)
+		return nil, err
 	}
-
-	// Set the Icon field based on the sql.NullString value
-	if icon.Valid {
-		msg.Icon = icon.String
-	} else {
-		msg.Icon = "" // or set a default value if preferred
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
 	}
+	msg := messages[0]
 
 	// Fetch comments for the message
-	commentsQuery := `
-		SELECT c.id, c.message_id, c.user_id, u.name AS username, c.content, c.created_at
-		FROM comments c
-		JOIN users u ON c.user_id = u.id
-		WHERE c.message_id = ?
-		ORDER BY c.created_at ASC
-	`
-	rows, err := db.c.Query(commentsQuery, messageID)
+	msg.Comments, err = db.GetComments(messageID)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching comments: %w", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var comment Comment
-		err := rows.Scan(&comment.ID, &comment.MessageID, &comment.UserID, &comment.Username, &comment.Content, &comment.Timestamp)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning comment: %w", err)
-		}
-		msg.Comments = append(msg.Comments, comment)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating comments rows: %w", err)
+		return nil, err
 	}
 
 	return &msg, nil
 }
 
-// Query to retireve conversation details
-func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*ConversationDetails, error) {
+// GetConversationInfo returns the details of a conversation the user participates in, without its messages
+func (db *appdbimpl) GetConversationInfo(conversationID, userID string) (*ConversationDetails, error) {
 	// Start a transaction
 	tx, err := db.c.Begin()
 	if err != nil {
@@ -1162,11 +1668,13 @@ func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*Con
 	// Get conversation details
 	var details ConversationDetails
 	var profilePhoto sql.NullString
+	var allowedReactions string
 	var createdAt time.Time
 	var isGroup bool
 
 	err = tx.QueryRow(`
-		SELECT id, title, is_group, profile_photo, created_at
+		SELECT id, COALESCE(title, ''), is_group, profile_photo, created_at, slow_mode_seconds, forwarding_disabled,
+			approval_required, allowed_reactions, message_ttl_seconds
 		FROM conversations
 		WHERE id = ?
 	`, conversationID).Scan(
@@ -1175,6 +1683,11 @@ func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*Con
 		&isGroup,
 		&profilePhoto,
 		&createdAt,
+		&details.Settings.SlowModeSeconds,
+		&details.Settings.ForwardingDisabled,
+		&details.Settings.ApprovalRequired,
+		&allowedReactions,
+		&details.MessageTTLSeconds,
 	)
 
 	if err != nil {
@@ -1186,10 +1699,23 @@ func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*Con
 
 	details.CreatedAt = createdAt
 	details.IsGroup = isGroup
+	details.Settings.AllowedReactions, err = decodeAllowedReactions(allowedReactions)
+	if err != nil {
+		return nil, err
+	}
 	if profilePhoto.Valid {
 		details.ProfilePhoto = profilePhoto.String
 	}
 
+	// The theme and read cursor are the user's own, other participants see theirs
+	var theme sql.NullString
+	err = tx.QueryRow("SELECT theme, last_read_seq FROM conversation_settings WHERE user_id = ? AND conversation_id = ?",
+		userID, conversationID).Scan(&theme, &details.LastReadSeq)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error fetching conversation settings: %w", err)
+	}
+	details.Theme = theme.String
+
 	// For 1-on-1 convos use other participants name as title
 	if !isGroup {
 		var otherUserName string
@@ -1208,7 +1734,7 @@ func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*Con
 
 	// Get participants
 	rows, err := tx.Query(`
-		SELECT u.id, u.name, u.photo_id
+		SELECT u.id, u.name, u.photo_id, u.bio
 		FROM users u
 		JOIN user_conversations uc ON u.id = uc.user_id
 		WHERE uc.conversation_id = ?
@@ -1224,7 +1750,7 @@ func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*Con
 		var participant Participant
 		var photoID sql.NullString
 
-		if err := rows.Scan(&participant.ID, &participant.Name, &photoID); err != nil {
+		if err := rows.Scan(&participant.ID, &participant.Name, &photoID, &participant.Bio); err != nil {
 			return nil, fmt.Errorf("error scanning participant: %w", err)
 		}
 
@@ -1240,41 +1766,237 @@ func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*Con
 		return nil, fmt.Errorf("error iterating participants: %w", err)
 	}
 
-	// Get messages
-	rows, err = tx.Query(`
-		SELECT
-			m.id,
-			m.sender_id,
-			u.name,
-			m.type,
-			m.content,
-			m.content_type,
-			m.icon,
-			m.created_at,
-			m.status,
-			m.parent_message_id,
-			m.is_forwarded,
-			m.original_sender_id,
-			m.original_timestamp
-		FROM messages m
-		JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = ?
-		ORDER BY m.created_at DESC
-	`, conversationID)
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
 
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return &details, nil
+}
+
+// GetConversationDetails returns the details of a conversation the user participates in, with the messages selected
+// by page newest first
+func (db *appdbimpl) GetConversationDetails(conversationID, userID string, page MessagePage) (*ConversationDetails, error) {
+	details, err := db.GetConversationInfo(conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if page.UnreadOnly {
+		now := nowUTC()
+		var firstUnreadID sql.NullString
+		err = db.c.QueryRow(`
+			SELECT COUNT(*), (
+				SELECT id FROM messages
+				WHERE conversation_id = ? AND seq > ? AND sender_id != ? AND (expires_at IS NULL OR expires_at > ?)
+				ORDER BY seq
+				LIMIT 1
+			)
+			FROM messages
+			WHERE conversation_id = ? AND seq > ? AND sender_id != ? AND (expires_at IS NULL OR expires_at > ?)
+		`, conversationID, details.LastReadSeq, userID, now, conversationID, details.LastReadSeq, userID, now).Scan(
+			&details.UnreadCount, &firstUnreadID)
+		if err != nil {
+			return nil, fmt.Errorf("error counting unread messages: %w", err)
+		}
+		details.FirstUnreadMessageID = firstUnreadID.String
+	}
+
+	if page.Limit <= 0 && page.Offset <= 0 && page.Before == nil && !page.UnreadOnly {
+		details.Messages = []Message{}
+		err = db.ForEachMessage(conversationID, userID, false, func(msg Message) error {
+			details.Messages = append(details.Messages, msg)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return details, nil
+	}
+
+	isAdmin, err := db.IsGroupAdmin(conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := selectMessagesQuery + " WHERE " + visibleMessagesCondition
+	args := []interface{}{conversationID, MessageStatusPending, userID, isAdmin, nowUTC()}
+	if page.Before != nil {
+		query += " AND m.created_at < ?"
+		args = append(args, page.Before.UTC())
+	}
+	if page.UnreadOnly {
+		query += " AND m.seq > ?"
+		args = append(args, details.LastReadSeq)
+	}
+	// Fetch one more message than asked to know whether there are more, a negative limit means no limit to SQLite
+	limit := -1
+	if page.Limit > 0 {
+		limit = page.Limit + 1
+	}
+	query += " ORDER BY m.created_at DESC, m.id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, page.Offset)
+
+	messages, err := db.queryMessages(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if page.Limit > 0 && len(messages) > page.Limit {
+		messages = messages[:page.Limit]
+		details.HasMoreMessages = true
+	}
+
+	for i := range messages {
+		reactions, err := db.GetComments(messages[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching reactions: %w", err)
+		}
+		messages[i].Comments = reactions
+	}
+	details.Messages = messages
+	if details.Messages == nil {
+		details.Messages = []Message{}
+	}
+
+	return details, nil
+}
+
+// messageBatchSize is the number of messages ForEachMessage loads at a time
+const messageBatchSize = 200
+
+// ForEachMessage calls fn for each message of a conversation visible to the viewer, with its reactions, either oldest
+// or newest first. The messages are loaded in batches, so that memory use stays bounded and no query is kept open while
+// fn runs. It stops at the first error returned by fn. It doesn't check the participation of the viewer, callers are
+// expected to
+func (db *appdbimpl) ForEachMessage(conversationID, viewerID string, oldestFirst bool, fn func(Message) error) error {
+	order, after := "DESC", "<"
+	if oldestFirst {
+		order, after = "ASC", ">"
+	}
+
+	// Messages pending approval are only shown to their sender and the group admins
+	isAdmin, err := db.IsGroupAdmin(conversationID, viewerID)
+	if err != nil {
+		return err
+	}
+
+	var lastTimestamp time.Time
+	var lastID string
+	for {
+		// Continue after the last message of the previous batch
+		query := selectMessagesQuery + " WHERE " + visibleMessagesCondition
+		args := []interface{}{conversationID, MessageStatusPending, viewerID, isAdmin, nowUTC()}
+		if lastID != "" {
+			query += " AND (m.created_at " + after + " ? OR (m.created_at = ? AND m.id " + after + " ?))"
+			args = append(args, lastTimestamp, lastTimestamp, lastID)
+		}
+		query += " ORDER BY m.created_at " + order + ", m.id " + order + " LIMIT ?"
+		args = append(args, messageBatchSize)
+
+		batch, err := db.queryMessages(query, args...)
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range batch {
+			// Fetch reactions for this message
+			reactions, err := db.GetComments(msg.ID)
+			if err != nil {
+				return fmt.Errorf("error fetching reactions: %w", err)
+			}
+			msg.Comments = reactions
+
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < messageBatchSize {
+			return nil
+		}
+		lastTimestamp = batch[len(batch)-1].Timestamp
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// selectMessagesQuery selects the columns scanned by queryMessages, callers append the conditions and the ordering.
+// The message replied to is left out when it is pending or expired, which takes the current time, passed first by
+// queryMessages
+const selectMessagesQuery = `
+	SELECT
+		m.id,
+		m.sender_id,
+		u.name,
+		m.type,
+		m.content,
+		m.content_type,
+		m.icon,
+		m.created_at,
+		m.status,
+		m.parent_message_id,
+		m.is_forwarded,
+		m.original_sender_id,
+		os.name,
+		m.original_timestamp,
+		m.seq,
+		m.deleted_at,
+		m.duration,
+		m.expires_at,
+		lp.url,
+		lp.title,
+		lp.description,
+		lp.image_url,
+		lp.site_name,
+		pm.sender_id,
+		pu.name,
+		pm.type,
+		pm.content
+	FROM messages m
+	JOIN users u ON m.sender_id = u.id
+	LEFT JOIN users os ON m.original_sender_id = os.id
+	LEFT JOIN link_previews lp ON lp.message_id = m.id
+	LEFT JOIN messages pm ON m.parent_message_id = pm.id AND pm.status != '` + MessageStatusPending + `'
+		AND (pm.expires_at IS NULL OR pm.expires_at > ?)
+	LEFT JOIN users pu ON pm.sender_id = pu.id`
+
+// visibleMessagesCondition selects the messages of a conversation a viewer can see. Messages pending approval are only
+// visible to their sender and the group admins, and expired messages are hidden until the sweeper deletes them. It
+// takes the conversation ID, MessageStatusPending, the viewer ID, whether the viewer is a group admin and the current
+// time
+const visibleMessagesCondition = "m.conversation_id = ? AND (m.status != ? OR m.sender_id = ? OR ?) AND " +
+	notExpiredCondition
+
+// notExpiredCondition selects the messages that haven't expired yet, which are still stored until the sweeper deletes
+// them. It takes the current time
+const notExpiredCondition = "(m.expires_at IS NULL OR m.expires_at > ?)"
+
+// queryMessages runs a query built on selectMessagesQuery and scans the resulting messages. The args are those of the
+// conditions appended to selectMessagesQuery
+func (db *appdbimpl) queryMessages(query string, args ...interface{}) ([]Message, error) {
+	rows, err := db.c.Query(query, append([]interface{}{nowUTC()}, args...)...)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching messages: %w", err)
 	}
 	defer rows.Close()
 
-	details.Messages = []Message{}
+	var messages []Message
 	for rows.Next() {
 		var msg Message
 		var icon sql.NullString
 		var parentMessageID sql.NullString
 		var originalSenderID sql.NullString
+		var originalSenderName sql.NullString
 		var originalTimestamp sql.NullTime
 		var contentType sql.NullString
+		var seq sql.NullInt64
+		var deletedAt sql.NullTime
+		var duration sql.NullInt64
+		var expiresAt sql.NullTime
+		var previewURL, previewTitle, previewDescription, previewImageURL, previewSiteName sql.NullString
+		var parentSenderID, parentSenderName, parentType, parentContent sql.NullString
 
 		if err := rows.Scan(
 			&msg.ID,
@@ -1289,10 +2011,37 @@ func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*Con
 			&parentMessageID,
 			&msg.IsForwarded,
 			&originalSenderID,
+			&originalSenderName,
 			&originalTimestamp,
+			&seq,
+			&deletedAt,
+			&duration,
+			&expiresAt,
+			&previewURL,
+			&previewTitle,
+			&previewDescription,
+			&previewImageURL,
+			&previewSiteName,
+			&parentSenderID,
+			&parentSenderName,
+			&parentType,
+			&parentContent,
 		); err != nil {
 			return nil, fmt.Errorf("error scanning message: %w", err)
 		}
+		msg.Seq = seq.Int64
+		msg.DeletedAt = deletedAt.Time
+		msg.Duration = int(duration.Int64)
+		msg.ExpiresAt = expiresAt.Time
+		if previewURL.Valid {
+			msg.LinkPreview = &LinkPreview{
+				URL:         previewURL.String,
+				Title:       previewTitle.String,
+				Description: previewDescription.String,
+				ImageURL:    previewImageURL.String,
+				SiteName:    previewSiteName.String,
+			}
+		}
 
 		// Handle NULL values
 		if icon.Valid {
@@ -1306,29 +2055,29 @@ func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*Con
 		if parentMessageID.Valid {
 			pmID := parentMessageID.String
 			msg.ParentMessageID = &pmID
-		}
 
-		// Handle forwarded message details
-		if msg.IsForwarded && originalSenderID.Valid && originalTimestamp.Valid {
-			var originalSenderName string
-			err = tx.QueryRow("SELECT name FROM users WHERE id = ?", originalSenderID.String).Scan(&originalSenderName)
-			if err == nil {
-				msg.OriginalSender = &User{
-					ID:   originalSenderID.String,
-					Name: originalSenderName,
+			// The parent is left out while it is pending approval
+			if parentSenderName.Valid {
+				msg.Parent = &QuotedMessage{
+					ID:       pmID,
+					SenderID: parentSenderID.String,
+					Sender:   parentSenderName.String,
+					Type:     parentType.String,
+					Content:  parentContent.String,
 				}
-				msg.OriginalTimestamp = originalTimestamp.Time
 			}
 		}
 
-		// Fetch reactions for this message
-		reactions, err := db.GetComments(msg.ID)
-		if err != nil {
-			return nil, fmt.Errorf("error fetching reactions: %w", err)
+		// Handle forwarded message details
+		if msg.IsForwarded && originalSenderName.Valid && originalTimestamp.Valid {
+			msg.OriginalSender = &User{
+				ID:   originalSenderID.String,
+				Name: originalSenderName.String,
+			}
+			msg.OriginalTimestamp = originalTimestamp.Time
 		}
-		msg.Comments = reactions
 
-		details.Messages = append(details.Messages, msg)
+		messages = append(messages, msg)
 	}
 
 	// Check for errors from iterating over rows
@@ -1336,15 +2085,41 @@ func (db *appdbimpl) GetConversationDetails(conversationID, userID string) (*Con
 		return nil, fmt.Errorf("error iterating messages: %w", err)
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("error committing transaction: %w", err)
+	return messages, nil
+}
+
+// Retrieves the participants of a conversation, ordered by name
+func (db *appdbimpl) GetConversationParticipants(conversationID string) ([]Participant, error) {
+	rows, err := db.c.Query(`
+		SELECT u.id, u.name, u.photo_id, u.bio
+		FROM users u
+		JOIN user_conversations uc ON u.id = uc.user_id
+		WHERE uc.conversation_id = ?
+		ORDER BY u.name
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching participants: %w", err)
 	}
+	defer rows.Close()
 
-	// Set tx to nil to prevent rollback in defer function
-	tx = nil
+	participants := []Participant{}
+	for rows.Next() {
+		var participant Participant
+		var photoID sql.NullString
+		if err := rows.Scan(&participant.ID, &participant.Name, &photoID, &participant.Bio); err != nil {
+			return nil, fmt.Errorf("error scanning participant: %w", err)
+		}
+		if photoID.Valid {
+			participant.PhotoID = photoID.String
+		}
+		participants = append(participants, participant)
+	}
 
-	return &details, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating participants: %w", err)
+	}
+
+	return participants, nil
 }
 
 // Called in conversation details to retrieve comments
@@ -0,0 +1,532 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gerdalukosiute/WASAText/service/globaltime"
+)
+
+func TestGetUserConversationsUntitledGroup(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	carol := newTestUser(t, db, "carol")
+	dave := newTestUser(t, db, "dave")
+
+	untitled, err := db.StartConversation(alice, []string{dave, carol, bob}, "", true)
+	if err != nil {
+		t.Fatalf("creating the untitled group: %v", err)
+	}
+	titled, err := db.StartConversation(alice, []string{bob, carol}, "Friends", true)
+	if err != nil {
+		t.Fatalf("creating the titled group: %v", err)
+	}
+
+	tests := []struct {
+		userID string
+		want   []string
+	}{
+		{alice, []string{"bob", "carol"}},
+		{bob, []string{"alice", "carol"}},
+		{dave, []string{"alice", "bob"}},
+	}
+	for _, tt := range tests {
+		conversations, _, err := db.GetUserConversations(tt.userID, ConversationFilter{})
+		if err != nil {
+			t.Fatalf("GetUserConversations: %v", err)
+		}
+		for _, conv := range conversations {
+			switch conv.ID {
+			case untitled:
+				if !reflect.DeepEqual(conv.OtherParticipantNames, tt.want) {
+					t.Errorf("names seen by %s = %v, want %v", tt.userID, conv.OtherParticipantNames, tt.want)
+				}
+				if conv.ParticipantCount != 4 {
+					t.Errorf("participant count = %d, want 4", conv.ParticipantCount)
+				}
+			case titled:
+				if conv.OtherParticipantNames != nil {
+					t.Errorf("titled group has names %v", conv.OtherParticipantNames)
+				}
+			}
+		}
+	}
+}
+
+func TestAddMessageEmptyContent(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	conversationID, err := db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	for _, messageType := range []string{"text", "photo", "audio", "file", "location"} {
+		for _, content := range []string{"", "  \n\t"} {
+			_, _, _, err := db.AddMessage(conversationID, alice, messageType, content, "", nil, 0)
+			if !errors.Is(err, ErrEmptyMessageContent) {
+				t.Errorf("AddMessage(%s, %q) = %v, want ErrEmptyMessageContent", messageType, content, err)
+			}
+		}
+	}
+
+	details, err := db.GetConversationDetails(conversationID, alice, MessagePage{})
+	if err != nil {
+		t.Fatalf("GetConversationDetails: %v", err)
+	}
+	if len(details.Messages) != 0 {
+		t.Errorf("%d messages stored, want none", len(details.Messages))
+	}
+}
+
+func TestMessagesOrderAcrossDSTChange(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	// Run with a local time zone that has daylight saving time, so that any timestamp stored in local time shows
+	previousLocal := time.Local
+	time.Local = rome
+	t.Cleanup(func() {
+		time.Local = previousLocal
+		globaltime.FixedTime = time.Time{}
+	})
+
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	conversationID, err := db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	// Clocks in Rome go back from 03:00 CEST to 02:00 CET on 25 October 2026, so the second message is sent 40
+	// minutes after the first one at an earlier wall clock time
+	first := time.Date(2026, time.October, 25, 0, 30, 0, 0, time.UTC).In(rome)
+	sendTimes := []time.Time{first, first.Add(40 * time.Minute), first.Add(2 * time.Hour)}
+	if sendTimes[0].Hour() != 2 || sendTimes[1].Hour() != 2 || sendTimes[1].Minute() != 10 {
+		t.Fatalf("unexpected wall clock times %v and %v around the change", sendTimes[0], sendTimes[1])
+	}
+
+	var ids []string
+	for i, sentAt := range sendTimes {
+		globaltime.FixedTime = sentAt
+		id, _, _, err := db.AddMessage(conversationID, alice, "text", "message", "text/plain", nil, 0)
+		if err != nil {
+			t.Fatalf("AddMessage %d: %v", i, err)
+		}
+		ids = append(ids, id)
+	}
+	globaltime.FixedTime = sendTimes[len(sendTimes)-1].Add(time.Minute)
+
+	// Conversation details list the messages newest first
+	details, err := db.GetConversationDetails(conversationID, bob, MessagePage{})
+	if err != nil {
+		t.Fatalf("GetConversationDetails: %v", err)
+	}
+	if len(details.Messages) != len(ids) {
+		t.Fatalf("%d messages, want %d", len(details.Messages), len(ids))
+	}
+	for i, m := range details.Messages {
+		want := len(ids) - 1 - i
+		if m.ID != ids[want] {
+			t.Errorf("message %d is %s, want %s", i, m.ID, ids[want])
+		}
+		if m.Timestamp.Location() != time.UTC {
+			t.Errorf("timestamp %v isn't in UTC", m.Timestamp)
+		}
+		if !m.Timestamp.Equal(sendTimes[want]) {
+			t.Errorf("timestamp %v, want %v", m.Timestamp, sendTimes[want].UTC())
+		}
+	}
+
+	// Paging by time keeps the messages sent before the change
+	before := sendTimes[1]
+	details, err = db.GetConversationDetails(conversationID, bob, MessagePage{Before: &before})
+	if err != nil {
+		t.Fatalf("GetConversationDetails: %v", err)
+	}
+	if len(details.Messages) != 1 || details.Messages[0].ID != ids[0] {
+		t.Errorf("messages before %v: got %d, want only the first one", before, len(details.Messages))
+	}
+}
+
+// orphanQueries count the rows left pointing to a conversation or a message that no longer exists
+var orphanQueries = map[string]string{
+	"messages":              "SELECT COUNT(*) FROM messages WHERE conversation_id NOT IN (SELECT id FROM conversations)",
+	"user_conversations":    "SELECT COUNT(*) FROM user_conversations WHERE conversation_id NOT IN (SELECT id FROM conversations)",
+	"conversation_settings": "SELECT COUNT(*) FROM conversation_settings WHERE conversation_id NOT IN (SELECT id FROM conversations)",
+	"group_members":         "SELECT COUNT(*) FROM group_members WHERE group_id NOT IN (SELECT id FROM conversations)",
+	"group_events":          "SELECT COUNT(*) FROM group_events WHERE group_id NOT IN (SELECT id FROM conversations)",
+	"comments":              "SELECT COUNT(*) FROM comments WHERE message_id NOT IN (SELECT id FROM messages)",
+	"message_read_status":   "SELECT COUNT(*) FROM message_read_status WHERE message_id NOT IN (SELECT id FROM messages)",
+	"flagged_messages":      "SELECT COUNT(*) FROM flagged_messages WHERE message_id NOT IN (SELECT id FROM messages)",
+	"message_mentions":      "SELECT COUNT(*) FROM message_mentions WHERE message_id NOT IN (SELECT id FROM messages)",
+	"link_previews":         "SELECT COUNT(*) FROM link_previews WHERE message_id NOT IN (SELECT id FROM messages)",
+}
+
+// fillConversation adds messages to a conversation along with the rows that hang off them: reactions, replies, read
+// receipts, flags, mentions, link previews and read cursors
+func fillConversation(t *testing.T, db AppDatabase, conversationID, senderID, readerID string) {
+	t.Helper()
+	messageID, _, _, err := db.AddMessage(conversationID, senderID, "text", "see https://example.com @bob", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	if _, _, _, err := db.AddMessage(conversationID, readerID, "text", "reply", "text/plain", &messageID, 0); err != nil {
+		t.Fatalf("adding a reply: %v", err)
+	}
+	if _, err := db.AddComment(messageID, readerID, "👍", true); err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+	if _, err := db.UpdateMessageStatus(messageID, readerID, "read"); err != nil {
+		t.Fatalf("UpdateMessageStatus: %v", err)
+	}
+	if err := db.FlagMessage(messageID, readerID, nil); err != nil {
+		t.Fatalf("FlagMessage: %v", err)
+	}
+	if _, err := db.AddMentions(messageID, []string{"bob"}); err != nil {
+		t.Fatalf("AddMentions: %v", err)
+	}
+	if err := db.SetLinkPreview(messageID, LinkPreview{URL: "https://example.com", Title: "Example"}); err != nil {
+		t.Fatalf("SetLinkPreview: %v", err)
+	}
+	if _, err := db.MarkConversationRead(conversationID, readerID); err != nil {
+		t.Fatalf("MarkConversationRead: %v", err)
+	}
+}
+
+// expectNoOrphans fails the test when rows are left pointing to deleted conversations or messages
+func expectNoOrphans(t *testing.T, db AppDatabase) {
+	t.Helper()
+	for table, query := range orphanQueries {
+		var count int
+		if err := db.(*appdbimpl).c.QueryRow(query).Scan(&count); err != nil {
+			t.Fatalf("counting orphaned %s: %v", table, err)
+		}
+		if count != 0 {
+			t.Errorf("%d orphaned rows in %s", count, table)
+		}
+	}
+}
+
+func TestDeleteConversationLeavesNoOrphans(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	conversationID, err := db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	fillConversation(t, db, conversationID, alice, bob)
+	for _, table := range []string{"comments", "message_read_status", "flagged_messages", "message_mentions", "link_previews", "conversation_settings"} {
+		var count int
+		if err := db.(*appdbimpl).c.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil || count == 0 {
+			t.Fatalf("no rows in %s before deleting: %v", table, err)
+		}
+	}
+
+	fullyDeleted, err := db.DeleteConversationForUser(alice, conversationID)
+	if err != nil || fullyDeleted {
+		t.Fatalf("first participant deleting: got %v, %v, want the conversation kept", fullyDeleted, err)
+	}
+	expectNoOrphans(t, db)
+
+	fullyDeleted, err = db.DeleteConversationForUser(bob, conversationID)
+	if err != nil || !fullyDeleted {
+		t.Fatalf("last participant deleting: got %v, %v, want the conversation deleted", fullyDeleted, err)
+	}
+	if exists, err := db.ConversationExists(conversationID); err != nil || exists {
+		t.Errorf("conversation still exists: %v, %v", exists, err)
+	}
+	expectNoOrphans(t, db)
+}
+
+func TestDeleteGroupLeavesNoOrphans(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	groupID, err := db.StartConversation(alice, []string{bob}, "Group", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	fillConversation(t, db, groupID, alice, bob)
+
+	if _, deleted, _, err := db.LeaveGroup(groupID, alice); err != nil || deleted {
+		t.Fatalf("first member leaving: got %v, %v, want the group kept", deleted, err)
+	}
+	if _, deleted, _, err := db.LeaveGroup(groupID, bob); err != nil || !deleted {
+		t.Fatalf("last member leaving: got %v, %v, want the group deleted", deleted, err)
+	}
+	expectNoOrphans(t, db)
+}
+
+func TestGenerateConversationID(t *testing.T) {
+	db := newTestDB(t)
+	for i := 0; i < 10000; i++ {
+		id, err := db.GenerateConversationID()
+		if err != nil {
+			t.Fatalf("GenerateConversationID: %v", err)
+		}
+		if !conversationIDPattern.MatchString(id) {
+			t.Fatalf("conversation ID %q doesn't match %s", id, conversationIDPattern)
+		}
+	}
+}
+
+func TestGenerateMessageID(t *testing.T) {
+	db := newTestDB(t)
+
+	// Uniqueness is only checked against the stored messages, the sample is small enough for the random IDs not to
+	// collide in practice
+	seen := make(map[string]bool)
+	for i := 0; i < 5000; i++ {
+		id, err := db.GenerateMessageID()
+		if err != nil {
+			t.Fatalf("GenerateMessageID: %v", err)
+		}
+		if !messageIDPattern.MatchString(id) || len(id) != 15 {
+			t.Fatalf("message ID %q doesn't have the expected format", id)
+		}
+		if seen[id] {
+			t.Fatalf("message ID %q generated twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestAddCommentConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	const members = 20
+	admin := newTestUser(t, db, "alice")
+	userIDs := make([]string, members)
+	for i := range userIDs {
+		userIDs[i] = newTestUser(t, db, fmt.Sprintf("user%d", i))
+	}
+	groupID, err := db.StartConversation(admin, userIDs, "Busy", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	messageID, _, _, err := db.AddMessage(groupID, admin, "text", "react to this", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	// Every member reacts with two emoji at the same time
+	emoji := []string{"👍", "🎉"}
+	var wg sync.WaitGroup
+	comments := make([]*Comment, members*len(emoji))
+	errs := make([]error, len(comments))
+	for i := range comments {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			comments[i], errs[i] = db.AddComment(messageID, userIDs[i/len(emoji)], emoji[i%len(emoji)], true)
+		}(i)
+	}
+	wg.Wait()
+
+	ids := make(map[string]bool)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("reaction %d: %v", i, err)
+		}
+		if !commentIDPattern.MatchString(comments[i].ID) {
+			t.Errorf("interaction ID %q doesn't match %s", comments[i].ID, commentIDPattern)
+		}
+		if ids[comments[i].ID] {
+			t.Errorf("interaction ID %q used twice", comments[i].ID)
+		}
+		ids[comments[i].ID] = true
+	}
+
+	stored, err := db.GetComments(messageID)
+	if err != nil {
+		t.Fatalf("GetComments: %v", err)
+	}
+	if len(stored) != len(comments) {
+		t.Errorf("%d reactions stored, want %d", len(stored), len(comments))
+	}
+}
+
+func TestGetExistingConversation(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	carol := newTestUser(t, db, "carol")
+
+	// A group of the two and a conversation with a third participant that isn't marked as a group don't count
+	if _, err := db.StartConversation(alice, []string{bob}, "Group", true); err != nil {
+		t.Fatalf("creating the group: %v", err)
+	}
+	mislabeled, err := db.StartConversation(alice, []string{bob, carol}, "Three", true)
+	if err != nil {
+		t.Fatalf("creating the mislabeled conversation: %v", err)
+	}
+	if _, err := db.(*appdbimpl).c.Exec("UPDATE conversations SET is_group = 0 WHERE id = ?", mislabeled); err != nil {
+		t.Fatalf("marking the conversation as 1:1: %v", err)
+	}
+
+	if id, found, err := db.GetExistingConversation(alice, bob); err != nil || found {
+		t.Fatalf("GetExistingConversation() = %q, %v, %v, want none", id, found, err)
+	}
+
+	direct, err := db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	if direct == mislabeled {
+		t.Fatal("the conversation with three participants was reused")
+	}
+
+	for _, pair := range [][2]string{{alice, bob}, {bob, alice}} {
+		id, found, err := db.GetExistingConversation(pair[0], pair[1])
+		if err != nil || !found || id != direct {
+			t.Errorf("GetExistingConversation(%s, %s) = %q, %v, %v, want %q", pair[0], pair[1], id, found, err, direct)
+		}
+	}
+	if again, err := db.StartConversation(bob, []string{alice}, "", false); err != nil || again != direct {
+		t.Errorf("starting the conversation again gave %q, %v, want %q", again, err, direct)
+	}
+}
+
+func TestStartConversationAfterRemoving(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	conversationID, err := db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	if fullyDeleted, err := db.DeleteConversationForUser(alice, conversationID); err != nil || fullyDeleted {
+		t.Fatalf("alice removing the conversation: got %v, %v, want the conversation kept", fullyDeleted, err)
+	}
+	conversations, _, err := db.GetUserConversations(bob, ConversationFilter{})
+	if err != nil {
+		t.Fatalf("GetUserConversations: %v", err)
+	}
+	if len(conversations) != 1 || conversations[0].ParticipantCount != 1 || conversations[0].Title != "alice" {
+		t.Fatalf("bob's conversations after alice left: %+v, want one titled alice with 1 participant", conversations)
+	}
+
+	// A new message from bob puts alice back in the conversation
+	if _, _, _, err := db.AddMessage(conversationID, bob, "text", "still there?", "text/plain", nil, 0); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	if in, err := db.IsUserInConversation(alice, conversationID); err != nil || !in {
+		t.Errorf("alice back in the conversation: %v, %v, want true", in, err)
+	}
+
+	// Starting a conversation with bob again gives alice the same one
+	again, err := db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil || again != conversationID {
+		t.Fatalf("starting the conversation again gave %q, %v, want %q", again, err, conversationID)
+	}
+	for _, userID := range []string{alice, bob} {
+		conversations, total, err := db.GetUserConversations(userID, ConversationFilter{})
+		if err != nil {
+			t.Fatalf("GetUserConversations: %v", err)
+		}
+		if total != 1 || len(conversations) != 1 || conversations[0].ID != conversationID {
+			t.Errorf("%s has %d conversations, want only %s", userID, total, conversationID)
+		}
+		if len(conversations) == 1 && conversations[0].ParticipantCount != 2 {
+			t.Errorf("participant count = %d, want 2", conversations[0].ParticipantCount)
+		}
+	}
+
+	// Starting it again also works when nothing was sent in between
+	if _, err := db.DeleteConversationForUser(bob, conversationID); err != nil {
+		t.Fatalf("bob removing the conversation: %v", err)
+	}
+	again, err = db.StartConversation(bob, []string{alice}, "", false)
+	if err != nil || again != conversationID {
+		t.Errorf("bob starting the conversation again gave %q, %v, want %q", again, err, conversationID)
+	}
+}
+
+func TestDeleteMessageReturnsConversation(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	conversationID, err := db.StartConversation(alice, []string{bob}, "", false)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	// A second conversation, so that the right one has to be returned
+	if _, err := db.StartConversation(alice, []string{bob}, "Group", true); err != nil {
+		t.Fatalf("creating the group: %v", err)
+	}
+	messageID, _, _, err := db.AddMessage(conversationID, alice, "text", "oops", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	if _, _, err := db.DeleteMessage(messageID, bob); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("deleting someone else's message: got %v, want ErrUnauthorized", err)
+	}
+
+	deleted, deletedFrom, err := db.DeleteMessage(messageID, alice)
+	if err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if deletedFrom != conversationID {
+		t.Errorf("conversation ID = %q, want %q", deletedFrom, conversationID)
+	}
+	if deleted == nil || deleted.ID != messageID {
+		t.Errorf("deleted message = %+v, want %s", deleted, messageID)
+	}
+
+	if _, _, err := db.DeleteMessage(messageID, alice); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("deleting the message twice: got %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestUpdateMessageStatusGroupRead(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	carol := newTestUser(t, db, "carol")
+	groupID, err := db.StartConversation(alice, []string{bob, carol}, "Trio", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	messageID, _, _, err := db.AddMessage(groupID, alice, "text", "hello both", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	// The message is only read once every member but the sender has read it
+	steps := []struct {
+		userID, status, want string
+	}{
+		{bob, "read", "delivered"},
+		{carol, "delivered", "delivered"},
+		{carol, "read", "read"},
+	}
+	for _, step := range steps {
+		update, err := db.UpdateMessageStatus(messageID, step.userID, step.status)
+		if err != nil {
+			t.Fatalf("UpdateMessageStatus(%s, %s): %v", step.userID, step.status, err)
+		}
+		if update.Status != step.want {
+			t.Errorf("after %s reported %s, status = %q, want %q", step.userID, step.status, update.Status, step.want)
+		}
+		if update.MessageID != messageID || update.ConversationID != groupID {
+			t.Errorf("update for message %q in %q, want %q in %q", update.MessageID, update.ConversationID, messageID, groupID)
+		}
+		if update.UpdatedBy.ID != step.userID || update.UpdatedBy.Name == "" {
+			t.Errorf("updated by %+v, want %s", update.UpdatedBy, step.userID)
+		}
+		if update.UpdatedAt.IsZero() {
+			t.Error("update time not set")
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/gerdalukosiute/WASAText/service/globaltime"
 	"github.com/sirupsen/logrus"
 )
 
@@ -14,36 +15,94 @@ import (
 type AppDatabase interface {
 	GetOrCreateUser(name string) (string, error)
 	UpdateUsername(userID string, newName string) error
-	SearchUsers(query string) ([]User, int, error)
+	IsUsernameAvailable(name string) (bool, error)
+	SearchUsers(query string, viewerID string, excludePartners bool) ([]User, int, error)
+	ListUsers(filter string, sortBy string, descending bool, limit int, offset int) ([]User, int, error)
 	UpdateUserPhoto(userID string, fileData []byte, contentType string) (string, string, error)
-	GetUserConversations(userID string) ([]Conversation, int, error)
+	SetSnoozeUntil(userID string, until *time.Time) error
+	UpdateUserBio(userID string, bio string) error
+	BlockUser(blockerID, blockedID string) error
+	UnblockUser(blockerID, blockedID string) error
+	GetSnoozeUntil(userID string) (*time.Time, error)
+	GetUserConversations(userID string, filter ConversationFilter) ([]Conversation, int, error)
 	StartConversation(initiatorID string, recipientIDs []string, title string, isGroup bool) (string, error)
 	GetUserIDByName(name string) (string, error)
 	GetExistingConversation(userID1, userID2 string) (string, bool, error)
+	DeleteConversationForUser(userID, conversationID string) (fullyDeleted bool, err error)
 	GenerateConversationID() (string, error)
-	AddMessage(conversationID, senderID, messageType, content string, contentType string, parentMessageID *string) (string, error)
+	AddMessage(conversationID, senderID, messageType, content string, contentType string, parentMessageID *string, duration int) (string, string, int64, error)
 	ValidateParentMessage(messageID, conversationID string) (bool, error)
 	IsUserInConversation(userID, conversationID string) (bool, error)
 	GetUserNameByID(userID string) (string, error)
 	GenerateMessageID() (string, error)
-	StoreMediaFile(fileData []byte, mimeType string) (string, error)
+	GenerateCommentID() (string, error)
+	StoreMediaFile(fileData []byte, mimeType, filename string) (string, string, error)
 	GetMediaFile(mediaID string) ([]byte, string, error)
-	GetConversationDetails(conversationID, userID string) (*ConversationDetails, error)
+	GetMediaThumbnail(mediaID string) ([]byte, string, error)
+	GetMediaFilename(mediaID string) (string, error)
+	SetMessageTTL(conversationID, userID string, ttl time.Duration) error
+	DeleteExpiredMessages(now time.Time, limit int) (int, error)
+	CanAccessMedia(userID, mediaID string) (bool, error)
+	GetMediaStorageStats() (*MediaStorageStats, error)
+	DeleteOrphanMedia(olderThan time.Time, batchSize int) (int, int64, error)
+	SetColdStore(store ColdStore)
+	ArchiveMedia(olderThan time.Time, limit int) (int, int64, error)
+	GetMediaHits() (hot int64, cold int64)
+	GetConversationInfo(conversationID, userID string) (*ConversationDetails, error)
+	GetConversationDetails(conversationID, userID string, page MessagePage) (*ConversationDetails, error)
+	ForEachMessage(conversationID, viewerID string, oldestFirst bool, fn func(Message) error) error
+	GetMessagesAfterSeq(conversationID, userID string, afterSeq int64, limit int) ([]Message, int64, error)
+	SearchMessagesInConversation(conversationID, query string) ([]Message, error)
+	SearchUserMessages(userID, query string) ([]MessageSearchHit, int, error)
+	GetConversationParticipants(conversationID string) ([]Participant, error)
+	SetConversationTheme(conversationID, userID, theme string) error
+	PinConversation(conversationID, userID string) (time.Time, error)
+	UnpinConversation(conversationID, userID string) error
 	GetComments(messageID string) ([]Comment, error)
+	GetReactions(messageID, userID, emoji string, limit, offset int) ([]Comment, int, error)
+	SaveMessage(messageID, userID string) (*ForwardedMessage, string, error)
+	GetSavedMessages(userID string) ([]ForwardedMessage, error)
+	FlagMessage(messageID, userID string, remindAt *time.Time) error
+	UnflagMessage(messageID, userID string) error
+	GetFlaggedMessages(userID string) ([]FlaggedMessage, error)
+	AddMentions(messageID string, usernames []string) ([]User, error)
+	GetMentions(userID string, limit, offset int) ([]Mention, int, error)
+	SetLinkPreview(messageID string, preview LinkPreview) error
 	ForwardMessage(originalMessageID, targetConversationID, userID string) (*ForwardedMessage, error)
+	GetForwardChain(messageID, userID string, maxDepth int) (*ForwardChain, error)
+	GetForwardDestinations(messageID, userID string) ([]ForwardDestination, error)
 	IsUserAuthorized(userID string, messageID string) (bool, error)
 	ConversationExists(conversationID string) (bool, error)
 	DeleteMessage(messageID, userID string) (*Message, string, error)
-	AddComment(messageID, userID, content string) (*Comment, error)
+	AddComment(messageID, userID, content string, allowSelfReaction bool) (*Comment, error)
 	DeleteComment(messageID, commentID, userID string) error
+	GetRecentEmoji(userID string) ([]RecentEmoji, error)
 	AddUsersToGroup(groupID, adderID string, usernames []string) (*GroupAddResult, error)
 	LeaveGroup(groupID string, userID string) (username string, isGroupDeleted bool, remainingMemberCount int, err error)
 	IsGroupMember(groupID, userID string) (bool, error)
+	GetGroupAdmins(groupID string) ([]GroupMember, error)
+	GetGroupMembers(groupID, requesterID, search string) ([]Participant, error)
+	IsGroupAdmin(groupID, userID string) (bool, error)
+	UpdateGroupSettings(groupID, userID string, update GroupSettingsUpdate) (*GroupSettings, error)
+	GetPendingMessages(groupID, userID string) ([]Message, error)
+	ApproveMessage(messageID, userID string) (*Message, string, error)
+	DeleteUserReactions(groupID, adminID, targetUserID string) (int, error)
+	RemoveUserFromGroup(groupID, removerID, targetUserID string) (remainingMemberCount int, err error)
+	GetGroupTimeline(groupID, userID string, limit, offset int) ([]GroupEvent, int, error)
 	SetGroupName(groupID string, userID string, newName string) (oldName string, updatedName string, memberCount int, err error)
 	SetGroupPhoto(groupID string, userID string, fileData []byte, contentType string) (oldPhotoID string, newPhotoID string, err error)
 	UserExists(userID string) (bool, error)
+	GetUserProfile(userID string) (*User, error)
+	ForEachSentMessage(userID string, fn func(conversationID string, m Message) error) error
+	ForEachUserReaction(userID string, fn func(Comment) error) error
+	DeleteUser(userID string) (string, error)
+	RemoveUserPhoto(userID string) (oldPhotoID string, err error)
+	GetMessageReceipts(messageID, userID string, view ReceiptsView) ([]MessageReceipt, error)
 	UpdateMessageStatus(messageID, userID, newStatus string) (*MessageStatusUpdate, error)
+	MarkConversationRead(conversationID, userID string) (int, error)
 	GetMessageByID(messageID string) (*Message, error)
+	GetMessageConversationID(messageID string) (string, error)
+	GetReplies(messageID, userID string) ([]Message, error)
 	IsValidUserID(userID string) bool
 	IsValidImageType(contentType string) bool
 	GeneratePhotoID(userID string) string
@@ -52,9 +111,11 @@ type AppDatabase interface {
 
 // User represents a user in the database
 type User struct {
-	ID      string
-	Name    string
-	PhotoID string
+	ID        string
+	Name      string
+	PhotoID   string
+	Bio       string
+	CreatedAt *time.Time
 }
 
 // Group structure representation
@@ -72,6 +133,89 @@ type ConversationDetails struct {
 	ProfilePhoto string
 	Participants []Participant
 	Messages     []Message
+	// HasMoreMessages is set when Messages is a page and there are older messages
+	HasMoreMessages bool
+	Settings        GroupSettings
+	Theme           string
+	// MessageTTLSeconds is how long new messages are kept before they disappear, 0 when they are kept for good
+	MessageTTLSeconds int
+	// LastReadSeq is the seq of the last message the user read in the conversation
+	LastReadSeq int64
+	// Only set when getting the unread messages: the number of messages from others after LastReadSeq and the first
+	// of them
+	UnreadCount          int
+	FirstUnreadMessageID string
+}
+
+// ConversationFilter selects the conversations GetUserConversations returns, the zero value selects them all
+type ConversationFilter struct {
+	// IsGroup keeps only the groups when true and only the 1:1 conversations when false
+	IsGroup *bool
+	// Title keeps only the conversations whose title as seen by the user contains it, ignoring the case of ASCII
+	// letters
+	Title string
+}
+
+// MessagePage selects the messages GetConversationDetails returns, newest first
+type MessagePage struct {
+	// Limit is the maximum number of messages, there is no limit when it's zero
+	Limit int
+	// Offset is the number of newest messages to skip
+	Offset int
+	// Before only keeps the messages sent before it when set
+	Before *time.Time
+	// UnreadOnly only keeps the messages after the user's read cursor
+	UnreadOnly bool
+}
+
+// Roles of group members
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// GroupMember represents a member of a group along with their role
+type GroupMember struct {
+	ID   string
+	Name string
+	Role string
+}
+
+// GroupEvent is an entry of the history of a group. Target is the member the event is about, nil for events about
+// the group itself. Details holds the new name of renamed groups, the new photo ID of photo changes and the number of
+// reactions removed by an admin
+type GroupEvent struct {
+	ID        int64
+	Type      string
+	Actor     User
+	Target    *User
+	Details   string
+	Timestamp time.Time
+}
+
+// Status of a message in a moderated group that is waiting for the approval of an admin
+const MessageStatusPending = "pending"
+
+// Type of deleted messages. They keep their row, so that replies and forwards still point to them, with their
+// content cleared
+const MessageTypeDeleted = "deleted"
+
+// GroupSettings holds the settings group admins can change
+type GroupSettings struct {
+	SlowModeSeconds    int
+	ForwardingDisabled bool
+	ApprovalRequired   bool
+	// AllowedReactions lists the only emoji members can react with, nil when any emoji is allowed
+	AllowedReactions []string
+}
+
+// GroupSettingsUpdate holds the group settings to change, nil fields are left as they are
+type GroupSettingsUpdate struct {
+	SlowModeSeconds    *int
+	ForwardingDisabled *bool
+	ApprovalRequired   *bool
+	// An empty list lifts the restriction on reactions
+	AllowedReactions *[]string
 }
 
 // Participant represents a user participating in a conversation
@@ -79,6 +223,9 @@ type Participant struct {
 	ID      string
 	Name    string
 	PhotoID string
+	Bio     string
+	// IsAdmin is only set when listing the members of a group
+	IsAdmin bool
 }
 
 // Message struct represents a message
@@ -97,6 +244,39 @@ type Message struct {
 	IsForwarded       bool
 	OriginalSender    *User
 	OriginalTimestamp time.Time
+	// Seq numbers the messages of a conversation in the order they were delivered, it is 0 while a message is pending
+	// approval
+	Seq int64
+	// Parent is the message replied to, when the message is a reply
+	Parent *QuotedMessage
+	// DeletedAt is only set for deleted messages
+	DeletedAt time.Time
+	// Duration is the length in seconds of an audio message as told by its sender, 0 when unknown
+	Duration int
+	// ExpiresAt is when the message disappears, only set in conversations with disappearing messages
+	ExpiresAt time.Time
+	// LinkPreview describes the first link in a text message, once it has been fetched
+	LinkPreview *LinkPreview
+}
+
+// QuotedMessage is the message a reply quotes
+type QuotedMessage struct {
+	ID       string
+	SenderID string
+	Sender   string
+	Type     string
+	Content  string
+}
+
+// MessageSearchHit is a message found by searching all the conversations of a user. ConversationTitle is the title
+// the user sees, the other participant's name for 1:1 conversations
+type MessageSearchHit struct {
+	MessageID         string
+	ConversationID    string
+	ConversationTitle string
+	Sender            User
+	Content           string
+	Timestamp         time.Time
 }
 
 // New struct for forwarded message details
@@ -111,6 +291,8 @@ type ForwardedMessage struct {
 	Status            string
 	OriginalSender    User
 	OriginalTimestamp time.Time
+	// Seq is the position given to the message in the target conversation, 0 while it waits for approval
+	Seq int64
 }
 
 // Comment represents a comment on a message
@@ -135,8 +317,23 @@ type Conversation struct {
 		Content   string
 		Timestamp time.Time
 	}
+	// LastReadSeq is the seq of the last message the user read, UnreadCount the number of messages from others after it
+	LastReadSeq int64
+	UnreadCount int
+	// PinnedAt is set when the user pinned the conversation to the top of their list
+	PinnedAt *time.Time
+	// ParticipantCount is the number of participants, 1 for 1:1 conversations the other participant removed
+	ParticipantCount int
+	// LastActivity is when the last message was sent, or when the conversation was created if it has none
+	LastActivity time.Time
+	// OtherParticipantNames is only set for groups without a title, with the names of the first
+	// untitledGroupNameCount other participants in alphabetical order, so that a title can be made up from them
+	OtherParticipantNames []string
 }
 
+// untitledGroupNameCount is the number of participant names loaded for groups without a title
+const untitledGroupNameCount = 2
+
 // MessageStatusUpdate represents the result of a message status update
 type MessageStatusUpdate struct {
 	MessageID      string
@@ -146,6 +343,37 @@ type MessageStatusUpdate struct {
 	ConversationID string
 }
 
+// MessageReceipt represents how far a message got for one of its recipients. While the recipient hasn't reported it
+// as delivered or read, Status is the Unreported status of the ReceiptsView and UpdatedAt is nil
+type MessageReceipt struct {
+	User      User
+	Status    string
+	UpdatedAt *time.Time
+}
+
+// ReceiptsView tells GetMessageReceipts who can see the receipts of a message and how the recipients who haven't
+// reported it yet are shown
+type ReceiptsView struct {
+	// AnyParticipant lets every participant of the conversation see the receipts, not only the sender
+	AnyParticipant bool
+	// Unreported is the status of the recipients who haven't reported the message, "sent" when empty
+	Unreported string
+}
+
+// Reasons a user couldn't be added to a group
+const (
+	AddFailureNotFound      = "not_found"
+	AddFailureAlreadyMember = "already_member"
+)
+
+// GroupAddFailure describes a user that couldn't be added to a group and why
+type GroupAddFailure struct {
+	Username string
+	Reason   string
+}
+
+// GroupAddResult is the outcome of AddUsersToGroup: the users added, the ones that couldn't be added, and the group
+// member count afterwards
 type GroupAddResult struct {
 	GroupID    string
 	GroupName  string
@@ -153,7 +381,7 @@ type GroupAddResult struct {
 		Username string
 		UserID   string
 	}
-	FailedUsers        []string
+	FailedUsers        []GroupAddFailure
 	UpdatedMemberCount int
 	AddedBy            User
 	Timestamp          time.Time
@@ -173,11 +401,37 @@ var (
 	ErrInvalidNameFormat    = errors.New("invalid name format")
 	ErrNameAlreadyTaken     = errors.New("name already taken")
 	ErrMediaNotFound        = errors.New("media not found")
+	ErrEmptyMessageContent  = errors.New("message content is empty")
+	ErrMessageNotFlagged    = errors.New("message not flagged")
+	ErrSlowMode             = errors.New("slow mode is enabled")
+	ErrForwardingDisabled   = errors.New("forwarding is disabled in this conversation")
+	ErrMessageNotPending    = errors.New("message is not pending approval")
+	ErrReactionNotAllowed   = errors.New("reaction is not allowed in this conversation")
+	ErrSelfReaction         = errors.New("reacting to one's own message is not allowed")
+	ErrNoColdStore          = errors.New("cold storage is not configured")
+	ErrRemoveSelf           = errors.New("members can't remove themselves from a group")
+	ErrBioTooLong           = errors.New("bio is too long")
+	ErrUserNotBlocked       = errors.New("user is not blocked")
+	ErrTooManyPinned        = errors.New("too many pinned conversations")
+	ErrGroupConversation    = errors.New("conversation is a group")
 	ErrInternalServer       = errors.New("internal server error")
 )
 
+// nowUTC returns the current time in UTC. Every timestamp is stored in UTC, so that timestamps compare and sort the
+// same way in SQL whatever the timezone of the server
+func nowUTC() time.Time {
+	return globaltime.Now().UTC()
+}
+
 type appdbimpl struct {
+	// Number of media files served from the database and from cold storage, updated atomically
+	hotMediaHits  int64
+	coldMediaHits int64
+
 	c *sql.DB
+
+	// coldStore keeps the media files moved out of the database, nil when archiving is disabled
+	coldStore ColdStore
 }
 
 // New returns a new instance of AppDatabase based on the SQLite connection `db`.
@@ -190,28 +444,94 @@ func New(db *sql.DB) (AppDatabase, error) {
 	// Seed the random number generator
 	rand.Seed(time.Now().UnixNano())
 
+	// Foreign keys are enforced per connection. This only covers the connection used here, the others get it from
+	// the _foreign_keys DSN parameter
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		return nil, fmt.Errorf("error enabling foreign keys: %w", err)
+	}
+
 	// Check if tables exist. If not, create them.
 	if err := createTables(db); err != nil {
 		return nil, fmt.Errorf("error creating database structure: %w", err)
 	}
 
+	// Add the columns that databases created by older versions are missing
+	if err := migrateColumns(db); err != nil {
+		return nil, fmt.Errorf("error migrating database structure: %w", err)
+	}
+	if err := createIndexes(db); err != nil {
+		return nil, fmt.Errorf("error creating database indexes: %w", err)
+	}
+
+	// Groups created before roles existed have no admin
+	if _, err := db.Exec(promoteGroupAdminQuery, "", ""); err != nil {
+		return nil, fmt.Errorf("error assigning group admins: %w", err)
+	}
+
+	// Rows left behind while foreign keys weren't enforced are reported, they only fail when they are changed
+	if err := reportForeignKeyViolations(db); err != nil {
+		return nil, err
+	}
+
 	return &appdbimpl{
 		c: db,
 	}, nil
 }
 
+// reportForeignKeyViolations logs how many rows of each table refer to rows that don't exist anymore
+func reportForeignKeyViolations(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return fmt.Errorf("error checking foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	violations := map[string]int{}
+	for rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fkID int
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return fmt.Errorf("error scanning foreign key violation: %w", err)
+		}
+		violations[table+" -> "+parent]++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating foreign key violations: %w", err)
+	}
+
+	for reference, count := range violations {
+		logrus.WithFields(logrus.Fields{
+			"reference": reference,
+			"count":     count,
+		}).Warn("Rows refer to missing rows")
+	}
+	return nil
+}
+
 func createTables(db *sql.DB) error {
 	tables := []string{
 		`CREATE TABLE IF NOT EXISTS users (
 			id TEXT PRIMARY KEY,
 			name TEXT UNIQUE NOT NULL,
-			photo_id TEXT
+			photo_id TEXT,
+			created_at DATETIME,
+			snooze_until DATETIME,
+			bio TEXT NOT NULL DEFAULT ''
 		)`,
 		`CREATE TABLE IF NOT EXISTS conversations (
 			id TEXT PRIMARY KEY,
 			title TEXT,
 			profile_photo TEXT,
 			is_group BOOLEAN NOT NULL,
+			is_self BOOLEAN NOT NULL DEFAULT 0,
+			slow_mode_seconds INTEGER NOT NULL DEFAULT 0,
+			message_ttl_seconds INTEGER NOT NULL DEFAULT 0,
+			forwarding_disabled BOOLEAN NOT NULL DEFAULT 0,
+			approval_required BOOLEAN NOT NULL DEFAULT 0,
+			allowed_reactions TEXT NOT NULL DEFAULT '',
+			last_seq INTEGER NOT NULL DEFAULT 0,
+			removed_user_id TEXT,
 			created_at DATETIME NOT NULL
 		)`,
 		`CREATE TABLE IF NOT EXISTS messages (
@@ -228,6 +548,11 @@ func createTables(db *sql.DB) error {
 			is_forwarded BOOLEAN DEFAULT 0,
 			original_sender_id TEXT,
 			original_timestamp DATETIME,
+			original_message_id TEXT,
+			seq INTEGER,
+			deleted_at DATETIME,
+			duration INTEGER,
+			expires_at DATETIME,
 			FOREIGN KEY (conversation_id) REFERENCES conversations(id),
 			FOREIGN KEY (sender_id) REFERENCES users(id),
 			FOREIGN KEY (parent_message_id) REFERENCES messages(id),
@@ -237,6 +562,7 @@ func createTables(db *sql.DB) error {
     		message_id TEXT,
     		user_id TEXT,
     		status TEXT,
+    		updated_at DATETIME,
     		PRIMARY KEY (message_id, user_id),
     		FOREIGN KEY (message_id) REFERENCES messages(id),
     		FOREIGN KEY (user_id) REFERENCES users(id)
@@ -244,6 +570,7 @@ func createTables(db *sql.DB) error {
 		`CREATE TABLE IF NOT EXISTS user_conversations (
 			user_id TEXT NOT NULL,
 			conversation_id TEXT NOT NULL,
+			pinned_at DATETIME,
 			PRIMARY KEY (user_id, conversation_id),
 			FOREIGN KEY (user_id) REFERENCES users(id),
 			FOREIGN KEY (conversation_id) REFERENCES conversations(id)
@@ -264,15 +591,83 @@ func createTables(db *sql.DB) error {
 		`CREATE TABLE IF NOT EXISTS group_members (
 			group_id TEXT NOT NULL,
 			user_id TEXT NOT NULL,
+			role TEXT NOT NULL DEFAULT 'member',
 			PRIMARY KEY (group_id, user_id),
 			FOREIGN KEY (group_id) REFERENCES groups(id),
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS flagged_messages (
+			user_id TEXT NOT NULL,
+			message_id TEXT NOT NULL,
+			remind_at DATETIME,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, message_id),
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (message_id) REFERENCES messages(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS message_mentions (
+			message_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			PRIMARY KEY (message_id, user_id),
+			FOREIGN KEY (message_id) REFERENCES messages(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS link_previews (
+			message_id TEXT PRIMARY KEY,
+			url TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			image_url TEXT NOT NULL DEFAULT '',
+			site_name TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY (message_id) REFERENCES messages(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS conversation_settings (
+			user_id TEXT NOT NULL,
+			conversation_id TEXT NOT NULL,
+			theme TEXT,
+			last_read_seq INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (user_id, conversation_id),
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS recent_emoji (
+			user_id TEXT NOT NULL,
+			emoji TEXT NOT NULL,
+			use_count INTEGER NOT NULL DEFAULT 1,
+			last_used_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, emoji),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
 		`CREATE TABLE IF NOT EXISTS media_files (
 		id TEXT PRIMARY KEY,
 		file_data BLOB NOT NULL,
 		mime_type TEXT NOT NULL,
-		created_at DATETIME NOT NULL
+		created_at DATETIME NOT NULL,
+		cold_key TEXT,
+		cold_size INTEGER NOT NULL DEFAULT 0,
+		thumbnail_id TEXT,
+		filename TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS group_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			group_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			actor_id TEXT NOT NULL,
+			target_id TEXT,
+			details TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY (group_id) REFERENCES conversations(id),
+			FOREIGN KEY (actor_id) REFERENCES users(id),
+			FOREIGN KEY (target_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_blocks (
+			blocker_id TEXT NOT NULL,
+			blocked_id TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (blocker_id, blocked_id),
+			FOREIGN KEY (blocker_id) REFERENCES users(id),
+			FOREIGN KEY (blocked_id) REFERENCES users(id)
 		)`,
 	}
 
@@ -287,6 +682,137 @@ func createTables(db *sql.DB) error {
 	return nil
 }
 
+// createIndexes creates the indexes once the tables have all their columns, as some indexes cover columns added by
+// migrateColumns
+func createIndexes(db *sql.DB) error {
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_conversation_sender ON messages(conversation_id, sender_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_message_id ON comments(message_id, content)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_comments_user_reaction ON comments(message_id, user_id, content)`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_photo_id ON users(photo_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_conversations_profile_photo ON conversations(profile_photo)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_conversation_seq ON messages(conversation_id, seq)`,
+		`CREATE INDEX IF NOT EXISTS idx_group_events_group ON group_events(group_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_media_files_thumbnail_id ON media_files(thumbnail_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_mentions_user_id ON message_mentions(user_id)`,
+	}
+
+	for _, index := range indexes {
+		if _, err := db.Exec(index); err != nil {
+			return fmt.Errorf("error creating index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// columnMigrations lists the columns added to tables after they were first created. Fresh databases get them from
+// createTables, while older databases are upgraded by migrateColumns, which then runs the optional backfill statement
+// to fill in the new column for existing rows
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+	backfill   string
+}{
+	{"users", "created_at", "DATETIME", ""},
+	{"users", "snooze_until", "DATETIME", ""},
+	{"group_members", "role", "TEXT NOT NULL DEFAULT 'member'", ""},
+	{"conversations", "is_self", "BOOLEAN NOT NULL DEFAULT 0", ""},
+	{"conversations", "slow_mode_seconds", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"message_read_status", "updated_at", "DATETIME", backfillReadStatusTimes},
+	{"conversations", "forwarding_disabled", "BOOLEAN NOT NULL DEFAULT 0", ""},
+	{"conversations", "approval_required", "BOOLEAN NOT NULL DEFAULT 0", ""},
+	{"messages", "original_message_id", "TEXT", backfillOriginalMessageIDs},
+	{"conversations", "allowed_reactions", "TEXT NOT NULL DEFAULT ''", ""},
+	{"messages", "seq", "INTEGER", backfillMessageSeqs},
+	{"conversation_settings", "last_read_seq", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"media_files", "cold_key", "TEXT", ""},
+	{"media_files", "cold_size", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"messages", "deleted_at", "DATETIME", ""},
+	{"users", "bio", "TEXT NOT NULL DEFAULT ''", ""},
+	{"user_conversations", "pinned_at", "DATETIME", ""},
+	{"media_files", "thumbnail_id", "TEXT", ""},
+	{"messages", "duration", "INTEGER", ""},
+	{"media_files", "filename", "TEXT", ""},
+	{"conversations", "message_ttl_seconds", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"messages", "expires_at", "DATETIME", ""},
+	{"conversations", "last_seq", "INTEGER NOT NULL DEFAULT 0", backfillLastSeqs},
+	{"conversations", "removed_user_id", "TEXT", ""},
+}
+
+// backfillOriginalMessageIDs links forwards made before original_message_id existed to their source, the message
+// with the sender, timestamp and content the forward was copied from. Saved media messages have their own copy of the
+// media, so they stay unlinked
+const backfillOriginalMessageIDs = `
+	UPDATE messages SET original_message_id = (
+		SELECT s.id FROM messages s
+		WHERE s.sender_id = messages.original_sender_id
+			AND s.created_at = messages.original_timestamp
+			AND s.content = messages.content
+			AND s.id != messages.id
+		LIMIT 1
+	)
+	WHERE is_forwarded = 1 AND original_message_id IS NULL`
+
+// backfillReadStatusTimes dates the statuses reported before updated_at existed. When they were reported isn't known,
+// so they get the time the message was sent, which is the earliest they could have been
+const backfillReadStatusTimes = `
+	UPDATE message_read_status SET updated_at = (
+		SELECT m.created_at FROM messages m WHERE m.id = message_read_status.message_id
+	)
+	WHERE updated_at IS NULL`
+
+// backfillMessageSeqs numbers the existing messages of each conversation in the order they were sent. Messages pending
+// approval get their number once approved
+const backfillMessageSeqs = `
+	UPDATE messages SET seq = (
+		SELECT COUNT(*) FROM messages m2
+		WHERE m2.conversation_id = messages.conversation_id
+			AND m2.status != 'pending'
+			AND (m2.created_at < messages.created_at OR (m2.created_at = messages.created_at AND m2.id <= messages.id))
+	)
+	WHERE status != 'pending'`
+
+// backfillLastSeqs starts the sequence counter of each conversation at the highest sequence number of its messages
+const backfillLastSeqs = `
+	UPDATE conversations SET last_seq = (
+		SELECT COALESCE(MAX(seq), 0) FROM messages WHERE messages.conversation_id = conversations.id
+	)`
+
+func migrateColumns(db *sql.DB) error {
+	for _, m := range columnMigrations {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)", m.table, m.column).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error checking column %s.%s: %w", m.table, m.column, err)
+		}
+		if exists {
+			continue
+		}
+
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition))
+		if err != nil {
+			return fmt.Errorf("error adding column %s.%s: %w", m.table, m.column, err)
+		}
+		logrus.WithFields(logrus.Fields{
+			"table":  m.table,
+			"column": m.column,
+		}).Info("Added missing database column")
+
+		if m.backfill != "" {
+			if _, err := db.Exec(m.backfill); err != nil {
+				return fmt.Errorf("error backfilling column %s.%s: %w", m.table, m.column, err)
+			}
+		}
+	}
+
+	return nil
+}
+
 func (db *appdbimpl) Ping() error {
 	return db.c.Ping()
 }
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB opens an empty database in a temporary directory, with the same options as the web API
+func newTestDB(t *testing.T) AppDatabase {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_loc=UTC&_foreign_keys=on&_txlock=immediate")
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	db, err := New(conn)
+	if err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+	return db
+}
+
+// newTestUser creates a user and returns their ID
+func newTestUser(t *testing.T, db AppDatabase, name string) string {
+	t.Helper()
+	id, err := db.GetOrCreateUser(name)
+	if err != nil {
+		t.Fatalf("creating user %s: %v", name, err)
+	}
+	return id
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Number of distinct emoji remembered per user
+const maxRecentEmoji = 20
+
+// RecentEmoji represents an emoji a user recently reacted with
+type RecentEmoji struct {
+	Emoji      string
+	UseCount   int
+	LastUsedAt time.Time
+}
+
+// recordRecentEmoji remembers that the user reacted with an emoji, forgetting their least recently used emoji once
+// there are more than maxRecentEmoji
+func recordRecentEmoji(tx *sql.Tx, userID, emoji string, usedAt time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO recent_emoji (user_id, emoji, use_count, last_used_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT (user_id, emoji) DO UPDATE SET
+			use_count = use_count + 1,
+			last_used_at = excluded.last_used_at
+	`, userID, emoji, usedAt)
+	if err != nil {
+		return fmt.Errorf("error recording recent emoji: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM recent_emoji
+		WHERE user_id = ? AND emoji NOT IN (
+			SELECT emoji FROM recent_emoji
+			WHERE user_id = ?
+			ORDER BY last_used_at DESC
+			LIMIT ?
+		)
+	`, userID, userID, maxRecentEmoji)
+	if err != nil {
+		return fmt.Errorf("error pruning recent emoji: %w", err)
+	}
+
+	return nil
+}
+
+// GetRecentEmoji returns the emoji the user reacted with most recently, most recent first
+func (db *appdbimpl) GetRecentEmoji(userID string) ([]RecentEmoji, error) {
+	rows, err := db.c.Query(`
+		SELECT emoji, use_count, last_used_at
+		FROM recent_emoji
+		WHERE user_id = ?
+		ORDER BY last_used_at DESC
+		LIMIT ?
+	`, userID, maxRecentEmoji)
+	if err != nil {
+		return nil, fmt.Errorf("error querying recent emoji: %w", err)
+	}
+	defer rows.Close()
+
+	var emoji []RecentEmoji
+	for rows.Next() {
+		var e RecentEmoji
+		if err := rows.Scan(&e.Emoji, &e.UseCount, &e.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("error scanning recent emoji: %w", err)
+		}
+		emoji = append(emoji, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recent emoji: %w", err)
+	}
+
+	return emoji, nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MinMessageTTL and MaxMessageTTL bound how long the messages of a conversation with disappearing messages are kept
+const (
+	MinMessageTTL = time.Minute
+	MaxMessageTTL = 365 * 24 * time.Hour
+)
+
+// SetMessageTTL sets how long the messages sent to a conversation from now on are kept before they disappear, zero
+// keeps them for good. Messages already sent keep their expiration. Any participant of a one-on-one conversation can
+// change it, while in groups only the admins can. Saved messages are meant to be kept, so the conversation with
+// oneself can't have disappearing messages
+func (db *appdbimpl) SetMessageTTL(conversationID, userID string, ttl time.Duration) error {
+	isParticipant, err := db.IsUserInConversation(userID, conversationID)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return ErrUnauthorized
+	}
+
+	var isGroup, isSelf bool
+	err = db.c.QueryRow("SELECT is_group, is_self FROM conversations WHERE id = ?", conversationID).Scan(&isGroup, &isSelf)
+	if errors.Is(err, sql.ErrNoRows) || isSelf {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error checking conversation type: %w", err)
+	}
+	if isGroup {
+		isAdmin, err := db.IsGroupAdmin(conversationID, userID)
+		if err != nil {
+			return err
+		}
+		if !isAdmin {
+			return ErrUnauthorized
+		}
+	}
+
+	_, err = db.c.Exec("UPDATE conversations SET message_ttl_seconds = ? WHERE id = ?", int(ttl.Seconds()), conversationID)
+	if err != nil {
+		return fmt.Errorf("error updating message TTL: %w", err)
+	}
+
+	return nil
+}
+
+// messageExpiry returns when a message sent to a conversation at the given time disappears, NULL when the
+// conversation keeps its messages
+func messageExpiry(tx *sql.Tx, conversationID string, sentAt time.Time) (sql.NullTime, error) {
+	var ttlSeconds int
+	err := tx.QueryRow("SELECT message_ttl_seconds FROM conversations WHERE id = ?", conversationID).Scan(&ttlSeconds)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return sql.NullTime{}, fmt.Errorf("error checking message TTL: %w", err)
+	}
+	if ttlSeconds <= 0 {
+		return sql.NullTime{}, nil
+	}
+	return sql.NullTime{Time: sentAt.Add(time.Duration(ttlSeconds) * time.Second), Valid: true}, nil
+}
+
+// deleteMessageQueries delete a message with everything that refers to it. Replies to the message stay, without
+// their parent
+var deleteMessageQueries = []string{
+	"DELETE FROM comments WHERE message_id = ?",
+	"DELETE FROM message_read_status WHERE message_id = ?",
+	"DELETE FROM flagged_messages WHERE message_id = ?",
+	"DELETE FROM message_mentions WHERE message_id = ?",
+	"DELETE FROM link_previews WHERE message_id = ?",
+	"UPDATE messages SET parent_message_id = NULL WHERE parent_message_id = ?",
+	"DELETE FROM messages WHERE id = ?",
+}
+
+// DeleteExpiredMessages deletes up to limit messages that expired before now, with their reactions, read statuses,
+// flags and mentions, in a single transaction. Photos and files are left to the orphan media cleanup. Returns the
+// number of deleted messages
+func (db *appdbimpl) DeleteExpiredMessages(now time.Time, limit int) (int, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	rows, err := tx.Query("SELECT id FROM messages WHERE expires_at <= ? LIMIT ?", now.UTC(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("error querying expired messages: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning expired messages: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("error iterating expired messages: %w", err)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		for _, query := range deleteMessageQueries {
+			if _, err := tx.Exec(query, id); err != nil {
+				return 0, fmt.Errorf("error deleting expired message: %w", err)
+			}
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return len(ids), nil
+}
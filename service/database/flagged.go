@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// FlaggedMessage represents a message a user flagged for follow-up
+type FlaggedMessage struct {
+	MessageID      string
+	ConversationID string
+	SenderID       string
+	Sender         string
+	Type           string
+	Content        string
+	Timestamp      time.Time
+	FlaggedAt      time.Time
+	RemindAt       *time.Time
+}
+
+// FlagMessage flags a message for follow-up by the user, with an optional reminder time. Flagging an already flagged
+// message replaces its reminder
+func (db *appdbimpl) FlagMessage(messageID, userID string, remindAt *time.Time) error {
+	var messageExists bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ?)", messageID).Scan(&messageExists)
+	if err != nil {
+		return fmt.Errorf("error checking message existence: %w", err)
+	}
+	if !messageExists {
+		return ErrMessageNotFound
+	}
+
+	isAuthorized, err := db.IsUserAuthorized(userID, messageID)
+	if err != nil {
+		return err
+	}
+	if !isAuthorized {
+		return ErrUnauthorized
+	}
+
+	if remindAt != nil {
+		utc := remindAt.UTC()
+		remindAt = &utc
+	}
+
+	_, err = db.c.Exec(`
+		INSERT INTO flagged_messages (user_id, message_id, remind_at, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, message_id) DO UPDATE SET remind_at = excluded.remind_at
+	`, userID, messageID, remindAt, nowUTC())
+	if err != nil {
+		return fmt.Errorf("error flagging message: %w", err)
+	}
+
+	return nil
+}
+
+// UnflagMessage clears the user's flag and reminder on a message
+func (db *appdbimpl) UnflagMessage(messageID, userID string) error {
+	result, err := db.c.Exec("DELETE FROM flagged_messages WHERE user_id = ? AND message_id = ?", userID, messageID)
+	if err != nil {
+		return fmt.Errorf("error unflagging message: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrMessageNotFlagged
+	}
+
+	return nil
+}
+
+// GetFlaggedMessages returns the messages flagged by the user, soonest reminder first and messages without a reminder
+// last. Messages in conversations the user has left are skipped
+func (db *appdbimpl) GetFlaggedMessages(userID string) ([]FlaggedMessage, error) {
+	rows, err := db.c.Query(`
+		SELECT m.id, m.conversation_id, m.sender_id, u.name, m.type, m.content, m.created_at, f.created_at, f.remind_at
+		FROM flagged_messages f
+		JOIN messages m ON f.message_id = m.id
+		JOIN users u ON m.sender_id = u.id
+		JOIN user_conversations uc ON m.conversation_id = uc.conversation_id AND uc.user_id = f.user_id
+		WHERE f.user_id = ?
+		ORDER BY f.remind_at IS NULL, f.remind_at, f.created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying flagged messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []FlaggedMessage
+	for rows.Next() {
+		var message FlaggedMessage
+		var remindAt sql.NullTime
+		err := rows.Scan(
+			&message.MessageID,
+			&message.ConversationID,
+			&message.SenderID,
+			&message.Sender,
+			&message.Type,
+			&message.Content,
+			&message.Timestamp,
+			&message.FlaggedAt,
+			&remindAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning flagged message: %w", err)
+		}
+		if remindAt.Valid {
+			message.RemindAt = &remindAt.Time
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating flagged messages: %w", err)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ForwardHop is a message in a chain of forwards. Hops in conversations the user can't access only tell that a hop
+// exists, all their other fields are left empty
+type ForwardHop struct {
+	MessageID      string
+	ConversationID string
+	SenderID       string
+	Sender         string
+	Timestamp      time.Time
+	IsForwarded    bool
+	Accessible     bool
+}
+
+// ForwardChain is the path a message took through forwards, from the original message to the message itself
+type ForwardChain struct {
+	Hops []ForwardHop
+	// SourceDeleted is set when the chain ends at a message that has been deleted since
+	SourceDeleted bool
+	// Truncated is set when the chain is longer than the maximum depth, the oldest hops are left out
+	Truncated bool
+}
+
+// GetForwardChain follows the original_message_id links from a message the user can see back to the original
+// message, through at most maxDepth hops
+func (db *appdbimpl) GetForwardChain(messageID, userID string, maxDepth int) (*ForwardChain, error) {
+	var messageExists bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ?)", messageID).Scan(&messageExists)
+	if err != nil {
+		return nil, fmt.Errorf("error checking message existence: %w", err)
+	}
+	if !messageExists {
+		return nil, ErrMessageNotFound
+	}
+
+	isAuthorized, err := db.IsUserAuthorized(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAuthorized {
+		return nil, ErrUnauthorized
+	}
+
+	chain := &ForwardChain{}
+	currentID := messageID
+	for {
+		if len(chain.Hops) == maxDepth {
+			chain.Truncated = true
+			break
+		}
+
+		var hop ForwardHop
+		var sourceID sql.NullString
+		err := db.c.QueryRow(`
+			SELECT m.id, m.conversation_id, m.sender_id, u.name, m.created_at, COALESCE(m.is_forwarded, 0), m.original_message_id
+			FROM messages m
+			JOIN users u ON m.sender_id = u.id
+			WHERE m.id = ?
+		`, currentID).Scan(&hop.MessageID, &hop.ConversationID, &hop.SenderID, &hop.Sender, &hop.Timestamp, &hop.IsForwarded, &sourceID)
+		if errors.Is(err, sql.ErrNoRows) {
+			chain.SourceDeleted = true
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching forwarded message: %w", err)
+		}
+
+		hop.Accessible, err = db.IsUserAuthorized(userID, hop.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		if !hop.Accessible {
+			hop = ForwardHop{}
+		}
+		chain.Hops = append(chain.Hops, hop)
+
+		if !sourceID.Valid {
+			break
+		}
+		currentID = sourceID.String
+	}
+
+	// The hops were collected walking back from the message, return them starting from the original
+	for i, j := 0, len(chain.Hops)-1; i < j; i, j = i+1, j-1 {
+		chain.Hops[i], chain.Hops[j] = chain.Hops[j], chain.Hops[i]
+	}
+
+	return chain, nil
+}
+
+// ForwardDestination is a forward of a message into another conversation
+type ForwardDestination struct {
+	ConversationID string
+	IsGroup        bool
+	MessageID      string
+	ForwarderID    string
+	Forwarder      string
+	Timestamp      time.Time
+}
+
+// GetForwardDestinations returns the direct forwards of a message the user can see, oldest first. Only forwards into
+// conversations the user participates in are returned, and copies saved by users aren't forwards
+func (db *appdbimpl) GetForwardDestinations(messageID, userID string) ([]ForwardDestination, error) {
+	var messageExists bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ?)", messageID).Scan(&messageExists)
+	if err != nil {
+		return nil, fmt.Errorf("error checking message existence: %w", err)
+	}
+	if !messageExists {
+		return nil, ErrMessageNotFound
+	}
+
+	isAuthorized, err := db.IsUserAuthorized(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAuthorized {
+		return nil, ErrUnauthorized
+	}
+
+	// Forwards pending approval are only shown to who forwarded them
+	rows, err := db.c.Query(`
+		SELECT m.conversation_id, c.is_group, m.id, m.sender_id, u.name, m.created_at
+		FROM messages m
+		JOIN conversations c ON m.conversation_id = c.id
+		JOIN user_conversations uc ON uc.conversation_id = m.conversation_id AND uc.user_id = ?
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.original_message_id = ? AND c.is_self = 0 AND (m.status != ? OR m.sender_id = ?)
+		ORDER BY m.created_at, m.id
+	`, userID, messageID, MessageStatusPending, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying forwards: %w", err)
+	}
+	defer rows.Close()
+
+	destinations := []ForwardDestination{}
+	for rows.Next() {
+		var d ForwardDestination
+		if err := rows.Scan(&d.ConversationID, &d.IsGroup, &d.MessageID, &d.ForwarderID, &d.Forwarder, &d.Timestamp); err != nil {
+			return nil, fmt.Errorf("error scanning forward: %w", err)
+		}
+		destinations = append(destinations, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating forwards: %w", err)
+	}
+
+	return destinations, nil
+}
@@ -2,9 +2,11 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -72,12 +74,12 @@ func (db *appdbimpl) AddUsersToGroup(groupID, adderID string, usernames []string
 			Username string
 			UserID   string
 		}{},
-		FailedUsers: []string{},
+		FailedUsers: []GroupAddFailure{},
 		AddedBy: User{
 			ID:   adderID,
 			Name: adderName,
 		},
-		Timestamp: time.Now(),
+		Timestamp: nowUTC(),
 	}
 
 	// Process each username
@@ -88,7 +90,7 @@ func (db *appdbimpl) AddUsersToGroup(groupID, adderID string, usernames []string
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				// User not found, add to failed users
-				result.FailedUsers = append(result.FailedUsers, username)
+				result.FailedUsers = append(result.FailedUsers, GroupAddFailure{Username: username, Reason: AddFailureNotFound})
 				continue
 			}
 			return nil, fmt.Errorf("error getting user ID: %w", err)
@@ -102,7 +104,7 @@ func (db *appdbimpl) AddUsersToGroup(groupID, adderID string, usernames []string
 		}
 		if userExists {
 			// User already in group, add to failed users
-			result.FailedUsers = append(result.FailedUsers, username)
+			result.FailedUsers = append(result.FailedUsers, GroupAddFailure{Username: username, Reason: AddFailureAlreadyMember})
 			continue
 		}
 
@@ -120,6 +122,10 @@ func (db *appdbimpl) AddUsersToGroup(groupID, adderID string, usernames []string
 			logrus.WithError(err).Warnf("Failed to add user %s to group_members table", username)
 		}
 
+		if err = recordGroupEvent(tx, groupID, GroupEventMemberAdded, adderID, userID, ""); err != nil {
+			return nil, err
+		}
+
 		// Add to successful users
 		result.AddedUsers = append(result.AddedUsers, struct {
 			Username string
@@ -202,18 +208,21 @@ func (db *appdbimpl) LeaveGroup(groupID string, userID string) (username string,
 		return "", false, 0, fmt.Errorf("error checking group member count: %w", err)
 	}
 
-	if memberCount == 0 {
-		// Delete the group from both tables
-		_, err = tx.Exec("DELETE FROM conversations WHERE id = ?", groupID)
+	// If the last admin left, hand the role over to the longest-standing member
+	if memberCount > 0 {
+		_, err = tx.Exec(promoteGroupAdminQuery, groupID, groupID)
 		if err != nil {
-			return "", false, 0, fmt.Errorf("error deleting empty group from conversations: %w", err)
+			return "", false, 0, fmt.Errorf("error promoting group admin: %w", err)
 		}
-
-		_, err = tx.Exec("DELETE FROM groups WHERE id = ?", groupID)
-		if err != nil {
-			return "", false, 0, fmt.Errorf("error deleting empty group from groups: %w", err)
+		if err = recordGroupEvent(tx, groupID, GroupEventMemberLeft, userID, userID, ""); err != nil {
+			return "", false, 0, err
 		}
+	}
 
+	if memberCount == 0 {
+		if err = deleteConversation(tx, groupID); err != nil {
+			return "", false, 0, err
+		}
 		isGroupDeleted = true
 	}
 
@@ -228,6 +237,112 @@ func (db *appdbimpl) LeaveGroup(groupID string, userID string) (username string,
 	return name, isGroupDeleted, memberCount, nil
 }
 
+// deleteConversationQueries delete a conversation with everything that refers to it, children before their parents
+// so that no foreign key is broken along the way. The group photo is left to the orphan media cleanup
+var deleteConversationQueries = []string{
+	"DELETE FROM comments WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)",
+	"DELETE FROM message_read_status WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)",
+	"DELETE FROM flagged_messages WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)",
+	"DELETE FROM message_mentions WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)",
+	"DELETE FROM link_previews WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)",
+	"DELETE FROM messages WHERE conversation_id = ?",
+	"DELETE FROM conversation_settings WHERE conversation_id = ?",
+	"DELETE FROM user_conversations WHERE conversation_id = ?",
+	"DELETE FROM group_members WHERE group_id = ?",
+	"DELETE FROM group_events WHERE group_id = ?",
+	"DELETE FROM conversations WHERE id = ?",
+	"DELETE FROM groups WHERE id = ?",
+}
+
+// deleteConversation deletes a conversation and all of its messages, memberships and settings
+func deleteConversation(tx *sql.Tx, conversationID string) error {
+	for _, query := range deleteConversationQueries {
+		if _, err := tx.Exec(query, conversationID); err != nil {
+			return fmt.Errorf("error deleting conversation: %w", err)
+		}
+	}
+	return nil
+}
+
+// promoteGroupAdminQuery makes the longest-standing member (the lowest rowid) of each group without an admin an admin.
+// It takes the group ID twice, an empty ID applying it to all groups
+const promoteGroupAdminQuery = `
+	UPDATE group_members SET role = 'admin'
+	WHERE rowid IN (
+		SELECT MIN(rowid) FROM group_members
+		WHERE ? = '' OR group_id = ?
+		GROUP BY group_id
+		HAVING SUM(role = 'admin') = 0
+	)`
+
+// Returns the admins of a group, ordered by name
+func (db *appdbimpl) GetGroupAdmins(groupID string) ([]GroupMember, error) {
+	rows, err := db.c.Query(`
+		SELECT u.id, u.name, gm.role
+		FROM group_members gm
+		JOIN users u ON gm.user_id = u.id
+		WHERE gm.group_id = ? AND gm.role = ?
+		ORDER BY u.name
+	`, groupID, RoleAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("error querying group admins: %w", err)
+	}
+	defer rows.Close()
+
+	var admins []GroupMember
+	for rows.Next() {
+		var admin GroupMember
+		if err := rows.Scan(&admin.ID, &admin.Name, &admin.Role); err != nil {
+			return nil, fmt.Errorf("error scanning group admin: %w", err)
+		}
+		admins = append(admins, admin)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating group admins: %w", err)
+	}
+
+	return admins, nil
+}
+
+// Returns the members of a group ordered by name, optionally only those whose name starts with search. Only members
+// can list them
+func (db *appdbimpl) GetGroupMembers(groupID, requesterID, search string) ([]Participant, error) {
+	isMember, err := db.IsGroupMember(groupID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrUnauthorized
+	}
+
+	rows, err := db.c.Query(`
+		SELECT u.id, u.name, COALESCE(u.photo_id, ''), u.bio, COALESCE(gm.role = ?, 0)
+		FROM user_conversations uc
+		JOIN users u ON uc.user_id = u.id
+		LEFT JOIN group_members gm ON gm.group_id = uc.conversation_id AND gm.user_id = uc.user_id
+		WHERE uc.conversation_id = ? AND u.name LIKE ? ESCAPE '\'
+		ORDER BY u.name
+	`, RoleAdmin, groupID, likeEscaper.Replace(search)+"%")
+	if err != nil {
+		return nil, fmt.Errorf("error querying group members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []Participant
+	for rows.Next() {
+		var member Participant
+		if err := rows.Scan(&member.ID, &member.Name, &member.PhotoID, &member.Bio, &member.IsAdmin); err != nil {
+			return nil, fmt.Errorf("error scanning group member: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating group members: %w", err)
+	}
+
+	return members, nil
+}
+
 // Checks if a user belongs to the group
 func (db *appdbimpl) IsGroupMember(groupID string, userID string) (bool, error) {
 	// First check if the group exists
@@ -363,6 +478,9 @@ func (db *appdbimpl) SetGroupName(groupID string, userID string, newName string)
 	if err != nil {
 		return "", "", 0, fmt.Errorf("error updating group name in groups: %w", err)
 	}
+	if err = recordGroupEvent(tx, groupID, GroupEventRenamed, userID, "", newName); err != nil {
+		return "", "", 0, err
+	}
 	// Get the current member count
 	err = tx.QueryRow("SELECT COUNT(*) FROM user_conversations WHERE conversation_id = ?", groupID).Scan(&memberCount)
 	if err != nil {
@@ -442,7 +560,7 @@ func (db *appdbimpl) SetGroupPhoto(groupID string, userID string, fileData []byt
 	_, err = tx.Exec(`
 		INSERT INTO media_files (id, file_data, mime_type, created_at)
 		VALUES (?, ?, ?, ?)
-	`, newPhotoID, fileData, contentType, time.Now())
+	`, newPhotoID, fileData, contentType, nowUTC())
 	if err != nil {
 		return "", "", fmt.Errorf("error storing photo file: %w", err)
 	}
@@ -452,6 +570,9 @@ func (db *appdbimpl) SetGroupPhoto(groupID string, userID string, fileData []byt
 	if err != nil {
 		return "", "", fmt.Errorf("error updating group photo ID in conversations: %w", err)
 	}
+	if err = recordGroupEvent(tx, groupID, GroupEventPhotoChanged, userID, "", newPhotoID); err != nil {
+		return "", "", err
+	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
@@ -480,3 +601,440 @@ func (db *appdbimpl) UserExists(userID string) (bool, error) {
 	}
 	return exists, nil
 }
+
+// Checks if a user is an admin of the group
+func (db *appdbimpl) IsGroupAdmin(groupID, userID string) (bool, error) {
+	var isAdmin bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND role = ?)",
+		groupID, userID, RoleAdmin).Scan(&isAdmin)
+	if err != nil {
+		return false, fmt.Errorf("error checking group admin: %w", err)
+	}
+	return isAdmin, nil
+}
+
+// Used by group admins to change the group settings, returns the settings after the update
+func (db *appdbimpl) UpdateGroupSettings(groupID, userID string, update GroupSettingsUpdate) (*GroupSettings, error) {
+	isMember, err := db.IsGroupMember(groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrUnauthorized
+	}
+	isAdmin, err := db.IsGroupAdmin(groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, ErrUnauthorized
+	}
+
+	var allowedReactions sql.NullString
+	if update.AllowedReactions != nil {
+		encoded, err := encodeAllowedReactions(*update.AllowedReactions)
+		if err != nil {
+			return nil, err
+		}
+		allowedReactions = sql.NullString{String: encoded, Valid: true}
+	}
+
+	// Fields left out of the update keep their current value
+	_, err = db.c.Exec(`
+		UPDATE conversations
+		SET slow_mode_seconds = COALESCE(?, slow_mode_seconds),
+			forwarding_disabled = COALESCE(?, forwarding_disabled),
+			approval_required = COALESCE(?, approval_required),
+			allowed_reactions = COALESCE(?, allowed_reactions)
+		WHERE id = ?
+	`, update.SlowModeSeconds, update.ForwardingDisabled, update.ApprovalRequired, allowedReactions, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating group settings: %w", err)
+	}
+
+	var settings GroupSettings
+	var encodedReactions string
+	err = db.c.QueryRow(`
+		SELECT slow_mode_seconds, forwarding_disabled, approval_required, allowed_reactions
+		FROM conversations
+		WHERE id = ?
+	`, groupID).Scan(
+		&settings.SlowModeSeconds,
+		&settings.ForwardingDisabled,
+		&settings.ApprovalRequired,
+		&encodedReactions,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching group settings: %w", err)
+	}
+	settings.AllowedReactions, err = decodeAllowedReactions(encodedReactions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// checkSlowMode returns ErrSlowMode if the conversation has slow mode enabled and the sender, unless they're a group
+// admin, sent their last message less than the slow mode interval ago
+func checkSlowMode(tx *sql.Tx, conversationID, senderID string) error {
+	var slowModeSeconds int
+	err := tx.QueryRow("SELECT slow_mode_seconds FROM conversations WHERE id = ?", conversationID).Scan(&slowModeSeconds)
+	if err != nil {
+		return fmt.Errorf("error checking slow mode: %w", err)
+	}
+	if slowModeSeconds == 0 {
+		return nil
+	}
+
+	var isAdmin bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND role = ?)",
+		conversationID, senderID, RoleAdmin).Scan(&isAdmin)
+	if err != nil {
+		return fmt.Errorf("error checking group admin: %w", err)
+	}
+	if isAdmin {
+		return nil
+	}
+
+	var lastSentAt time.Time
+	err = tx.QueryRow(`
+		SELECT created_at
+		FROM messages
+		WHERE conversation_id = ? AND sender_id = ?
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, conversationID, senderID).Scan(&lastSentAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error checking last message time: %w", err)
+	}
+
+	if nowUTC().Sub(lastSentAt) < time.Duration(slowModeSeconds)*time.Second {
+		return ErrSlowMode
+	}
+
+	return nil
+}
+
+// encodeAllowedReactions stores a set of allowed reactions as a JSON array, or as an empty string when the list is
+// empty and reactions are unrestricted
+func encodeAllowedReactions(reactions []string) (string, error) {
+	if len(reactions) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(reactions)
+	if err != nil {
+		return "", fmt.Errorf("error encoding allowed reactions: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// decodeAllowedReactions reverses encodeAllowedReactions, returning nil for unrestricted reactions
+func decodeAllowedReactions(encoded string) ([]string, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	var reactions []string
+	if err := json.Unmarshal([]byte(encoded), &reactions); err != nil {
+		return nil, fmt.Errorf("error decoding allowed reactions: %w", err)
+	}
+	return reactions, nil
+}
+
+// checkReactionAllowed returns ErrReactionNotAllowed if the conversation of the message restricts reactions to a set
+// of emoji that doesn't include the given one
+func checkReactionAllowed(tx *sql.Tx, messageID, emoji string) error {
+	var encoded string
+	err := tx.QueryRow(`
+		SELECT c.allowed_reactions
+		FROM messages m
+		JOIN conversations c ON m.conversation_id = c.id
+		WHERE m.id = ?
+	`, messageID).Scan(&encoded)
+	if err != nil {
+		return fmt.Errorf("error checking allowed reactions: %w", err)
+	}
+
+	allowed, err := decodeAllowedReactions(encoded)
+	if err != nil {
+		return err
+	}
+	if allowed == nil {
+		return nil
+	}
+	for _, reaction := range allowed {
+		if reaction == emoji {
+			return nil
+		}
+	}
+	return ErrReactionNotAllowed
+}
+
+// initialMessageStatus returns the status a new message from the sender starts with. In groups requiring approval the
+// messages of members other than admins wait for an admin to approve them
+func initialMessageStatus(tx *sql.Tx, conversationID, senderID string) (string, error) {
+	var approvalRequired bool
+	err := tx.QueryRow("SELECT approval_required FROM conversations WHERE id = ?", conversationID).Scan(&approvalRequired)
+	if err != nil {
+		return "", fmt.Errorf("error checking message approval: %w", err)
+	}
+	if !approvalRequired {
+		return "delivered", nil
+	}
+
+	var isAdmin bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND role = ?)",
+		conversationID, senderID, RoleAdmin).Scan(&isAdmin)
+	if err != nil {
+		return "", fmt.Errorf("error checking group admin: %w", err)
+	}
+	if isAdmin {
+		return "delivered", nil
+	}
+
+	return MessageStatusPending, nil
+}
+
+// Returns the messages of a group waiting for approval, oldest first. Only group admins can see the queue
+func (db *appdbimpl) GetPendingMessages(groupID, userID string) ([]Message, error) {
+	isMember, err := db.IsGroupMember(groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrUnauthorized
+	}
+	isAdmin, err := db.IsGroupAdmin(groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, ErrUnauthorized
+	}
+
+	messages, err := db.queryMessages(selectMessagesQuery+`
+		WHERE m.conversation_id = ? AND m.status = ? AND `+notExpiredCondition+`
+		ORDER BY m.created_at, m.id
+	`, groupID, MessageStatusPending, nowUTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Used by group admins to approve a message pending approval, delivering it to the group. Returns the approved message
+// and the group it belongs to
+func (db *appdbimpl) ApproveMessage(messageID, userID string) (*Message, string, error) {
+	var groupID, senderID, status string
+	err := db.c.QueryRow("SELECT conversation_id, sender_id, status FROM messages WHERE id = ?", messageID).Scan(&groupID, &senderID, &status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrMessageNotFound
+		}
+		return nil, "", fmt.Errorf("error fetching message: %w", err)
+	}
+
+	isAdmin, err := db.IsGroupAdmin(groupID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isAdmin {
+		// Don't reveal pending messages to members who can't see them
+		if status == MessageStatusPending && senderID != userID {
+			return nil, "", ErrMessageNotFound
+		}
+		return nil, "", ErrUnauthorized
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	// The message is numbered when it is delivered, so that clients syncing by sequence number pick it up
+	seq, err := nextMessageSeq(tx, groupID, "delivered")
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Only flip the status if nobody approved the message in the meantime
+	result, err := tx.Exec("UPDATE messages SET status = 'delivered', seq = ? WHERE id = ? AND status = ?",
+		seq, messageID, MessageStatusPending)
+	if err != nil {
+		return nil, "", fmt.Errorf("error approving message: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, "", fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, "", ErrMessageNotPending
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("error committing transaction: %w", err)
+	}
+	tx = nil
+
+	message, err := db.GetMessageByID(messageID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return message, groupID, nil
+}
+
+// Used by group admins to remove all the reactions a user added to the messages of the group, returns the number of
+// removed reactions. The removal is recorded in the history of the group
+func (db *appdbimpl) DeleteUserReactions(groupID, adminID, targetUserID string) (int, error) {
+	isMember, err := db.IsGroupMember(groupID, adminID)
+	if err != nil {
+		return 0, err
+	}
+	if !isMember {
+		return 0, ErrUnauthorized
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	var isAdmin bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND role = ?)",
+		groupID, adminID, RoleAdmin).Scan(&isAdmin)
+	if err != nil {
+		return 0, fmt.Errorf("error checking group admin: %w", err)
+	}
+	if !isAdmin {
+		return 0, ErrUnauthorized
+	}
+
+	var userExists bool
+	if err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", targetUserID).Scan(&userExists); err != nil {
+		return 0, fmt.Errorf("error checking user existence: %w", err)
+	}
+	if !userExists {
+		return 0, ErrUserNotFound
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM comments
+		WHERE user_id = ? AND message_id IN (SELECT id FROM messages WHERE conversation_id = ?)
+	`, targetUserID, groupID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting reactions: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if err = recordGroupEvent(tx, groupID, GroupEventReactionsRemoved, adminID, targetUserID,
+		strconv.FormatInt(deleted, 10)); err != nil {
+		return 0, err
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return int(deleted), nil
+}
+
+// RemoveUserFromGroup removes another member from a group on behalf of one of its admins and returns the number of
+// members left. Members leave on their own with LeaveGroup instead
+func (db *appdbimpl) RemoveUserFromGroup(groupID, removerID, targetUserID string) (remainingMemberCount int, err error) {
+	isMember, err := db.IsGroupMember(groupID, removerID)
+	if err != nil {
+		return 0, err
+	}
+	if !isMember {
+		return 0, ErrUnauthorized
+	}
+	if removerID == targetUserID {
+		return 0, ErrRemoveSelf
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	var isAdmin bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND role = ?)",
+		groupID, removerID, RoleAdmin).Scan(&isAdmin)
+	if err != nil {
+		return 0, fmt.Errorf("error checking group admin: %w", err)
+	}
+	if !isAdmin {
+		return 0, ErrUnauthorized
+	}
+
+	result, err := tx.Exec("DELETE FROM user_conversations WHERE conversation_id = ? AND user_id = ?", groupID, targetUserID)
+	if err != nil {
+		return 0, fmt.Errorf("error removing user from user_conversations: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if removed == 0 {
+		return 0, ErrUserNotFound
+	}
+	_, err = tx.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, targetUserID)
+	if err != nil {
+		return 0, fmt.Errorf("error removing user from group_members: %w", err)
+	}
+
+	if err = recordGroupEvent(tx, groupID, GroupEventMemberRemoved, removerID, targetUserID, ""); err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow("SELECT COUNT(*) FROM user_conversations WHERE conversation_id = ?", groupID).Scan(&remainingMemberCount)
+	if err != nil {
+		return 0, fmt.Errorf("error getting member count: %w", err)
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return remainingMemberCount, nil
+}
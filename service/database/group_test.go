@@ -0,0 +1,192 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSlowMode(t *testing.T) {
+	db := newTestDB(t)
+	admin := newTestUser(t, db, "alice")
+	member := newTestUser(t, db, "bob")
+	groupID, err := db.StartConversation(admin, []string{member}, "Slow", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	seconds := 60
+	if _, err := db.UpdateGroupSettings(groupID, admin, GroupSettingsUpdate{SlowModeSeconds: &seconds}); err != nil {
+		t.Fatalf("enabling slow mode: %v", err)
+	}
+
+	send := func(userID string) error {
+		_, _, _, err := db.AddMessage(groupID, userID, "text", "hello", "text/plain", nil, 0)
+		return err
+	}
+
+	if err := send(member); err != nil {
+		t.Fatalf("first message of the member: %v", err)
+	}
+	if err := send(member); !errors.Is(err, ErrSlowMode) {
+		t.Errorf("second message within the window: got %v, want ErrSlowMode", err)
+	}
+
+	// Admins are exempt
+	for i := 0; i < 3; i++ {
+		if err := send(admin); err != nil {
+			t.Errorf("message %d of the admin: %v", i+1, err)
+		}
+	}
+
+	// Once the window has passed the member can send again
+	_, err = db.(*appdbimpl).c.Exec("UPDATE messages SET created_at = ? WHERE sender_id = ?",
+		nowUTC().Add(-time.Duration(seconds)*time.Second), member)
+	if err != nil {
+		t.Fatalf("moving the member's message back in time: %v", err)
+	}
+	if err := send(member); err != nil {
+		t.Errorf("message after the window: %v", err)
+	}
+
+	// Disabling slow mode lifts the limit
+	seconds = 0
+	if _, err := db.UpdateGroupSettings(groupID, admin, GroupSettingsUpdate{SlowModeSeconds: &seconds}); err != nil {
+		t.Fatalf("disabling slow mode: %v", err)
+	}
+	if err := send(member); err != nil {
+		t.Errorf("message with slow mode disabled: %v", err)
+	}
+}
+
+func TestUpdateGroupSettingsOnlyAdmins(t *testing.T) {
+	db := newTestDB(t)
+	admin := newTestUser(t, db, "alice")
+	member := newTestUser(t, db, "bob")
+	groupID, err := db.StartConversation(admin, []string{member}, "Slow", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	seconds := 30
+	if _, err := db.UpdateGroupSettings(groupID, member, GroupSettingsUpdate{SlowModeSeconds: &seconds}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("member changing the settings: got %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestAllowedReactions(t *testing.T) {
+	db := newTestDB(t)
+	admin := newTestUser(t, db, "alice")
+	member := newTestUser(t, db, "bob")
+	groupID, err := db.StartConversation(admin, []string{member}, "Poll", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	messageID, _, _, err := db.AddMessage(groupID, admin, "text", "Pizza tonight?", "text/plain", nil, 0)
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	allowed := []string{"👍", "👎"}
+	settings, err := db.UpdateGroupSettings(groupID, admin, GroupSettingsUpdate{AllowedReactions: &allowed})
+	if err != nil {
+		t.Fatalf("restricting reactions: %v", err)
+	}
+	if len(settings.AllowedReactions) != 2 {
+		t.Errorf("allowed reactions = %v, want %v", settings.AllowedReactions, allowed)
+	}
+
+	if _, err := db.AddComment(messageID, member, "👍", true); err != nil {
+		t.Errorf("allowed reaction rejected: %v", err)
+	}
+	if _, err := db.AddComment(messageID, member, "❤️", true); !errors.Is(err, ErrReactionNotAllowed) {
+		t.Errorf("disallowed reaction: got %v, want ErrReactionNotAllowed", err)
+	}
+	// The restriction applies to admins too
+	if _, err := db.AddComment(messageID, admin, "😂", true); !errors.Is(err, ErrReactionNotAllowed) {
+		t.Errorf("disallowed reaction of the admin: got %v, want ErrReactionNotAllowed", err)
+	}
+
+	details, err := db.GetConversationInfo(groupID, member)
+	if err != nil {
+		t.Fatalf("GetConversationInfo: %v", err)
+	}
+	if len(details.Settings.AllowedReactions) != 2 {
+		t.Errorf("conversation detail allows %v, want %v", details.Settings.AllowedReactions, allowed)
+	}
+
+	// An empty set lifts the restriction
+	allowed = []string{}
+	if _, err := db.UpdateGroupSettings(groupID, admin, GroupSettingsUpdate{AllowedReactions: &allowed}); err != nil {
+		t.Fatalf("lifting the restriction: %v", err)
+	}
+	if _, err := db.AddComment(messageID, member, "❤️", true); err != nil {
+		t.Errorf("reaction rejected once unrestricted: %v", err)
+	}
+}
+
+func TestLeaveGroupLastMember(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	groupID, err := db.StartConversation(alice, []string{bob}, "Short lived", true)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	name, deleted, remaining, err := db.LeaveGroup(groupID, bob)
+	if err != nil || deleted || remaining != 1 || name != "bob" {
+		t.Fatalf("first member leaving = %q, %v, %d, %v, want bob, false, 1", name, deleted, remaining, err)
+	}
+
+	name, deleted, remaining, err = db.LeaveGroup(groupID, alice)
+	if err != nil {
+		t.Fatalf("last member leaving: %v", err)
+	}
+	if !deleted || remaining != 0 || name != "alice" {
+		t.Errorf("last member leaving = %q, %v, %d, want alice, true, 0", name, deleted, remaining)
+	}
+
+	for _, query := range []string{
+		"SELECT COUNT(*) FROM conversations WHERE id = ?",
+		"SELECT COUNT(*) FROM groups WHERE id = ?",
+		"SELECT COUNT(*) FROM group_members WHERE group_id = ?",
+	} {
+		var count int
+		if err := db.(*appdbimpl).c.QueryRow(query, groupID).Scan(&count); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if count != 0 {
+			t.Errorf("%s = %d, want 0", query, count)
+		}
+	}
+}
+
+func TestSetGroupNameTaken(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	if _, err := db.StartConversation(alice, []string{bob}, "Climbing", true); err != nil {
+		t.Fatalf("creating the first group: %v", err)
+	}
+	groupID, err := db.StartConversation(alice, []string{bob}, "Running", true)
+	if err != nil {
+		t.Fatalf("creating the second group: %v", err)
+	}
+
+	oldName, newName, memberCount, err := db.SetGroupName(groupID, alice, "Climbing")
+	if !errors.Is(err, ErrNameAlreadyTaken) {
+		t.Fatalf("renaming to a taken name: got %v, want ErrNameAlreadyTaken", err)
+	}
+	if oldName != "" || newName != "" || memberCount != 0 {
+		t.Errorf("renaming to a taken name returned %q, %q, %d, want zero values", oldName, newName, memberCount)
+	}
+
+	details, err := db.GetConversationInfo(groupID, alice)
+	if err != nil {
+		t.Fatalf("GetConversationInfo: %v", err)
+	}
+	if details.Title != "Running" {
+		t.Errorf("group renamed to %q, want it kept as Running", details.Title)
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Types of the events recorded in the history of a group
+const (
+	GroupEventCreated          = "created"
+	GroupEventMemberAdded      = "member_added"
+	GroupEventMemberLeft       = "member_left"
+	GroupEventMemberRemoved    = "member_removed"
+	GroupEventRenamed          = "renamed"
+	GroupEventPhotoChanged     = "photo_changed"
+	GroupEventReactionsRemoved = "reactions_removed"
+)
+
+// recordGroupEvent adds an event to the history of a group, within the transaction that made the change. targetID is
+// the member an event is about, and is empty for events about the group itself
+func recordGroupEvent(tx *sql.Tx, groupID, eventType, actorID, targetID, details string) error {
+	var target sql.NullString
+	if targetID != "" {
+		target = sql.NullString{String: targetID, Valid: true}
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO group_events (group_id, type, actor_id, target_id, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, groupID, eventType, actorID, target, details, nowUTC())
+	if err != nil {
+		return fmt.Errorf("error recording group event: %w", err)
+	}
+	return nil
+}
+
+// GetGroupTimeline returns a page of the history of a group in chronological order, along with the total number of
+// events. Only members can see it
+func (db *appdbimpl) GetGroupTimeline(groupID, userID string, limit, offset int) ([]GroupEvent, int, error) {
+	isMember, err := db.IsGroupMember(groupID, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !isMember {
+		return nil, 0, ErrUnauthorized
+	}
+
+	var total int
+	err = db.c.QueryRow("SELECT COUNT(*) FROM group_events WHERE group_id = ?", groupID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting group events: %w", err)
+	}
+
+	rows, err := db.c.Query(`
+		SELECT e.id, e.type, e.actor_id, a.name, e.target_id, t.name, e.details, e.created_at
+		FROM group_events e
+		JOIN users a ON e.actor_id = a.id
+		LEFT JOIN users t ON e.target_id = t.id
+		WHERE e.group_id = ?
+		ORDER BY e.created_at, e.id
+		LIMIT ? OFFSET ?
+	`, groupID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching group events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []GroupEvent
+	for rows.Next() {
+		var e GroupEvent
+		var targetID, targetName sql.NullString
+		if err := rows.Scan(&e.ID, &e.Type, &e.Actor.ID, &e.Actor.Name, &targetID, &targetName, &e.Details, &e.Timestamp); err != nil {
+			return nil, 0, fmt.Errorf("error scanning group event: %w", err)
+		}
+		if targetID.Valid {
+			e.Target = &User{ID: targetID.String, Name: targetName.String}
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating group events: %w", err)
+	}
+
+	return events, total, nil
+}
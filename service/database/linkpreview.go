@@ -0,0 +1,48 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// LinkPreview describes the page linked to by a text message. Any field but URL can be empty
+type LinkPreview struct {
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+// SetLinkPreview stores the preview of the link in a message, replacing any previous one. Messages deleted or
+// expired in the meantime are left without a preview
+func (db *appdbimpl) SetLinkPreview(messageID string, preview LinkPreview) error {
+	_, err := db.c.Exec(`
+		INSERT INTO link_previews (message_id, url, title, description, image_url, site_name, created_at)
+		SELECT id, ?, ?, ?, ?, ?, ? FROM messages WHERE id = ? AND type != ?
+		ON CONFLICT (message_id) DO UPDATE SET
+			url = excluded.url,
+			title = excluded.title,
+			description = excluded.description,
+			image_url = excluded.image_url,
+			site_name = excluded.site_name,
+			created_at = excluded.created_at
+	`, preview.URL, preview.Title, preview.Description, preview.ImageURL, preview.SiteName, nowUTC(),
+		messageID, MessageTypeDeleted)
+	if err != nil {
+		return fmt.Errorf("error storing link preview: %w", err)
+	}
+	return nil
+}
+
+// copyLinkPreview gives a forwarded or saved copy of a message the preview of the original, if it has one
+func copyLinkPreview(tx *sql.Tx, fromMessageID, toMessageID string) error {
+	_, err := tx.Exec(`
+		INSERT INTO link_previews (message_id, url, title, description, image_url, site_name, created_at)
+		SELECT ?, url, title, description, image_url, site_name, created_at FROM link_previews WHERE message_id = ?
+	`, toMessageID, fromMessageID)
+	if err != nil {
+		return fmt.Errorf("error copying link preview: %w", err)
+	}
+	return nil
+}
@@ -5,13 +5,78 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-// StoreMediaFile stores a media file in the database and returns its ID
-func (db *appdbimpl) StoreMediaFile(fileData []byte, mimeType string) (string, error) {
+// StoreMediaFile stores a media file in the database and returns its ID. filename is the original name of attached
+// files, empty for photos and recordings. Images larger than the thumbnail size also get a thumbnail, stored as a
+// separate media file whose ID is returned as well, empty when there is none
+func (db *appdbimpl) StoreMediaFile(fileData []byte, mimeType, filename string) (string, string, error) {
+	thumbnail, thumbnailMimeType := makeThumbnail(fileData)
+
+	mediaID, err := db.generateMediaID()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Start a transaction
+	tx, err := db.c.Begin()
+	if err != nil {
+		return "", "", fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	// Insert the media file
+	_, err = tx.Exec(`
+		INSERT INTO media_files (id, file_data, mime_type, created_at, filename)
+		VALUES (?, ?, ?, ?, ?)
+	`, mediaID, fileData, mimeType, nowUTC(), sql.NullString{String: filename, Valid: filename != ""})
+
+	if err != nil {
+		return "", "", fmt.Errorf("error storing media file: %w", err)
+	}
+
+	// The thumbnail is named after the original, which is unique already
+	var thumbnailID string
+	if thumbnail != nil {
+		thumbnailID = mediaID + "_thumb"
+		_, err = tx.Exec(`
+			INSERT INTO media_files (id, file_data, mime_type, created_at)
+			VALUES (?, ?, ?, ?)
+		`, thumbnailID, thumbnail, thumbnailMimeType, nowUTC())
+		if err != nil {
+			return "", "", fmt.Errorf("error storing thumbnail: %w", err)
+		}
+		_, err = tx.Exec("UPDATE media_files SET thumbnail_id = ? WHERE id = ?", thumbnailID, mediaID)
+		if err != nil {
+			return "", "", fmt.Errorf("error storing thumbnail: %w", err)
+		}
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return mediaID, thumbnailID, nil
+}
+
+// generateMediaID creates a unique media ID, "media" followed by the current time in nanoseconds
+func (db *appdbimpl) generateMediaID() (string, error) {
 	// Try up to 10 times to generate a unique ID
 	for i := 0; i < 10; i++ {
 		// Generate a timestamp-based ID with a prefix
@@ -41,67 +106,357 @@ func (db *appdbimpl) StoreMediaFile(fileData []byte, mimeType string) (string, e
 			return "", fmt.Errorf("error checking media ID existence: %w", err)
 		}
 
-		// If the ID already exists, try again
-		if exists {
-			time.Sleep(1 * time.Millisecond) // Small delay to ensure different timestamp
-			continue
+		// If the ID doesn't exist, return it
+		if !exists {
+			return mediaID, nil
 		}
+		time.Sleep(1 * time.Millisecond) // Small delay to ensure different timestamp
+	}
 
-		// Start a transaction
-		tx, err := db.c.Begin()
-		if err != nil {
-			return "", fmt.Errorf("error starting transaction: %w", err)
+	// If impossible to generate
+	return "", fmt.Errorf("failed to generate a unique media ID after multiple attempts")
+}
+
+// GetMediaFile retrieves a media file by its ID, from the database or from cold storage once it has been archived
+func (db *appdbimpl) GetMediaFile(mediaID string) ([]byte, string, error) {
+	var fileData []byte
+	var mimeType string
+	var coldKey sql.NullString
+
+	err := db.c.QueryRow(`
+		SELECT file_data, mime_type, cold_key FROM media_files WHERE id = ?
+	`, mediaID).Scan(&fileData, &mimeType, &coldKey)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrMediaNotFound
 		}
+		return nil, "", fmt.Errorf("error retrieving media file: %w", err)
+	}
 
-		// Ensure transaction is rolled back if an error occurs
-		defer func() {
-			if tx != nil {
-				if rollbackErr := tx.Rollback(); rollbackErr != nil {
-					logrus.WithError(rollbackErr).Error("Error rolling back transaction")
-				}
-			}
-		}()
+	if !coldKey.Valid {
+		atomic.AddInt64(&db.hotMediaHits, 1)
+		return fileData, mimeType, nil
+	}
 
-		// Insert the media file
-		_, err = tx.Exec(`
-			INSERT INTO media_files (id, file_data, mime_type, created_at)
-			VALUES (?, ?, ?, ?)
-		`, mediaID, fileData, mimeType, time.Now())
+	if db.coldStore == nil {
+		return nil, "", fmt.Errorf("error retrieving archived media file: %w", ErrNoColdStore)
+	}
+	fileData, err = db.coldStore.Get(coldKey.String)
+	if err != nil {
+		return nil, "", fmt.Errorf("error retrieving archived media file: %w", err)
+	}
+	atomic.AddInt64(&db.coldMediaHits, 1)
 
-		if err != nil {
-			return "", fmt.Errorf("error storing media file: %w", err)
+	return fileData, mimeType, nil
+}
+
+// GetMediaThumbnail retrieves the thumbnail of a media file, or the file itself when it has no thumbnail because it
+// isn't an image or is small already
+func (db *appdbimpl) GetMediaThumbnail(mediaID string) ([]byte, string, error) {
+	var thumbnailID sql.NullString
+	err := db.c.QueryRow("SELECT thumbnail_id FROM media_files WHERE id = ?", mediaID).Scan(&thumbnailID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error retrieving thumbnail: %w", err)
+	}
+
+	if !thumbnailID.Valid {
+		return db.GetMediaFile(mediaID)
+	}
+	return db.GetMediaFile(thumbnailID.String)
+}
+
+// GetMediaFilename returns the original name of an attached file, or an empty string for media uploaded without one
+func (db *appdbimpl) GetMediaFilename(mediaID string) (string, error) {
+	var filename sql.NullString
+	err := db.c.QueryRow("SELECT filename FROM media_files WHERE id = ?", mediaID).Scan(&filename)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMediaNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("error retrieving media filename: %w", err)
+	}
+
+	return filename.String, nil
+}
+
+// SetColdStore sets where ArchiveMedia moves media files to. It must be called before the database is used
+func (db *appdbimpl) SetColdStore(store ColdStore) {
+	db.coldStore = store
+}
+
+// GetMediaHits returns how many media files were served from the database and from cold storage since startup
+func (db *appdbimpl) GetMediaHits() (int64, int64) {
+	return atomic.LoadInt64(&db.hotMediaHits), atomic.LoadInt64(&db.coldMediaHits)
+}
+
+// ArchiveMedia moves up to limit media files created before olderThan from the database to cold storage, oldest
+// first, leaving their rows in place with an empty content and the cold storage key. Files are moved one at a time
+// and written to cold storage before their content is dropped, so an interruption never loses a file. Returns the
+// number of archived files and the bytes moved out of the database
+func (db *appdbimpl) ArchiveMedia(olderThan time.Time, limit int) (int, int64, error) {
+	if db.coldStore == nil {
+		return 0, 0, ErrNoColdStore
+	}
+
+	rows, err := db.c.Query(`
+		SELECT id FROM media_files
+		WHERE cold_key IS NULL AND created_at < ?
+		ORDER BY created_at
+		LIMIT ?
+	`, olderThan.UTC(), limit)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error querying media to archive: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("error scanning media to archive: %w", err)
 		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, 0, fmt.Errorf("error iterating media to archive: %w", err)
+	}
+	rows.Close()
 
-		// Commit the transaction
-		if err = tx.Commit(); err != nil {
-			return "", fmt.Errorf("error committing transaction: %w", err)
+	var archived int
+	var bytes int64
+	for _, id := range ids {
+		var fileData []byte
+		err := db.c.QueryRow("SELECT file_data FROM media_files WHERE id = ? AND cold_key IS NULL", id).Scan(&fileData)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted or archived in the meantime
+			continue
+		}
+		if err != nil {
+			return archived, bytes, fmt.Errorf("error reading media to archive: %w", err)
 		}
 
-		// Set tx to nil to prevent rollback in defer function
-		tx = nil
+		if err := db.coldStore.Put(id, fileData); err != nil {
+			return archived, bytes, err
+		}
+		_, err = db.c.Exec(`
+			UPDATE media_files SET file_data = X'', cold_key = ?, cold_size = ?
+			WHERE id = ? AND cold_key IS NULL
+		`, id, len(fileData), id)
+		if err != nil {
+			return archived, bytes, fmt.Errorf("error archiving media file: %w", err)
+		}
 
-		return mediaID, nil
+		archived++
+		bytes += int64(len(fileData))
 	}
 
-	// If impossible to generate
-	return "", fmt.Errorf("failed to generate a unique media ID after multiple attempts")
+	return archived, bytes, nil
 }
 
-// GetMediaFile retrieves a media file from the database by its ID
-func (db *appdbimpl) GetMediaFile(mediaID string) ([]byte, string, error) {
-	var fileData []byte
-	var mimeType string
+// mediaMessageCondition selects the messages with an attachment, whose content is the path of their media file. Text
+// messages can contain such a path too, but don't give access to the file
+const mediaMessageCondition = "m.type IN ('photo', 'audio', 'file')"
 
+// isMediaMessageType reports whether messages of a type have an attachment, see mediaMessageCondition
+func isMediaMessageType(messageType string) bool {
+	return messageType == "photo" || messageType == "audio" || messageType == "file"
+}
+
+// CanAccessMedia checks whether a user is allowed to see a media file. Profile photos are visible to everyone, while
+// group photos and message attachments are only visible to the participants of the conversation they belong to.
+// Attachments of messages pending approval or expired aren't visible
+func (db *appdbimpl) CanAccessMedia(userID, mediaID string) (bool, error) {
+	// A single existence query, so the check stays cheap even when the media is not visible
+	var canAccess bool
 	err := db.c.QueryRow(`
-		SELECT file_data, mime_type FROM media_files WHERE id = ?
-	`, mediaID).Scan(&fileData, &mimeType)
+		SELECT EXISTS(SELECT 1 FROM users WHERE photo_id = ?)
+			OR EXISTS(
+				SELECT 1
+				FROM conversations c
+				JOIN user_conversations uc ON c.id = uc.conversation_id
+				WHERE c.profile_photo = ? AND uc.user_id = ?
+			)
+			OR EXISTS(
+				SELECT 1
+				FROM messages m
+				JOIN user_conversations uc ON m.conversation_id = uc.conversation_id
+				WHERE m.content = ? AND uc.user_id = ? AND `+mediaMessageCondition+` AND m.status != ? AND
+					(m.expires_at IS NULL OR m.expires_at > ?)
+			)
+	`, mediaID, mediaID, userID, "/media/"+mediaID, userID, MessageStatusPending, nowUTC()).Scan(&canAccess)
+	if err != nil {
+		return false, fmt.Errorf("error checking media access: %w", err)
+	}
+
+	return canAccess, nil
+}
+
+// MediaStorageStats summarizes the media files stored in the database. Counts and sizes include archived files,
+// which are also counted apart in ColdCount and ColdBytes
+type MediaStorageStats struct {
+	Count      int
+	TotalBytes int64
+	ByMimeType []MimeTypeUsage
+	Oldest     *time.Time
+	ColdCount  int
+	ColdBytes  int64
+}
+
+// MimeTypeUsage is the storage used by the media files of a mime type
+type MimeTypeUsage struct {
+	MimeType string
+	Count    int
+	Bytes    int64
+}
 
+// GetMediaStorageStats returns the number and size of stored media files, overall and by mime type
+func (db *appdbimpl) GetMediaStorageStats() (*MediaStorageStats, error) {
+	rows, err := db.c.Query(`
+		SELECT mime_type, COUNT(*), COALESCE(SUM(LENGTH(file_data) + cold_size), 0)
+		FROM media_files
+		GROUP BY mime_type
+		ORDER BY SUM(LENGTH(file_data) + cold_size) DESC
+	`)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, "", fmt.Errorf("media file not found: %w", err)
+		return nil, fmt.Errorf("error querying media storage: %w", err)
+	}
+	defer rows.Close()
+
+	stats := &MediaStorageStats{ByMimeType: []MimeTypeUsage{}}
+	for rows.Next() {
+		var usage MimeTypeUsage
+		if err := rows.Scan(&usage.MimeType, &usage.Count, &usage.Bytes); err != nil {
+			return nil, fmt.Errorf("error scanning media storage: %w", err)
 		}
-		return nil, "", fmt.Errorf("error retrieving media file: %w", err)
+		stats.ByMimeType = append(stats.ByMimeType, usage)
+		stats.Count += usage.Count
+		stats.TotalBytes += usage.Bytes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating media storage: %w", err)
 	}
 
-	return fileData, mimeType, nil
+	// MIN() would lose the column type, so the oldest timestamp is read as a row
+	var oldest time.Time
+	err = db.c.QueryRow("SELECT created_at FROM media_files ORDER BY created_at LIMIT 1").Scan(&oldest)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error querying oldest media: %w", err)
+	}
+	if err == nil {
+		stats.Oldest = &oldest
+	}
+
+	err = db.c.QueryRow("SELECT COUNT(*), COALESCE(SUM(cold_size), 0) FROM media_files WHERE cold_key IS NOT NULL").
+		Scan(&stats.ColdCount, &stats.ColdBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error querying archived media: %w", err)
+	}
+
+	return stats, nil
+}
+
+// DeleteOrphanMedia deletes media files created before olderThan that no profile, group, message or other media file
+// refers to. Thumbnails are thus deleted by the run after the one deleting their original. Files
+// are deleted batchSize at a time, each batch in its own transaction, so that other writes aren't blocked for long.
+// Returns the number of deleted files and the bytes freed
+func (db *appdbimpl) DeleteOrphanMedia(olderThan time.Time, batchSize int) (int, int64, error) {
+	var deleted int
+	var freedBytes int64
+	for {
+		count, bytes, err := db.deleteOrphanMediaBatch(olderThan, batchSize)
+		if err != nil {
+			return deleted, freedBytes, err
+		}
+		deleted += count
+		freedBytes += bytes
+		if count < batchSize {
+			return deleted, freedBytes, nil
+		}
+	}
+}
+
+func (db *appdbimpl) deleteOrphanMediaBatch(olderThan time.Time, batchSize int) (int, int64, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	rows, err := tx.Query(`
+		SELECT f.id, LENGTH(f.file_data) + f.cold_size, f.cold_key
+		FROM media_files f
+		WHERE f.created_at < ?
+			AND NOT EXISTS(SELECT 1 FROM users WHERE photo_id = f.id)
+			AND NOT EXISTS(SELECT 1 FROM conversations WHERE profile_photo = f.id)
+			AND NOT EXISTS(SELECT 1 FROM messages WHERE content = '/media/' || f.id)
+			AND NOT EXISTS(SELECT 1 FROM media_files o WHERE o.thumbnail_id = f.id)
+		LIMIT ?
+	`, olderThan.UTC(), batchSize)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error querying orphan media: %w", err)
+	}
+
+	var ids, coldKeys []string
+	var bytes int64
+	for rows.Next() {
+		var id string
+		var size int64
+		var coldKey sql.NullString
+		if err := rows.Scan(&id, &size, &coldKey); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("error scanning orphan media: %w", err)
+		}
+		ids = append(ids, id)
+		bytes += size
+		if coldKey.Valid {
+			coldKeys = append(coldKeys, coldKey.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, 0, fmt.Errorf("error iterating orphan media: %w", err)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if _, err := tx.Exec("DELETE FROM media_files WHERE id = ?", id); err != nil {
+			return 0, 0, fmt.Errorf("error deleting orphan media: %w", err)
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	// Archived files are only deleted once no saved copy of the media uses them anymore
+	for _, key := range coldKeys {
+		var used bool
+		if err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM media_files WHERE cold_key = ?)", key).Scan(&used); err != nil {
+			return len(ids), bytes, fmt.Errorf("error checking archived media use: %w", err)
+		}
+		if used || db.coldStore == nil {
+			continue
+		}
+		if err := db.coldStore.Delete(key); err != nil {
+			return len(ids), bytes, err
+		}
+	}
+
+	return len(ids), bytes, nil
 }
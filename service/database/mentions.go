@@ -0,0 +1,146 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mention represents a message in which a user was mentioned
+type Mention struct {
+	MessageID      string
+	ConversationID string
+	SenderID       string
+	Sender         string
+	Type           string
+	Content        string
+	Timestamp      time.Time
+}
+
+// AddMentions records the users mentioned in a message. Usernames that aren't participants of the message's
+// conversation are ignored, as is the sender mentioning themselves. Returns the mentioned users in the order they
+// were given
+func (db *appdbimpl) AddMentions(messageID string, usernames []string) ([]User, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	var conversationID, senderID string
+	err = tx.QueryRow("SELECT conversation_id, sender_id FROM messages WHERE id = ?", messageID).Scan(&conversationID, &senderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting message: %w", err)
+	}
+
+	mentioned := []User{}
+	for _, username := range usernames {
+		var user User
+		err := tx.QueryRow(`
+			SELECT u.id, u.name
+			FROM users u
+			JOIN user_conversations uc ON u.id = uc.user_id
+			WHERE uc.conversation_id = ? AND u.name = ?
+		`, conversationID, username).Scan(&user.ID, &user.Name)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error resolving mention: %w", err)
+		}
+		if user.ID == senderID {
+			continue
+		}
+
+		result, err := tx.Exec(
+			"INSERT OR IGNORE INTO message_mentions (message_id, user_id) VALUES (?, ?)", messageID, user.ID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error adding mention: %w", err)
+		}
+		// The same user mentioned twice is only listed once
+		if rowsAffected, err := result.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("error checking rows affected: %w", err)
+		} else if rowsAffected > 0 {
+			mentioned = append(mentioned, user)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return mentioned, nil
+}
+
+// GetMentions returns a page of the messages in which the user was mentioned, newest first, and their total number.
+// Messages in conversations the user has left, deleted, expired or still pending approval are skipped
+func (db *appdbimpl) GetMentions(userID string, limit, offset int) ([]Mention, int, error) {
+	const fromMentions = `
+		FROM message_mentions mm
+		JOIN messages m ON mm.message_id = m.id
+		JOIN users u ON m.sender_id = u.id
+		JOIN user_conversations uc ON m.conversation_id = uc.conversation_id AND uc.user_id = mm.user_id
+		WHERE mm.user_id = ? AND m.type != ? AND m.status != ? AND (m.expires_at IS NULL OR m.expires_at > ?)`
+	now := nowUTC()
+
+	var total int
+	err := db.c.QueryRow("SELECT COUNT(*)"+fromMentions, userID, MessageTypeDeleted, MessageStatusPending, now).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting mentions: %w", err)
+	}
+
+	rows, err := db.c.Query(`
+		SELECT m.id, m.conversation_id, m.sender_id, u.name, m.type, m.content, m.created_at`+fromMentions+`
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ? OFFSET ?
+	`, userID, MessageTypeDeleted, MessageStatusPending, now, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying mentions: %w", err)
+	}
+	defer rows.Close()
+
+	mentions := []Mention{}
+	for rows.Next() {
+		var mention Mention
+		err := rows.Scan(
+			&mention.MessageID,
+			&mention.ConversationID,
+			&mention.SenderID,
+			&mention.Sender,
+			&mention.Type,
+			&mention.Content,
+			&mention.Timestamp,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning mention: %w", err)
+		}
+		mentions = append(mentions, mention)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating mentions: %w", err)
+	}
+
+	return mentions, total, nil
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MaxPinnedConversations is the number of conversations a user can pin to the top of their conversation list
+const MaxPinnedConversations = 3
+
+// PinConversation pins a conversation to the top of the user's conversation list and returns when it was pinned.
+// Pinning an already pinned conversation keeps its original pin time
+func (db *appdbimpl) PinConversation(conversationID, userID string) (time.Time, error) {
+	isParticipant, err := db.IsUserInConversation(userID, conversationID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !isParticipant {
+		return time.Time{}, ErrUnauthorized
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	// The conversation with oneself isn't part of the conversation list, so it can't be pinned either
+	var pinnedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT uc.pinned_at
+		FROM user_conversations uc
+		JOIN conversations c ON uc.conversation_id = c.id AND c.is_self = 0
+		WHERE uc.conversation_id = ? AND uc.user_id = ?
+	`, conversationID, userID).Scan(&pinnedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrConversationNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error checking pinned conversation: %w", err)
+	}
+	if pinnedAt.Valid {
+		return pinnedAt.Time, nil
+	}
+
+	var pinnedCount int
+	err = tx.QueryRow(`
+		SELECT COUNT(*)
+		FROM user_conversations uc
+		JOIN conversations c ON uc.conversation_id = c.id AND c.is_self = 0
+		WHERE uc.user_id = ? AND uc.pinned_at IS NOT NULL
+	`, userID).Scan(&pinnedCount)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error counting pinned conversations: %w", err)
+	}
+	if pinnedCount >= MaxPinnedConversations {
+		return time.Time{}, ErrTooManyPinned
+	}
+
+	now := nowUTC()
+	_, err = tx.Exec("UPDATE user_conversations SET pinned_at = ? WHERE conversation_id = ? AND user_id = ?",
+		now, conversationID, userID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error pinning conversation: %w", err)
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return time.Time{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return now, nil
+}
+
+// UnpinConversation moves a pinned conversation back among the others in the user's conversation list. Unpinning a
+// conversation that isn't pinned succeeds
+func (db *appdbimpl) UnpinConversation(conversationID, userID string) error {
+	isParticipant, err := db.IsUserInConversation(userID, conversationID)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return ErrUnauthorized
+	}
+
+	_, err = db.c.Exec("UPDATE user_conversations SET pinned_at = NULL WHERE conversation_id = ? AND user_id = ?",
+		conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("error unpinning conversation: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"fmt"
+)
+
+// GetReactions returns a page of the reactions on a message the user can see, optionally only those with the given
+// emoji, along with the total number of matching reactions
+func (db *appdbimpl) GetReactions(messageID, userID, emoji string, limit, offset int) ([]Comment, int, error) {
+	var messageExists bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ?)", messageID).Scan(&messageExists)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error checking message existence: %w", err)
+	}
+	if !messageExists {
+		return nil, 0, ErrMessageNotFound
+	}
+
+	isAuthorized, err := db.IsUserAuthorized(userID, messageID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !isAuthorized {
+		return nil, 0, ErrUnauthorized
+	}
+
+	// An empty emoji matches every reaction
+	var total int
+	err = db.c.QueryRow(`
+		SELECT COUNT(*)
+		FROM comments
+		WHERE message_id = ? AND (? = '' OR content = ?)
+	`, messageID, emoji, emoji).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting reactions: %w", err)
+	}
+
+	rows, err := db.c.Query(`
+		SELECT c.id, c.message_id, c.user_id, u.name, c.content, c.created_at
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.message_id = ? AND (? = '' OR c.content = ?)
+		ORDER BY c.created_at, c.id
+		LIMIT ? OFFSET ?
+	`, messageID, emoji, emoji, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching reactions: %w", err)
+	}
+	defer rows.Close()
+
+	var reactions []Comment
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.MessageID, &c.UserID, &c.Username, &c.Content, &c.Timestamp); err != nil {
+			return nil, 0, fmt.Errorf("error scanning reaction: %w", err)
+		}
+		reactions = append(reactions, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating reactions: %w", err)
+	}
+
+	return reactions, total, nil
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// savedMessagesTitle is the title of every user's self-conversation
+const savedMessagesTitle = "Saved Messages"
+
+// SaveMessage copies a message the user can see into their Saved Messages self-conversation, creating it on first
+// use. Media is copied too, so the saved message outlives the original. Returns the saved copy and the ID of the
+// self-conversation
+func (db *appdbimpl) SaveMessage(messageID, userID string) (*ForwardedMessage, string, error) {
+	// Check if the message exists and the user can see it
+	var messageExists bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND type != ?)", messageID, MessageTypeDeleted).Scan(&messageExists)
+	if err != nil {
+		return nil, "", fmt.Errorf("error checking message existence: %w", err)
+	}
+	if !messageExists {
+		return nil, "", ErrMessageNotFound
+	}
+	isAuthorized, err := db.IsUserAuthorized(userID, messageID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isAuthorized {
+		return nil, "", ErrUnauthorized
+	}
+	if err := db.checkForwardingAllowed(messageID); err != nil {
+		return nil, "", err
+	}
+
+	// Start a transaction
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	// Fetch the original message with sender information
+	var original ForwardedMessage
+	var duration sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT m.sender_id, u.name, m.type, m.content, COALESCE(m.content_type, ''), m.created_at, m.duration
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.id = ?
+	`, messageID).Scan(
+		&original.OriginalSender.ID,
+		&original.OriginalSender.Name,
+		&original.Type,
+		&original.Content,
+		&original.ContentType,
+		&original.OriginalTimestamp,
+		&duration,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching original message: %w", err)
+	}
+
+	conversationID, err := db.getOrCreateSavedConversation(tx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Copy the media file, so that deleting the original doesn't affect the saved message. Archived media shares the
+	// cold storage file, which is only deleted with the last media file using it, and the copy shares the thumbnail
+	if isMediaMessageType(original.Type) {
+		newMediaID, err := db.generateMediaID()
+		if err != nil {
+			return nil, "", err
+		}
+		result, err := tx.Exec(`
+			INSERT INTO media_files (id, file_data, mime_type, created_at, cold_key, cold_size, thumbnail_id, filename)
+			SELECT ?, file_data, mime_type, ?, cold_key, cold_size, thumbnail_id, filename
+			FROM media_files
+			WHERE id = ?
+		`, newMediaID, nowUTC(), strings.TrimPrefix(original.Content, "/media/"))
+		if err != nil {
+			return nil, "", fmt.Errorf("error copying media file: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, "", fmt.Errorf("error checking rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return nil, "", ErrMediaNotFound
+		}
+		original.Content = "/media/" + newMediaID
+	}
+
+	newMessageID, err := db.GenerateMessageID()
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating message ID: %w", err)
+	}
+	seq, err := nextMessageSeq(tx, conversationID, "read")
+	if err != nil {
+		return nil, "", err
+	}
+	now := nowUTC()
+
+	_, err = tx.Exec(`
+		INSERT INTO messages (
+			id, conversation_id, sender_id, type, content, content_type,
+			created_at, status, is_forwarded, original_sender_id, original_timestamp, original_message_id, seq, duration
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		newMessageID,
+		conversationID,
+		userID,
+		original.Type,
+		original.Content,
+		original.ContentType,
+		now,
+		"read",
+		true,
+		original.OriginalSender.ID,
+		original.OriginalTimestamp,
+		messageID,
+		seq,
+		duration,
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("error inserting saved message: %w", err)
+	}
+	if err := copyLinkPreview(tx, messageID, newMessageID); err != nil {
+		return nil, "", err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	original.ID = newMessageID
+	original.SenderID = userID
+	original.Timestamp = now
+	original.Status = "read"
+
+	return &original, conversationID, nil
+}
+
+// Returns the ID of the user's Saved Messages conversation, creating it if it doesn't exist yet
+func (db *appdbimpl) getOrCreateSavedConversation(tx *sql.Tx, userID string) (string, error) {
+	var conversationID string
+	err := tx.QueryRow(`
+		SELECT c.id
+		FROM conversations c
+		JOIN user_conversations uc ON c.id = uc.conversation_id
+		WHERE c.is_self = 1 AND uc.user_id = ?
+	`, userID).Scan(&conversationID)
+	if err == nil {
+		return conversationID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("error querying saved messages conversation: %w", err)
+	}
+
+	conversationID, err = db.GenerateConversationID()
+	if err != nil {
+		return "", fmt.Errorf("error generating conversation ID: %w", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO conversations (id, title, profile_photo, is_group, is_self, created_at) VALUES (?, ?, NULL, 0, 1, ?)",
+		conversationID, savedMessagesTitle, nowUTC())
+	if err != nil {
+		return "", fmt.Errorf("error creating saved messages conversation: %w", err)
+	}
+	_, err = tx.Exec("INSERT INTO user_conversations (user_id, conversation_id) VALUES (?, ?)", userID, conversationID)
+	if err != nil {
+		return "", fmt.Errorf("error adding user to saved messages conversation: %w", err)
+	}
+
+	return conversationID, nil
+}
+
+// GetSavedMessages returns the messages in the user's Saved Messages conversation, most recently saved first
+func (db *appdbimpl) GetSavedMessages(userID string) ([]ForwardedMessage, error) {
+	rows, err := db.c.Query(`
+		SELECT m.id, m.sender_id, m.type, m.content, COALESCE(m.content_type, ''), m.created_at, m.status,
+			COALESCE(m.original_sender_id, ''), COALESCE(u.name, ''), m.original_timestamp
+		FROM messages m
+		JOIN conversations c ON m.conversation_id = c.id
+		JOIN user_conversations uc ON c.id = uc.conversation_id
+		LEFT JOIN users u ON m.original_sender_id = u.id
+		WHERE c.is_self = 1 AND uc.user_id = ?
+		ORDER BY m.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying saved messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []ForwardedMessage
+	for rows.Next() {
+		var message ForwardedMessage
+		var originalTimestamp sql.NullTime
+		err := rows.Scan(
+			&message.ID,
+			&message.SenderID,
+			&message.Type,
+			&message.Content,
+			&message.ContentType,
+			&message.Timestamp,
+			&message.Status,
+			&message.OriginalSender.ID,
+			&message.OriginalSender.Name,
+			&originalTimestamp,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning saved message: %w", err)
+		}
+		if originalTimestamp.Valid {
+			message.OriginalTimestamp = originalTimestamp.Time
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating saved messages: %w", err)
+	}
+
+	return messages, nil
+}
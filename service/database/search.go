@@ -0,0 +1,96 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Caps on the number of messages returned by a single search, within a conversation and across all of them
+const (
+	maxMessageSearchResults       = 100
+	maxGlobalMessageSearchResults = 200
+)
+
+// likeEscaper escapes the LIKE wildcards so that they match literally, together with the ESCAPE '\' clause
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchMessagesInConversation returns the text messages of a conversation containing the query, most recent first.
+// Messages pending approval are left out. The caller is expected to have checked that the user is a participant
+func (db *appdbimpl) SearchMessagesInConversation(conversationID, query string) ([]Message, error) {
+	messages, err := db.queryMessages(selectMessagesQuery+`
+		WHERE m.conversation_id = ? AND m.status != ? AND m.type = 'text' AND m.content LIKE ? ESCAPE '\' AND
+			`+notExpiredCondition+`
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ?
+	`, conversationID, MessageStatusPending, "%"+likeEscaper.Replace(query)+"%", nowUTC(), maxMessageSearchResults)
+	if err != nil {
+		return nil, fmt.Errorf("error searching messages: %w", err)
+	}
+
+	for i := range messages {
+		reactions, err := db.GetComments(messages[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching reactions: %w", err)
+		}
+		messages[i].Comments = reactions
+	}
+
+	return messages, nil
+}
+
+// SearchUserMessages returns the text messages containing the query in all the conversations of the user, most recent
+// first, along with the total number of matches. Messages pending approval are only found by their sender
+func (db *appdbimpl) SearchUserMessages(userID, query string) ([]MessageSearchHit, int, error) {
+	const matches = `
+		FROM messages m
+		JOIN user_conversations uc ON uc.conversation_id = m.conversation_id AND uc.user_id = ?
+		JOIN conversations c ON c.id = m.conversation_id
+		JOIN users s ON s.id = m.sender_id
+		WHERE m.type = 'text' AND m.content LIKE ? ESCAPE '\' AND (m.status != ? OR m.sender_id = uc.user_id) AND
+			` + notExpiredCondition
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+	now := nowUTC()
+
+	var total int
+	err := db.c.QueryRow("SELECT COUNT(*)"+matches, userID, pattern, MessageStatusPending, now).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting search results: %w", err)
+	}
+
+	rows, err := db.c.Query(`
+		SELECT m.id, m.conversation_id,
+			COALESCE(CASE
+				WHEN c.is_group = 0 THEN (
+					SELECT u.name
+					FROM users u
+					JOIN user_conversations uc2 ON u.id = uc2.user_id
+					WHERE uc2.conversation_id = c.id AND u.id != uc.user_id
+					LIMIT 1
+				)
+				ELSE c.title
+			END, c.title, ''),
+			m.sender_id, s.name, m.content, m.created_at
+		`+matches+`
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ?
+	`, userID, pattern, MessageStatusPending, now, maxGlobalMessageSearchResults)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching messages: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []MessageSearchHit
+	for rows.Next() {
+		var h MessageSearchHit
+		if err := rows.Scan(&h.MessageID, &h.ConversationID, &h.ConversationTitle, &h.Sender.ID, &h.Sender.Name, &h.Content, &h.Timestamp); err != nil {
+			return nil, 0, fmt.Errorf("error scanning search result: %w", err)
+		}
+		hits = append(hits, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating search results: %w", err)
+	}
+
+	return hits, total, nil
+}
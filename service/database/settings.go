@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetConversationTheme stores the theme the user picked for a conversation. The theme only applies to the user's own
+// view of the conversation, an empty theme resets it to the default
+func (db *appdbimpl) SetConversationTheme(conversationID, userID, theme string) error {
+	isParticipant, err := db.IsUserInConversation(userID, conversationID)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return ErrUnauthorized
+	}
+
+	_, err = db.c.Exec(`
+		INSERT INTO conversation_settings (user_id, conversation_id, theme)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id, conversation_id) DO UPDATE SET theme = excluded.theme
+	`, userID, conversationID, sql.NullString{String: theme, Valid: theme != ""})
+	if err != nil {
+		return fmt.Errorf("error setting conversation theme: %w", err)
+	}
+
+	return nil
+}
+
+// advanceReadCursor moves the user's read cursor in a conversation forward to the given message seq. The cursor never
+// moves back, so marking an older message as read keeps the newer read position
+func advanceReadCursor(tx *sql.Tx, conversationID, userID string, seq int64) error {
+	_, err := tx.Exec(`
+		INSERT INTO conversation_settings (user_id, conversation_id, last_read_seq)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id, conversation_id) DO UPDATE SET last_read_seq = MAX(last_read_seq, excluded.last_read_seq)
+	`, userID, conversationID, seq)
+	if err != nil {
+		return fmt.Errorf("error advancing read cursor: %w", err)
+	}
+
+	return nil
+}
+
+// MarkConversationRead marks all the messages others sent to a conversation as read by the user, in a single
+// transaction, and moves the user's read cursor to the latest message. Messages everybody has now read get the read
+// status, as with UpdateMessageStatus. Returns the number of messages that weren't read by the user yet
+func (db *appdbimpl) MarkConversationRead(conversationID, userID string) (int, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	var participantCount int
+	var isParticipant bool
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(user_id = ?), 0) > 0 FROM user_conversations WHERE conversation_id = ?
+	`, userID, conversationID).Scan(&participantCount, &isParticipant)
+	if err != nil {
+		return 0, fmt.Errorf("error checking user authorization: %w", err)
+	}
+	if participantCount == 0 {
+		return 0, ErrConversationNotFound
+	}
+	if !isParticipant {
+		return 0, ErrUnauthorized
+	}
+
+	now := nowUTC()
+	result, err := tx.Exec(`
+		INSERT INTO message_read_status (message_id, user_id, status, updated_at)
+		SELECT m.id, ?, 'read', ?
+		FROM messages m
+		LEFT JOIN message_read_status rs ON rs.message_id = m.id AND rs.user_id = ?
+		WHERE m.conversation_id = ? AND m.sender_id != ? AND m.status != ? AND m.type != ?
+			AND (rs.status IS NULL OR rs.status != 'read')
+		ON CONFLICT(message_id, user_id) DO UPDATE SET status = excluded.status, updated_at = excluded.updated_at
+	`, userID, now, userID, conversationID, userID, MessageStatusPending, MessageTypeDeleted)
+	if err != nil {
+		return 0, fmt.Errorf("error updating user read status: %w", err)
+	}
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking rows affected: %w", err)
+	}
+
+	// A message is read once all the participants but its sender read it, which for one-on-one conversations is
+	// the user alone
+	_, err = tx.Exec(`
+		UPDATE messages SET status = 'read'
+		WHERE conversation_id = ? AND sender_id != ? AND status NOT IN (?, 'read') AND type != ?
+			AND (
+				SELECT COUNT(*) FROM message_read_status rs
+				WHERE rs.message_id = messages.id AND rs.status = 'read' AND rs.user_id != messages.sender_id
+			) >= ?
+	`, conversationID, userID, MessageStatusPending, MessageTypeDeleted, participantCount-1)
+	if err != nil {
+		return 0, fmt.Errorf("error updating message statuses: %w", err)
+	}
+
+	var lastSeq sql.NullInt64
+	err = tx.QueryRow("SELECT MAX(seq) FROM messages WHERE conversation_id = ?", conversationID).Scan(&lastSeq)
+	if err != nil {
+		return 0, fmt.Errorf("error getting the latest message: %w", err)
+	}
+	if lastSeq.Valid {
+		if err = advanceReadCursor(tx, conversationID, userID, lastSeq.Int64); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return int(marked), nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// nextMessageSeq returns the sequence number of the next message of a conversation, or NULL for a message pending
+// approval, which is numbered once approved. Numbers come from a counter kept with the conversation rather than from
+// the messages, so they are never reused once the newest messages are deleted. It must run in the transaction
+// inserting the message, which then holds the write lock until it ends
+func nextMessageSeq(tx *sql.Tx, conversationID, status string) (sql.NullInt64, error) {
+	if status == MessageStatusPending {
+		return sql.NullInt64{}, nil
+	}
+
+	_, err := tx.Exec("UPDATE conversations SET last_seq = last_seq + 1 WHERE id = ?", conversationID)
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("error incrementing message sequence number: %w", err)
+	}
+	var seq int64
+	err = tx.QueryRow("SELECT last_seq FROM conversations WHERE id = ?", conversationID).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sql.NullInt64{}, ErrConversationNotFound
+	}
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("error getting next message sequence number: %w", err)
+	}
+	return sql.NullInt64{Int64: seq, Valid: true}, nil
+}
+
+// GetMessagesAfterSeq returns up to limit messages of a conversation with a sequence number greater than afterSeq, in
+// order, along with the highest sequence number given in the conversation so far
+func (db *appdbimpl) GetMessagesAfterSeq(conversationID, userID string, afterSeq int64, limit int) ([]Message, int64, error) {
+	isParticipant, err := db.IsUserInConversation(userID, conversationID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !isParticipant {
+		return nil, 0, ErrUnauthorized
+	}
+
+	messages, err := db.queryMessages(selectMessagesQuery+`
+		WHERE m.conversation_id = ? AND m.seq > ? AND `+notExpiredCondition+`
+		ORDER BY m.seq
+		LIMIT ?
+	`, conversationID, afterSeq, nowUTC(), limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range messages {
+		reactions, err := db.GetComments(messages[i].ID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error fetching reactions: %w", err)
+		}
+		messages[i].Comments = reactions
+	}
+
+	var maxSeq int64
+	err = db.c.QueryRow("SELECT last_seq FROM conversations WHERE id = ?", conversationID).Scan(&maxSeq)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting latest message sequence number: %w", err)
+	}
+
+	return messages, maxSeq, nil
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// GetMessageConversationID returns the ID of the conversation a message belongs to
+func (db *appdbimpl) GetMessageConversationID(messageID string) (string, error) {
+	var conversationID string
+	err := db.c.QueryRow("SELECT conversation_id FROM messages WHERE id = ?", messageID).Scan(&conversationID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrMessageNotFound
+		}
+		return "", fmt.Errorf("error getting message conversation: %w", err)
+	}
+	return conversationID, nil
+}
+
+// GetReplies returns the thread of a message: the message itself followed by its direct replies the user can see, in
+// chronological order
+func (db *appdbimpl) GetReplies(messageID, userID string) ([]Message, error) {
+	conversationID, err := db.GetMessageConversationID(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	isAuthorized, err := db.IsUserAuthorized(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAuthorized {
+		return nil, ErrUnauthorized
+	}
+
+	parent, err := db.GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	isAdmin, err := db.IsGroupAdmin(conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := db.queryMessages(selectMessagesQuery+" WHERE "+visibleMessagesCondition+`
+		AND m.parent_message_id = ?
+		ORDER BY m.created_at, m.id
+	`, conversationID, MessageStatusPending, userID, isAdmin, nowUTC(), messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range replies {
+		reactions, err := db.GetComments(replies[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching reactions: %w", err)
+		}
+		replies[i].Comments = reactions
+	}
+
+	return append([]Message{*parent}, replies...), nil
+}
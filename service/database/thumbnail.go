@@ -0,0 +1,111 @@
+package database
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	// Register the GIF decoder, JPEG and PNG are registered by the encoders above
+	_ "image/gif"
+)
+
+// Thumbnails fit in a maxThumbnailDimension square. Images of more than maxThumbnailSourcePixels pixels don't get a
+// thumbnail, so that a small but highly compressed upload can't make the server decode a huge bitmap
+const (
+	maxThumbnailDimension    = 256
+	maxThumbnailSourcePixels = 24_000_000
+	thumbnailJPEGQuality     = 80
+)
+
+// makeThumbnail scales an image down to fit in maxThumbnailDimension, keeping its aspect ratio. JPEG images get a
+// JPEG thumbnail and the others a PNG one, the first frame for animated GIFs. It returns nil when the data isn't a
+// decodable image, is too large to decode or already fits
+func makeThumbnail(data []byte) ([]byte, string) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ""
+	}
+	if config.Width <= maxThumbnailDimension && config.Height <= maxThumbnailDimension {
+		return nil, ""
+	}
+	if config.Width*config.Height > maxThumbnailSourcePixels {
+		return nil, ""
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ""
+	}
+
+	width, height := maxThumbnailDimension, maxThumbnailDimension
+	if config.Width > config.Height {
+		height = config.Height * maxThumbnailDimension / config.Width
+	} else {
+		width = config.Width * maxThumbnailDimension / config.Height
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	thumbnail := scaleDown(src, width, height)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+			return nil, ""
+		}
+		return buf.Bytes(), "image/jpeg"
+	}
+	if err := png.Encode(&buf, thumbnail); err != nil {
+		return nil, ""
+	}
+	return buf.Bytes(), "image/png"
+}
+
+// scaleDown resizes an image to a smaller size, averaging the source pixels covered by each thumbnail pixel
+func scaleDown(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	// Drawing onto an RGBA image first gives premultiplied 8 bit channels whatever the source format
+	rgba := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, (y+1)*srcHeight/height
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, (x+1)*srcWidth/width
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				i := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					sum[0] += int(rgba.Pix[i])
+					sum[1] += int(rgba.Pix[i+1])
+					sum[2] += int(rgba.Pix[i+2])
+					sum[3] += int(rgba.Pix[i+3])
+					i += 4
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			j := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[j+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	return dst
+}
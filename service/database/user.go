@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
@@ -54,7 +55,7 @@ func (db *appdbimpl) GetOrCreateUser(name string) (string, error) {
 		}
 
 		// Insert the new user
-		_, err = db.c.Exec("INSERT INTO users (id, name) VALUES (?, ?)", userID, name)
+		_, err = db.c.Exec("INSERT INTO users (id, name, created_at) VALUES (?, ?, ?)", userID, name, nowUTC())
 		if err != nil {
 			// Check for unique constraint violation
 			var sqliteErr sqlite3.Error
@@ -80,10 +81,27 @@ func (db *appdbimpl) GetOrCreateUser(name string) (string, error) {
 	return "", fmt.Errorf("failed to generate a unique user ID after multiple attempts")
 }
 
+// UpdateUsername changes the name of a user. The uniqueness check and the update run in the same transaction, with the
+// unique constraint on users.name as the backstop for concurrent renames
 func (db *appdbimpl) UpdateUsername(userID string, newName string) error {
+	// Start a transaction
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
 	// First check if the user exists
 	var exists bool
-	err := db.c.QueryRow("SELECT 1 FROM users WHERE id = ?", userID).Scan(&exists)
+	err = tx.QueryRow("SELECT 1 FROM users WHERE id = ?", userID).Scan(&exists)
 	if errors.Is(err, sql.ErrNoRows) {
 		return ErrUserNotFound
 	}
@@ -93,7 +111,7 @@ func (db *appdbimpl) UpdateUsername(userID string, newName string) error {
 
 	// Check if the new username is already taken by another user
 	var existingUserID string
-	err = db.c.QueryRow("SELECT id FROM users WHERE name = ?", newName).Scan(&existingUserID)
+	err = tx.QueryRow("SELECT id FROM users WHERE name = ?", newName).Scan(&existingUserID)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
@@ -104,7 +122,7 @@ func (db *appdbimpl) UpdateUsername(userID string, newName string) error {
 	}
 
 	// Try to update the username
-	_, err = db.c.Exec("UPDATE users SET name = ? WHERE id = ?", newName, userID)
+	_, err = tx.Exec("UPDATE users SET name = ? WHERE id = ?", newName, userID)
 	if err != nil {
 		// Use errors.As instead of type assertion for checking
 		var sqliteErr sqlite3.Error
@@ -114,6 +132,18 @@ func (db *appdbimpl) UpdateUsername(userID string, newName string) error {
 		return err
 	}
 
+	// Commit the transaction, a concurrent rename may still be caught by the unique constraint here
+	if err := tx.Commit(); err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+			return ErrDuplicateUsername
+		}
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
 	return nil
 }
 
@@ -157,7 +187,7 @@ func (db *appdbimpl) UpdateUserPhoto(userID string, fileData []byte, contentType
 	_, err = tx.Exec(`
 		INSERT INTO media_files (id, file_data, mime_type, created_at)
 		VALUES (?, ?, ?, ?)
-	`, photoID, fileData, contentType, time.Now())
+	`, photoID, fileData, contentType, nowUTC())
 	if err != nil {
 		logrus.WithError(err).Error("Error storing photo data in database")
 		return "", "", fmt.Errorf("error storing photo data: %w", err)
@@ -193,6 +223,16 @@ func (db *appdbimpl) UpdateUserPhoto(userID string, fileData []byte, contentType
 	return oldPhotoIDString, photoID, nil
 }
 
+// IsUsernameAvailable reports whether no user has the given name yet
+func (db *appdbimpl) IsUsernameAvailable(name string) (bool, error) {
+	var taken bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE name = ?)", name).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("error checking username availability: %w", err)
+	}
+	return !taken, nil
+}
+
 // generateUserID creates a 12-character identifier following the pattern ^[a-zA-Z0-9_-]{12}$
 func GenerateUserID() string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-"
@@ -258,3 +298,281 @@ func (db *appdbimpl) GeneratePhotoID(userID string) string {
 
 	return photoID
 }
+
+// SetSnoozeUntil suppresses all notifications for a user until the given time, a nil time ends the snooze
+func (db *appdbimpl) SetSnoozeUntil(userID string, until *time.Time) error {
+	if until != nil {
+		utc := until.UTC()
+		until = &utc
+	}
+	result, err := db.c.Exec("UPDATE users SET snooze_until = ? WHERE id = ?", until, userID)
+	if err != nil {
+		return fmt.Errorf("error updating snooze: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// MaxBioLength is the maximum length of a user's bio, in characters
+const MaxBioLength = 139
+
+// UpdateUserBio sets the "about" line shown next to a user, an empty bio clears it
+func (db *appdbimpl) UpdateUserBio(userID string, bio string) error {
+	if utf8.RuneCountInString(bio) > MaxBioLength {
+		return ErrBioTooLong
+	}
+
+	result, err := db.c.Exec("UPDATE users SET bio = ? WHERE id = ?", bio, userID)
+	if err != nil {
+		return fmt.Errorf("error updating bio: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserPhoto clears the profile photo of a user and returns the ID of the removed photo, which is empty when the
+// user had none. The photo itself is left to the orphan media cleanup
+func (db *appdbimpl) RemoveUserPhoto(userID string) (oldPhotoID string, err error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	var photoID sql.NullString
+	err = tx.QueryRow("SELECT photo_id FROM users WHERE id = ?", userID).Scan(&photoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("error querying user: %w", err)
+	}
+	if !photoID.Valid || photoID.String == "" {
+		return "", nil
+	}
+
+	if _, err = tx.Exec("UPDATE users SET photo_id = NULL WHERE id = ?", userID); err != nil {
+		return "", fmt.Errorf("error removing user photo: %w", err)
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return photoID.String, nil
+}
+
+// GetSnoozeUntil returns the time until which notifications are suppressed for a user, or nil if the user isn't
+// snoozed. Notification delivery checks this before notifying the user
+func (db *appdbimpl) GetSnoozeUntil(userID string) (*time.Time, error) {
+	var snoozeUntil sql.NullTime
+	err := db.c.QueryRow("SELECT snooze_until FROM users WHERE id = ?", userID).Scan(&snoozeUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying snooze: %w", err)
+	}
+
+	// An expired snooze is the same as none
+	if !snoozeUntil.Valid || !snoozeUntil.Time.After(nowUTC()) {
+		return nil, nil
+	}
+
+	return &snoozeUntil.Time, nil
+}
+
+// The messages and group history of deleted accounts are kept and attributed to this placeholder user. Its name can't
+// be registered, as it doesn't match the username pattern
+const (
+	DeletedUserID   = "deleted_user"
+	DeletedUserName = "Deleted user"
+)
+
+// DeleteUser deletes an account. What the user leaves behind is handled as follows:
+//   - 1:1 conversations and the saved messages conversation are deleted as a whole, for both participants
+//   - the user leaves every group, which is deleted when they were its last member, and whose longest-standing member
+//     becomes admin when they were its last admin
+//   - messages in groups, forwards of their messages and group history stay, attributed to DeletedUserID
+//   - reactions, read receipts, flags, conversation settings and recent emoji are deleted
+//
+// The profile photo is left to the orphan media cleanup
+func (db *appdbimpl) DeleteUser(userID string) (string, error) {
+	if userID == DeletedUserID {
+		return "", ErrUnauthorized
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Ensure transaction is rolled back if an error occurs
+	defer func() {
+		if tx != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+			}
+		}
+	}()
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM users WHERE id = ?", userID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting user: %w", err)
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO users (id, name, created_at) VALUES (?, ?, ?)", DeletedUserID, DeletedUserName, nowUTC())
+	if err != nil {
+		return "", fmt.Errorf("error creating deleted user placeholder: %w", err)
+	}
+
+	conversationIDs, err := userConversationIDs(tx, userID, false)
+	if err != nil {
+		return "", err
+	}
+	for _, conversationID := range conversationIDs {
+		if err = deleteConversation(tx, conversationID); err != nil {
+			return "", err
+		}
+	}
+
+	groupIDs, err := userConversationIDs(tx, userID, true)
+	if err != nil {
+		return "", err
+	}
+	for _, groupID := range groupIDs {
+		if err = removeDeletedUserFromGroup(tx, groupID, userID); err != nil {
+			return "", err
+		}
+	}
+
+	for _, query := range deleteUserQueries {
+		if _, err = tx.Exec(query, userID); err != nil {
+			return "", fmt.Errorf("error deleting user data: %w", err)
+		}
+	}
+	for _, query := range reassignDeletedUserQueries {
+		if _, err = tx.Exec(query, DeletedUserID, userID); err != nil {
+			return "", fmt.Errorf("error reassigning user data: %w", err)
+		}
+	}
+
+	if _, err = tx.Exec("DELETE FROM users WHERE id = ?", userID); err != nil {
+		return "", fmt.Errorf("error deleting user: %w", err)
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Set tx to nil to prevent rollback in defer function
+	tx = nil
+
+	return name, nil
+}
+
+// deleteUserQueries delete the rows only meaningful to the user being deleted
+var deleteUserQueries = []string{
+	"DELETE FROM comments WHERE user_id = ?",
+	"DELETE FROM message_read_status WHERE user_id = ?",
+	"DELETE FROM flagged_messages WHERE user_id = ?",
+	"DELETE FROM message_mentions WHERE user_id = ?",
+	"DELETE FROM conversation_settings WHERE user_id = ?",
+	"DELETE FROM recent_emoji WHERE user_id = ?",
+	"DELETE FROM user_blocks WHERE blocker_id = ?",
+	"DELETE FROM user_blocks WHERE blocked_id = ?",
+}
+
+// reassignDeletedUserQueries attribute what stays of a deleted user to the placeholder user. They take the placeholder
+// ID and the deleted user ID
+var reassignDeletedUserQueries = []string{
+	"UPDATE messages SET sender_id = ? WHERE sender_id = ?",
+	"UPDATE messages SET original_sender_id = ? WHERE original_sender_id = ?",
+	"UPDATE group_events SET actor_id = ? WHERE actor_id = ?",
+	"UPDATE group_events SET target_id = ? WHERE target_id = ?",
+}
+
+// userConversationIDs returns the IDs of the group or non-group conversations a user participates in, including the
+// 1:1 conversations they removed from their list
+func userConversationIDs(tx *sql.Tx, userID string, groups bool) ([]string, error) {
+	rows, err := tx.Query(`
+		SELECT c.id
+		FROM conversations c
+		WHERE c.is_group = ?
+		AND (c.id IN (SELECT conversation_id FROM user_conversations WHERE user_id = ?) OR c.removed_user_id = ?)
+	`, groups, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying user conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning conversation ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user conversations: %w", err)
+	}
+
+	return ids, nil
+}
+
+// removeDeletedUserFromGroup makes a user being deleted leave a group, like LeaveGroup does
+func removeDeletedUserFromGroup(tx *sql.Tx, groupID, userID string) error {
+	if _, err := tx.Exec("DELETE FROM user_conversations WHERE conversation_id = ? AND user_id = ?", groupID, userID); err != nil {
+		return fmt.Errorf("error removing user from user_conversations: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID); err != nil {
+		return fmt.Errorf("error removing user from group_members: %w", err)
+	}
+
+	var memberCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM user_conversations WHERE conversation_id = ?", groupID).Scan(&memberCount); err != nil {
+		return fmt.Errorf("error checking group member count: %w", err)
+	}
+	if memberCount == 0 {
+		return deleteConversation(tx, groupID)
+	}
+
+	if _, err := tx.Exec(promoteGroupAdminQuery, groupID, groupID); err != nil {
+		return fmt.Errorf("error promoting group admin: %w", err)
+	}
+	return recordGroupEvent(tx, groupID, GroupEventMemberLeft, userID, userID, "")
+}
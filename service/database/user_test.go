@@ -0,0 +1,103 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestUpdateUsernameConcurrent(t *testing.T) {
+	db := newTestDB(t)
+
+	const users = 8
+	ids := make([]string, users)
+	for i := range ids {
+		ids[i] = newTestUser(t, db, fmt.Sprintf("user%d", i))
+	}
+
+	// Every user tries to take the same name at once, only one of them gets it
+	var wg sync.WaitGroup
+	errs := make([]error, users)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.UpdateUsername(ids[i], "contested")
+		}(i)
+	}
+	wg.Wait()
+
+	winner := ""
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if winner != "" {
+				t.Errorf("both %s and %s got the name", winner, ids[i])
+			}
+			winner = ids[i]
+		case !errors.Is(err, ErrDuplicateUsername):
+			t.Errorf("UpdateUsername(%s) = %v, want nil or ErrDuplicateUsername", ids[i], err)
+		}
+	}
+	if winner == "" {
+		t.Fatal("no user got the name")
+	}
+
+	owner, err := db.GetUserIDByName("contested")
+	if err != nil {
+		t.Fatalf("GetUserIDByName: %v", err)
+	}
+	if owner != winner {
+		t.Errorf("name owned by %s, want %s", owner, winner)
+	}
+}
+
+func TestUpdateUsernameTaken(t *testing.T) {
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	newTestUser(t, db, "bob")
+
+	if err := db.UpdateUsername(alice, "bob"); !errors.Is(err, ErrDuplicateUsername) {
+		t.Errorf("renaming to a taken name: got %v, want ErrDuplicateUsername", err)
+	}
+	if err := db.UpdateUsername(alice, "alice"); err != nil {
+		t.Errorf("keeping one's own name: %v", err)
+	}
+	if err := db.UpdateUsername("nosuchuser", "carol"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("renaming a missing user: got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUserSearchWildcards(t *testing.T) {
+	db := newTestDB(t)
+	viewer := newTestUser(t, db, "viewer")
+	newTestUser(t, db, "max_power")
+	newTestUser(t, db, "maxxpower")
+	newTestUser(t, db, "ma_")
+
+	// The underscore only matches itself, not any character
+	users, total, err := db.SearchUsers("x_p", viewer, false)
+	if err != nil {
+		t.Fatalf("SearchUsers: %v", err)
+	}
+	if total != 1 || len(users) != 1 || users[0].Name != "max_power" {
+		t.Errorf("SearchUsers(x_p) = %+v (total %d), want only max_power", users, total)
+	}
+
+	users, total, err = db.ListUsers("x_p", "name", false, 10, 0)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if total != 1 || len(users) != 1 || users[0].Name != "max_power" {
+		t.Errorf("ListUsers(x_p) = %+v (total %d), want only max_power", users, total)
+	}
+
+	users, total, err = db.ListUsers("%", "name", false, 10, 0)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if total != 0 || len(users) != 0 {
+		t.Errorf("ListUsers(%%) = %+v (total %d), want no users", users, total)
+	}
+}
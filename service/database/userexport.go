@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetUserProfile returns the profile of a user
+func (db *appdbimpl) GetUserProfile(userID string) (*User, error) {
+	var user User
+	var photoID sql.NullString
+	var createdAt sql.NullTime
+	err := db.c.QueryRow("SELECT id, name, photo_id, bio, created_at FROM users WHERE id = ?", userID).
+		Scan(&user.ID, &user.Name, &photoID, &user.Bio, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying user: %w", err)
+	}
+
+	user.PhotoID = photoID.String
+	if createdAt.Valid {
+		user.CreatedAt = &createdAt.Time
+	}
+	return &user, nil
+}
+
+// ForEachSentMessage calls fn for each message the user sent that still exists, grouped by conversation and oldest
+// first within each, including the conversations they have since left. Deleted and expired messages are skipped, and
+// the reactions of others aren't loaded. Like ForEachMessage, the messages are loaded in batches and it stops at the
+// first error returned by fn
+func (db *appdbimpl) ForEachSentMessage(userID string, fn func(conversationID string, m Message) error) error {
+	rows, err := db.c.Query(`
+		SELECT DISTINCT conversation_id FROM messages WHERE sender_id = ? AND type != ? ORDER BY conversation_id
+	`, userID, MessageTypeDeleted)
+	if err != nil {
+		return fmt.Errorf("error fetching conversations: %w", err)
+	}
+	var conversationIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning conversation ID: %w", err)
+		}
+		conversationIDs = append(conversationIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating conversations: %w", err)
+	}
+
+	for _, conversationID := range conversationIDs {
+		var lastTimestamp time.Time
+		var lastID string
+		for {
+			query := selectMessagesQuery + ` WHERE m.conversation_id = ? AND m.sender_id = ? AND m.type != ? AND
+				(m.expires_at IS NULL OR m.expires_at > ?)`
+			args := []interface{}{conversationID, userID, MessageTypeDeleted, nowUTC()}
+			if lastID != "" {
+				query += " AND (m.created_at > ? OR (m.created_at = ? AND m.id > ?))"
+				args = append(args, lastTimestamp, lastTimestamp, lastID)
+			}
+			query += " ORDER BY m.created_at, m.id LIMIT ?"
+			args = append(args, messageBatchSize)
+
+			batch, err := db.queryMessages(query, args...)
+			if err != nil {
+				return err
+			}
+			for _, msg := range batch {
+				if err := fn(conversationID, msg); err != nil {
+					return err
+				}
+			}
+
+			if len(batch) < messageBatchSize {
+				break
+			}
+			lastTimestamp = batch[len(batch)-1].Timestamp
+			lastID = batch[len(batch)-1].ID
+		}
+	}
+	return nil
+}
+
+// ForEachUserReaction calls fn for each reaction the user made, oldest first. The reactions are loaded in batches of
+// messageBatchSize and it stops at the first error returned by fn
+func (db *appdbimpl) ForEachUserReaction(userID string, fn func(Comment) error) error {
+	var lastTimestamp time.Time
+	var lastID string
+	for {
+		query := `
+			SELECT c.id, c.message_id, c.user_id, u.name, c.content, c.created_at
+			FROM comments c
+			JOIN users u ON c.user_id = u.id
+			WHERE c.user_id = ?`
+		args := []interface{}{userID}
+		if lastID != "" {
+			query += " AND (c.created_at > ? OR (c.created_at = ? AND c.id > ?))"
+			args = append(args, lastTimestamp, lastTimestamp, lastID)
+		}
+		query += " ORDER BY c.created_at, c.id LIMIT ?"
+		args = append(args, messageBatchSize)
+
+		rows, err := db.c.Query(query, args...)
+		if err != nil {
+			return fmt.Errorf("error fetching reactions: %w", err)
+		}
+		var batch []Comment
+		for rows.Next() {
+			var c Comment
+			if err := rows.Scan(&c.ID, &c.MessageID, &c.UserID, &c.Username, &c.Content, &c.Timestamp); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning reaction: %w", err)
+			}
+			batch = append(batch, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating reactions: %w", err)
+		}
+
+		for _, c := range batch {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < messageBatchSize {
+			return nil
+		}
+		lastTimestamp = batch[len(batch)-1].Timestamp
+		lastID = batch[len(batch)-1].ID
+	}
+}
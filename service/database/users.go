@@ -7,41 +7,56 @@ import (
 )
 
 // SearchUsers searches for users based on a query string
-// Returns all users if query is empty
-func (db *appdbimpl) SearchUsers(query string) ([]User, int, error) {
-	var rows *sql.Rows
-	var err error
-	var countQuery string
-	var searchQuery string
+// Returns all users if query is empty. Users who blocked the viewer or were blocked by them are left out. If
+// excludePartners is set, the viewer and everyone they already have a 1:1 conversation with are left out too
+func (db *appdbimpl) SearchUsers(query string, viewerID string, excludePartners bool) ([]User, int, error) {
+	from := "FROM users u"
+	conditions := []string{}
+	args := []interface{}{}
+
+	if excludePartners {
+		from += `
+			LEFT JOIN (
+				SELECT uc2.user_id
+				FROM user_conversations uc1
+				JOIN conversations c ON uc1.conversation_id = c.id AND c.is_group = 0 AND c.is_self = 0
+				JOIN user_conversations uc2 ON uc2.conversation_id = c.id AND uc2.user_id != uc1.user_id
+				WHERE uc1.user_id = ?
+			) partners ON partners.user_id = u.id`
+		conditions = append(conditions, "partners.user_id IS NULL", "u.id != ?")
+		args = append(args, viewerID, viewerID)
+	}
 
 	// If query is empty or just whitespace, return all users
-	if strings.TrimSpace(query) == "" {
-		countQuery = "SELECT COUNT(*) FROM users"
-		searchQuery = "SELECT id, name, photo_id FROM users LIMIT 1000"
-	} else {
-		countQuery = "SELECT COUNT(*) FROM users WHERE name LIKE ?"
-		searchQuery = "SELECT id, name, photo_id FROM users WHERE name LIKE ? LIMIT 1000"
+	if strings.TrimSpace(query) != "" {
+		conditions = append(conditions, `u.name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(query)+"%")
+	}
+
+	// The placeholder standing in for deleted accounts is never listed
+	conditions = append(conditions, "u.id != ?")
+	args = append(args, DeletedUserID)
+
+	conditions = append(conditions, `NOT EXISTS (
+		SELECT 1 FROM user_blocks b
+		WHERE (b.blocker_id = ? AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = ?)
+	)`)
+	args = append(args, viewerID, viewerID)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
 	}
 
 	// Get total count
 	var total int
-	var countErr error
-	if strings.TrimSpace(query) == "" {
-		countErr = db.c.QueryRow(countQuery).Scan(&total)
-	} else {
-		countErr = db.c.QueryRow(countQuery, "%"+query+"%").Scan(&total)
-	}
-	if countErr != nil {
-		return nil, 0, fmt.Errorf("error counting users: %w", countErr)
+	err := db.c.QueryRow("SELECT COUNT(*) "+from+" "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting users: %w", err)
 	}
 
 	// Execute search query
-	if strings.TrimSpace(query) == "" {
-		rows, err = db.c.Query(searchQuery)
-	} else {
-		rows, err = db.c.Query(searchQuery, "%"+query+"%")
-	}
-
+	rows, err := db.c.Query("SELECT u.id, u.name, u.photo_id, u.bio "+from+" "+where+" LIMIT 1000", args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error searching users: %w", err)
 	}
@@ -51,7 +66,7 @@ func (db *appdbimpl) SearchUsers(query string) ([]User, int, error) {
 	for rows.Next() {
 		var user User
 		var photoID sql.NullString
-		if err := rows.Scan(&user.ID, &user.Name, &photoID); err != nil {
+		if err := rows.Scan(&user.ID, &user.Name, &photoID, &user.Bio); err != nil {
 			return nil, 0, fmt.Errorf("error scanning user row: %w", err)
 		}
 		if photoID.Valid {
@@ -67,3 +82,65 @@ func (db *appdbimpl) SearchUsers(query string) ([]User, int, error) {
 
 	return users, total, nil
 }
+
+// ListUsers returns a page of all users, optionally filtered by a name substring. Users can be sorted by "name" or
+// "created"; users created before the creation time was recorded sort first. Also returns the total count of
+// matching users
+func (db *appdbimpl) ListUsers(filter string, sortBy string, descending bool, limit int, offset int) ([]User, int, error) {
+	var orderBy string
+	switch sortBy {
+	case "created":
+		orderBy = "created_at"
+	case "name", "":
+		orderBy = "name"
+	default:
+		return nil, 0, fmt.Errorf("invalid sort field: %s", sortBy)
+	}
+	if descending {
+		orderBy += " DESC"
+	}
+
+	pattern := "%" + likeEscaper.Replace(filter) + "%"
+
+	// Get total count
+	var total int
+	err := db.c.QueryRow(`SELECT COUNT(*) FROM users WHERE name LIKE ? ESCAPE '\'`, pattern).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting users: %w", err)
+	}
+
+	rows, err := db.c.Query(`
+		SELECT id, name, photo_id, created_at
+		FROM users
+		WHERE name LIKE ? ESCAPE '\'
+		ORDER BY `+orderBy+`, id
+		LIMIT ? OFFSET ?
+	`, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		var photoID sql.NullString
+		var createdAt sql.NullTime
+		if err := rows.Scan(&user.ID, &user.Name, &photoID, &createdAt); err != nil {
+			return nil, 0, fmt.Errorf("error scanning user row: %w", err)
+		}
+		if photoID.Valid {
+			user.PhotoID = photoID.String
+		}
+		if createdAt.Valid {
+			user.CreatedAt = &createdAt.Time
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating user rows: %w", err)
+	}
+
+	return users, total, nil
+}